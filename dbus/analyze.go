@@ -0,0 +1,298 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrBootNotFinished is returned by the boot analysis methods if the system
+// is still booting.
+var ErrBootNotFinished = errors.New("bootup is not yet finished")
+
+// BootTimes are the durations of the boot phases, like 'systemd-analyze time'.
+type BootTimes struct {
+	Firmware  time.Duration // Time spent in the firmware, 0 if unknown
+	Loader    time.Duration // Time spent in the boot loader, 0 if unknown
+	Kernel    time.Duration // Time spent in the kernel before the initrd or userspace was started
+	InitRD    time.Duration // Time spent in the initrd, 0 if there was none
+	Userspace time.Duration // Time spent in userspace until the boot finished
+	Total     time.Duration // Time from the start of the firmware, or of the kernel if unknown, until the boot finished
+
+	userspaceStart time.Duration // CLOCK_MONOTONIC timestamp of the start of userspace
+	finish         time.Duration // CLOCK_MONOTONIC timestamp of the end of the boot
+}
+
+// managerTimestamps are the Manager properties the boot times are computed
+// from. The firmware and loader timestamps count backwards from the start of
+// the kernel.
+type managerTimestamps struct {
+	FirmwareTimestampMonotonic  time.Duration
+	LoaderTimestampMonotonic    time.Duration
+	InitRDTimestampMonotonic    time.Duration
+	UserspaceTimestampMonotonic time.Duration
+	FinishTimestampMonotonic    time.Duration
+}
+
+// UnitTime holds when a unit was activated during boot. The timestamps are
+// relative to the start of userspace, or to the start of the kernel for the
+// units of the initrd, like in 'systemd-analyze critical-chain'.
+type UnitTime struct {
+	Name         string
+	Activating   time.Duration // When the unit left the inactive state
+	Activated    time.Duration // When the unit entered the active state
+	Deactivating time.Duration // When the unit left the active state, 0 if it did not
+	Deactivated  time.Duration // When the unit entered the inactive state, 0 if it did not
+	Time         time.Duration // How long the unit took to activate, or to fail
+}
+
+// unitTimestamps are the Unit properties UnitTimes are computed from.
+type unitTimestamps struct {
+	InactiveExitTimestampMonotonic  time.Duration
+	ActiveEnterTimestampMonotonic   time.Duration
+	ActiveExitTimestampMonotonic    time.Duration
+	InactiveEnterTimestampMonotonic time.Duration
+}
+
+// CriticalChainUnit is a unit of the tree returned by CriticalChain.
+type CriticalChainUnit struct {
+	UnitTime
+	// After are the units the unit is ordered after which became active
+	// last, and thus delayed it. Usually there is a single one, more if
+	// several became active within the fuzz passed to CriticalChain.
+	After []*CriticalChainUnit
+}
+
+// GetBootTimes returns the durations of the boot phases, or
+// ErrBootNotFinished if the system is still booting.
+func (c *Conn) GetBootTimes() (*BootTimes, error) {
+	return c.GetBootTimesContext(context.Background())
+}
+
+// GetBootTimesContext is the same as GetBootTimes with a context.
+func (c *Conn) GetBootTimesContext(ctx context.Context) (*BootTimes, error) {
+	props, err := c.getManagerProperties(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bootTimes(props)
+}
+
+// Blame returns the units which were activated since the start of the boot,
+// sorted by the time they took to activate, slowest first, like
+// 'systemd-analyze blame'. Note that units may be slow because they waited for
+// other units, see CriticalChain.
+func (c *Conn) Blame() ([]UnitTime, error) {
+	return c.BlameContext(context.Background())
+}
+
+// BlameContext is the same as Blame with a context.
+func (c *Conn) BlameContext(ctx context.Context) ([]UnitTime, error) {
+	boot, err := c.GetBootTimesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	units, err := c.ListUnitsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var times []UnitTime
+	for _, u := range units {
+		props, err := c.getProperties(ctx, u.Name, "org.freedesktop.systemd1.Unit")
+		if err != nil {
+			return nil, err
+		}
+		t, err := boot.unitTime(u.Name, props)
+		if err != nil {
+			return nil, err
+		}
+		if t.Activating != 0 && t.Time != 0 {
+			times = append(times, t)
+		}
+	}
+
+	sort.Slice(times, func(i, j int) bool {
+		if times[i].Time != times[j].Time {
+			return times[i].Time > times[j].Time
+		}
+		return times[i].Name < times[j].Name
+	})
+	return times, nil
+}
+
+// CriticalChain returns the tree of units which delayed the activation of
+// unit, or default.target if empty, like 'systemd-analyze critical-chain'.
+// Starting at unit, it follows the After dependencies which became active
+// last, or within fuzz of the last one.
+func (c *Conn) CriticalChain(unit string, fuzz time.Duration) (*CriticalChainUnit, error) {
+	return c.CriticalChainContext(context.Background(), unit, fuzz)
+}
+
+// CriticalChainContext is the same as CriticalChain with a context.
+func (c *Conn) CriticalChainContext(ctx context.Context, unit string, fuzz time.Duration) (*CriticalChainUnit, error) {
+	boot, err := c.GetBootTimesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if unit == "" {
+		unit = "default.target"
+	}
+	return criticalChain(ctx, boot, unit, fuzz, func(ctx context.Context, unit string) (map[string]interface{}, error) {
+		return c.getProperties(ctx, unit, "org.freedesktop.systemd1.Unit")
+	})
+}
+
+func bootTimes(props map[string]interface{}) (*BootTimes, error) {
+	var ts managerTimestamps
+	if err := storeProperties(props, &ts); err != nil {
+		return nil, err
+	}
+	if ts.FinishTimestampMonotonic == 0 {
+		return nil, ErrBootNotFinished
+	}
+
+	b := &BootTimes{
+		Loader:         ts.LoaderTimestampMonotonic,
+		Userspace:      ts.FinishTimestampMonotonic - ts.UserspaceTimestampMonotonic,
+		Total:          ts.FirmwareTimestampMonotonic + ts.FinishTimestampMonotonic,
+		userspaceStart: ts.UserspaceTimestampMonotonic,
+		finish:         ts.FinishTimestampMonotonic,
+	}
+	if ts.FirmwareTimestampMonotonic != 0 {
+		b.Firmware = ts.FirmwareTimestampMonotonic - ts.LoaderTimestampMonotonic
+	}
+	if ts.InitRDTimestampMonotonic != 0 {
+		b.Kernel = ts.InitRDTimestampMonotonic
+		b.InitRD = ts.UserspaceTimestampMonotonic - ts.InitRDTimestampMonotonic
+	} else {
+		b.Kernel = ts.UserspaceTimestampMonotonic
+	}
+	return b, nil
+}
+
+// unitTime computes the UnitTime of unit from its properties.
+func (b *BootTimes) unitTime(unit string, props map[string]interface{}) (UnitTime, error) {
+	var ts unitTimestamps
+	if err := storeProperties(props, &ts); err != nil {
+		return UnitTime{}, err
+	}
+
+	t := UnitTime{Name: unit}
+	switch {
+	case ts.ActiveEnterTimestampMonotonic >= ts.InactiveExitTimestampMonotonic:
+		t.Time = ts.ActiveEnterTimestampMonotonic - ts.InactiveExitTimestampMonotonic
+	case ts.ActiveExitTimestampMonotonic >= ts.InactiveExitTimestampMonotonic:
+		t.Time = ts.ActiveExitTimestampMonotonic - ts.InactiveExitTimestampMonotonic
+	}
+
+	rel := func(d time.Duration) time.Duration {
+		if d >= b.userspaceStart {
+			return d - b.userspaceStart
+		}
+		return d
+	}
+	t.Activating = rel(ts.InactiveExitTimestampMonotonic)
+	t.Activated = rel(ts.ActiveEnterTimestampMonotonic)
+	t.Deactivating = rel(ts.ActiveExitTimestampMonotonic)
+	t.Deactivated = rel(ts.InactiveEnterTimestampMonotonic)
+	return t, nil
+}
+
+// inBoot returns whether t became active before the end of the boot.
+func (b *BootTimes) inBoot(t UnitTime) bool {
+	return t.Activated > 0 && t.Activated <= b.finish-b.userspaceStart
+}
+
+func criticalChain(ctx context.Context, boot *BootTimes, root string, fuzz time.Duration, properties func(context.Context, string) (map[string]interface{}, error)) (*CriticalChainUnit, error) {
+	type unit struct {
+		time  UnitTime
+		after []string
+	}
+	units := make(map[string]*unit)
+	load := func(name string) (*unit, error) {
+		if u, ok := units[name]; ok {
+			return u, nil
+		}
+		props, err := properties(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		t, err := boot.unitTime(name, props)
+		if err != nil {
+			return nil, err
+		}
+		after, _ := props["After"].([]string)
+		u := &unit{time: t, after: after}
+		units[name] = u
+		return u, nil
+	}
+
+	r, err := load(root)
+	if err != nil {
+		return nil, err
+	}
+	chain := &CriticalChainUnit{UnitTime: r.time}
+	visited := map[string]bool{root: true}
+
+	queue := []*CriticalChainUnit{chain}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		var deps []*unit
+		var longest time.Duration
+		for _, name := range units[c.Name].after {
+			d, err := load(name)
+			if err != nil {
+				return nil, err
+			}
+			if !boot.inBoot(d.time) {
+				continue
+			}
+			deps = append(deps, d)
+			if d.time.Activated > longest {
+				longest = d.time.Activated
+			}
+		}
+
+		sort.Slice(deps, func(i, j int) bool {
+			if deps[i].time.Activated != deps[j].time.Activated {
+				return deps[i].time.Activated > deps[j].time.Activated
+			}
+			return deps[i].time.Name < deps[j].time.Name
+		})
+		for _, d := range deps {
+			if longest-d.time.Activated > fuzz {
+				break
+			}
+			next := &CriticalChainUnit{UnitTime: d.time}
+			c.After = append(c.After, next)
+			// Units reached through several paths are only expanded
+			// once.
+			if !visited[d.time.Name] {
+				visited[d.time.Name] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBootTimes(t *testing.T) {
+	b, err := bootTimes(map[string]interface{}{
+		"FirmwareTimestampMonotonic":  uint64(5000000),
+		"LoaderTimestampMonotonic":    uint64(2000000),
+		"InitRDTimestampMonotonic":    uint64(1000000),
+		"UserspaceTimestampMonotonic": uint64(4000000),
+		"FinishTimestampMonotonic":    uint64(10000000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := BootTimes{
+		Firmware:       3 * time.Second,
+		Loader:         2 * time.Second,
+		Kernel:         1 * time.Second,
+		InitRD:         3 * time.Second,
+		Userspace:      6 * time.Second,
+		Total:          15 * time.Second,
+		userspaceStart: 4 * time.Second,
+		finish:         10 * time.Second,
+	}
+	if *b != want {
+		t.Fatalf("Got %+v, want %+v", *b, want)
+	}
+
+	_, err = bootTimes(map[string]interface{}{
+		"UserspaceTimestampMonotonic": uint64(4000000),
+		"FinishTimestampMonotonic":    uint64(0),
+	})
+	if err != ErrBootNotFinished {
+		t.Fatalf("Expected ErrBootNotFinished, got %v", err)
+	}
+}
+
+func bootUnit(activating, activated uint64, after ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"InactiveExitTimestampMonotonic":  activating * 1000,
+		"ActiveEnterTimestampMonotonic":   activated * 1000,
+		"ActiveExitTimestampMonotonic":    uint64(0),
+		"InactiveEnterTimestampMonotonic": uint64(0),
+		"After":                           after,
+	}
+}
+
+func TestCriticalChain(t *testing.T) {
+	boot := &BootTimes{userspaceStart: time.Second, finish: 10 * time.Second}
+	units := map[string]map[string]interface{}{
+		"default.target": bootUnit(9000, 9000, "basic.target", "slow.service", "late.service"),
+		"slow.service":   bootUnit(2000, 8000, "basic.target"),
+		"fast.service":   bootUnit(2000, 8000, "basic.target"),
+		"late.service":   bootUnit(11000, 12000, "basic.target"),
+		"basic.target":   bootUnit(1500, 1500, "sysinit.target"),
+		"sysinit.target": bootUnit(1200, 1200, "never.service"),
+		"never.service":  bootUnit(0, 0),
+		"initrd.service": bootUnit(500, 800),
+	}
+	properties := func(ctx context.Context, unit string) (map[string]interface{}, error) {
+		return units[unit], nil
+	}
+
+	tm, err := boot.unitTime("slow.service", units["slow.service"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UnitTime{Name: "slow.service", Activating: time.Second, Activated: 7 * time.Second, Time: 6 * time.Second}
+	if tm != want {
+		t.Fatalf("Got %+v, want %+v", tm, want)
+	}
+	tm, err = boot.unitTime("initrd.service", units["initrd.service"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm.Activating != 500*time.Millisecond || tm.Time != 300*time.Millisecond {
+		t.Fatalf("Unexpected initrd unit time %+v", tm)
+	}
+
+	chain, err := criticalChain(context.Background(), boot, "default.target", 0, properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names func(c *CriticalChainUnit) []string
+	names = func(c *CriticalChainUnit) []string {
+		n := []string{c.Name}
+		for _, a := range c.After {
+			n = append(n, names(a)...)
+		}
+		return n
+	}
+	// late.service became active after the end of the boot, and
+	// never.service did not become active at all.
+	if got := names(chain); !reflect.DeepEqual(got, []string{"default.target", "slow.service", "basic.target", "sysinit.target"}) {
+		t.Fatalf("Unexpected critical chain %v", got)
+	}
+
+	units["default.target"] = bootUnit(9000, 9000, "slow.service", "fast.service")
+	chain, err = criticalChain(context.Background(), boot, "default.target", 0, properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.After) != 2 || chain.After[0].Name != "fast.service" || chain.After[1].Name != "slow.service" {
+		t.Fatalf("Expected two units activated at the same time, got %+v", chain.After)
+	}
+	// basic.target is reached through both, but only expanded once.
+	if len(chain.After[0].After) != 1 || len(chain.After[0].After[0].After) != 1 || len(chain.After[1].After[0].After) != 0 {
+		t.Fatalf("Unexpected critical chain %v", names(chain))
+	}
+}
+
+// TestBlame lists the units activated during boot on the running system.
+func TestBlame(t *testing.T) {
+	conn := setupConn(t)
+
+	times, err := conn.Blame()
+	if err == ErrBootNotFinished {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(times); i++ {
+		if times[i].Time > times[i-1].Time {
+			t.Fatalf("Units not sorted by time: %+v", times)
+		}
+	}
+
+	if _, err := conn.CriticalChain("", 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+)
+
+// batchJobMethods are the Manager methods enqueuing the job types accepted by
+// BatchUnitJobs.
+var batchJobMethods = map[string]string{
+	"start":                 "StartUnit",
+	"stop":                  "StopUnit",
+	"restart":               "RestartUnit",
+	"reload":                "ReloadUnit",
+	"try-restart":           "TryRestartUnit",
+	"reload-or-restart":     "ReloadOrRestartUnit",
+	"reload-or-try-restart": "ReloadOrTryRestartUnit",
+}
+
+// resultUnitTypes are the interfaces of the unit types which have a Result
+// property, by unit name suffix.
+var resultUnitTypes = map[string]string{
+	".service":   "org.freedesktop.systemd1.Service",
+	".socket":    "org.freedesktop.systemd1.Socket",
+	".mount":     "org.freedesktop.systemd1.Mount",
+	".swap":      "org.freedesktop.systemd1.Swap",
+	".timer":     "org.freedesktop.systemd1.Timer",
+	".path":      "org.freedesktop.systemd1.Path",
+	".automount": "org.freedesktop.systemd1.Automount",
+	".scope":     "org.freedesktop.systemd1.Scope",
+}
+
+// BatchOptions configures BatchUnitJobs.
+type BatchOptions struct {
+	// Mode is the job mode, as passed to StartUnit. Defaults to
+	// "replace".
+	Mode string
+	// Concurrency is how many jobs are enqueued and waited for at once.
+	// All jobs are enqueued at once if it is 0.
+	Concurrency int
+}
+
+// UnitResult is the outcome of a job enqueued by BatchUnitJobs.
+type UnitResult struct {
+	Name        string    // The unit name, as passed to BatchUnitJobs
+	JobID       int       // The numeric job id, 0 if the job was not enqueued
+	JobResult   JobResult // The job result, empty if Err is set
+	ActiveState string    // The unit's active state once the job completed
+	Result      string    // The unit's result once the job completed, empty if the unit type has none
+	Err         error     // Why the job could not be enqueued or waited for, or the unit's state fetched
+}
+
+// BatchUnitJobs enqueues a job of type jobType (start, stop, restart,
+// reload, try-restart, reload-or-restart or reload-or-try-restart) for each
+// of the units names, waits for them to complete and returns their results,
+// in the order of names. A failed job does not stop the others: the errors
+// are reported in the results. An error is only returned if jobType is not
+// known.
+func (c *Conn) BatchUnitJobs(jobType string, names []string, opts BatchOptions) ([]UnitResult, error) {
+	return c.BatchUnitJobsContext(context.Background(), jobType, names, opts)
+}
+
+// BatchUnitJobsContext is the same as BatchUnitJobs with a context. Once ctx
+// is done, no more jobs are enqueued, and the results of the jobs not waited
+// for yet hold ctx.Err(). The jobs already enqueued are not canceled.
+func (c *Conn) BatchUnitJobsContext(ctx context.Context, jobType string, names []string, opts BatchOptions) ([]UnitResult, error) {
+	method, ok := batchJobMethods[jobType]
+	if !ok {
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+	mode := opts.Mode
+	if mode == "" {
+		mode = "replace"
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = len(names)
+	}
+
+	results := make([]UnitResult, len(names))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+				wg.Add(1)
+				go func(i int, name string) {
+					defer wg.Done()
+					results[i] = c.runUnitJob(ctx, "org.freedesktop.systemd1.Manager."+method, name, mode)
+					<-sem
+				}(i, name)
+				continue
+			case <-ctx.Done():
+			}
+		}
+		results[i] = UnitResult{Name: name, Err: ctx.Err()}
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// runUnitJob enqueues a job for the unit name with method, waits for it to
+// complete and fetches the unit's resulting state.
+func (c *Conn) runUnitJob(ctx context.Context, method string, name string, mode string) UnitResult {
+	r := UnitResult{Name: name}
+
+	ch := make(chan string, 1)
+	id, err := c.startJob(ctx, ch, method, name, mode)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.JobID = id
+
+	result, err := c.WaitJobContext(ctx, id, ch)
+	if err == nil {
+		r.JobResult, err = jobResult(result)
+	}
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	prop, err := c.GetUnitPropertyContext(ctx, name, "ActiveState")
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.ActiveState, _ = prop.Value.Value().(string)
+
+	if iface, ok := resultUnitTypes[path.Ext(name)]; ok {
+		prop, err := c.getProperty(ctx, name, iface, "Result")
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		r.Result, _ = prop.Value.Value().(string)
+	}
+
+	return r
+}
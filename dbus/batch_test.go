@@ -0,0 +1,76 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBatchUnitJobs(t *testing.T) {
+	targets := []string{"start-stop.service", "enable-disable.service", "mask-unmask.service"}
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	for _, target := range targets {
+		if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.failUnit("enable-disable.service", "exit-code")
+
+	names := append(targets, "unexisting.service")
+	results, err := conn.BatchUnitJobs("restart", names, BatchOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(names) {
+		t.Fatalf("Unexpected results %+v", results)
+	}
+	for i, r := range results {
+		if r.Name != names[i] {
+			t.Fatalf("Result %d is for %s, expected %s", i, r.Name, names[i])
+		}
+	}
+
+	check := func(r UnitResult, job JobResult, active, result string) {
+		if r.Err != nil || r.JobID == 0 || r.JobResult != job || r.ActiveState != active || r.Result != result {
+			t.Errorf("Unexpected result %+v", r)
+		}
+	}
+	check(results[0], JobDone, "active", "success")
+	check(results[1], JobFailed, "failed", "exit-code")
+	check(results[2], JobDone, "active", "success")
+	if results[3].Err == nil || results[3].JobID != 0 {
+		t.Errorf("Expected an error restarting a missing unit, got %+v", results[3])
+	}
+
+	if _, err := conn.BatchUnitJobs("isolate", names, BatchOptions{}); err == nil {
+		t.Fatal("Expected an error for an unknown job type")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = conn.BatchUnitJobsContext(ctx, "stop", targets, BatchOptions{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			t.Errorf("Expected the context error, got %+v", r)
+		}
+	}
+}
@@ -16,6 +16,8 @@
 package dbus
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -51,7 +53,7 @@ func PathBusEscape(path string) string {
 	for i := 0; i < len(path); i++ {
 		c := path[i]
 		if needsEscape(i, c) {
-			e := fmt.Sprintf("_%x", c)
+			e := fmt.Sprintf("_%02x", c)
 			n = append(n, []byte(e)...)
 		} else {
 			n = append(n, c)
@@ -60,8 +62,51 @@ func PathBusEscape(path string) string {
 	return string(n)
 }
 
+// PathBusUnescape is the inverse of PathBusEscape. An error is returned if
+// path is not a valid escaped string: if it contains characters which are
+// always escaped, or an underscore which is not followed by two hexadecimal
+// digits.
+func PathBusUnescape(path string) (string, error) {
+	switch path {
+	case "_":
+		return "", nil
+	case "":
+		return "", errors.New("empty escaped string")
+	}
+	n := []byte{}
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '_' {
+			if i+2 >= len(path) {
+				return "", fmt.Errorf("truncated escape sequence in %q", path)
+			}
+			b, err := strconv.ParseUint(path[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape sequence %q in %q", path[i:i+3], path)
+			}
+			n = append(n, byte(b))
+			i += 2
+			continue
+		}
+		if needsEscape(i, c) {
+			return "", fmt.Errorf("invalid character %q in %q", c, path)
+		}
+		n = append(n, c)
+	}
+	return string(n), nil
+}
+
 // Conn is a connection to systemd's dbus endpoint.
 type Conn struct {
+	// dial establishes the connections, it is called again to reconnect
+	dial func() (*dbus.Conn, error)
+
+	// connMu guards sysconn, sigconn and state, as the connections are
+	// replaced when reconnecting, and interactive
+	connMu      sync.RWMutex
+	state       connState
+	interactive bool
+
 	// sysconn/sysobj are only used to call dbus methods
 	sysconn *dbus.Conn
 	sysobj  dbus.BusObject
@@ -78,16 +123,16 @@ type Conn struct {
 		updateCh chan<- *SubStateUpdate
 		errCh    chan<- error
 		sync.Mutex
-		ignore      map[dbus.ObjectPath]int64
-		cleanIgnore int64
 	}
+	units          unitCache
+	managerSignals managerSignals
 }
 
 // New establishes a connection to the system bus and authenticates.
 // Callers should call Close() when done with the connection.
 func New() (*Conn, error) {
 	return NewConnection(func() (*dbus.Conn, error) {
-		return dbusAuthHelloConnection(dbus.SystemBusPrivate)
+		return dbusAuthHelloConnection(systemBusPrivate)
 	})
 }
 
@@ -96,7 +141,7 @@ func New() (*Conn, error) {
 // Callers should call Close() when done with the connection.
 func NewUserConnection() (*Conn, error) {
 	return NewConnection(func() (*dbus.Conn, error) {
-		return dbusAuthHelloConnection(dbus.SessionBusPrivate)
+		return dbusAuthHelloConnection(sessionBusPrivate)
 	})
 }
 
@@ -107,15 +152,37 @@ func NewSystemdConnection() (*Conn, error) {
 	return NewConnection(func() (*dbus.Conn, error) {
 		// We skip Hello when talking directly to systemd.
 		return dbusAuthConnection(func() (*dbus.Conn, error) {
-			return dbus.Dial("unix:path=/run/systemd/private")
+			return dialUnixFD("unix:path=/run/systemd/private")
 		})
 	})
 }
 
 // Close closes an established connection
 func (c *Conn) Close() {
+	c.connMu.Lock()
+	if !c.state.closed {
+		c.state.closed = true
+		close(c.state.done)
+		if c.state.reconnect {
+			close(c.state.changes)
+		}
+	}
 	c.sysconn.Close()
 	c.sigconn.Close()
+	c.connMu.Unlock()
+
+	c.units.stop(errConnClosed)
+	c.managerSignals.stop(errConnClosed)
+}
+
+// SetInteractiveAuthorization sets whether systemd may prompt the user through
+// polkit to authorize method calls such as StartUnit. The setting survives
+// reconnects. Calls may then block on the prompt, so contexts passed to them
+// should allow for it.
+func (c *Conn) SetInteractiveAuthorization(allow bool) {
+	c.connMu.Lock()
+	c.interactive = allow
+	c.connMu.Unlock()
 }
 
 // NewConnection establishes a connection to a bus using a caller-supplied function.
@@ -136,34 +203,77 @@ func NewConnection(dialBus func() (*dbus.Conn, error)) (*Conn, error) {
 	}
 
 	c := &Conn{
+		dial:    dialBus,
 		sysconn: sysconn,
-		sysobj:  systemdObject(sysconn),
 		sigconn: sigconn,
-		sigobj:  systemdObject(sigconn),
 	}
+	c.sysobj = c.object("/org/freedesktop/systemd1")
+	c.sigobj = &connObject{conn: c, sig: true, path: "/org/freedesktop/systemd1"}
+	c.state.done = make(chan struct{})
 
-	c.subscriber.ignore = make(map[dbus.ObjectPath]int64)
 	c.jobListener.jobs = make(map[dbus.ObjectPath]chan<- string)
 
 	// Setup the listeners on jobs so that we can get completions
-	c.sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
-		"type='signal', interface='org.freedesktop.systemd1.Manager', member='JobRemoved'")
+	c.addMatch(jobRemovedMatch)
 
 	c.dispatch()
 	return c, nil
 }
 
+const jobRemovedMatch = "type='signal', interface='org.freedesktop.systemd1.Manager', member='JobRemoved'"
+
+// addMatch adds a match rule for the signals received on sigconn. The rule
+// is added again when reconnecting.
+func (c *Conn) addMatch(rule string) error {
+	c.connMu.Lock()
+	if c.state.matches == nil {
+		c.state.matches = make(map[string]struct{})
+	}
+	c.state.matches[rule] = struct{}{}
+	bus := c.sigconn.BusObject()
+	c.connMu.Unlock()
+	return wrapError(bus.Call("org.freedesktop.DBus.AddMatch", 0, rule).Err)
+}
+
+// object returns the systemd object at path.
+func (c *Conn) object(path dbus.ObjectPath) dbus.BusObject {
+	return &connObject{conn: c, path: path}
+}
+
 // GetManagerProperty returns the value of a property on the org.freedesktop.systemd1.Manager
 // interface. The value is returned in its string representation, as defined at
-// https://developer.gnome.org/glib/unstable/gvariant-text.html
+// https://developer.gnome.org/glib/unstable/gvariant-text.html, which
+// ParseGVariant parses. See GetManagerProperties for the common properties.
 func (c *Conn) GetManagerProperty(prop string) (string, error) {
-	variant, err := c.sysobj.GetProperty("org.freedesktop.systemd1.Manager." + prop)
+	return c.GetManagerPropertyContext(context.Background(), prop)
+}
+
+// GetManagerPropertyContext is the same as GetManagerProperty with a context.
+func (c *Conn) GetManagerPropertyContext(ctx context.Context, prop string) (string, error) {
+	var variant dbus.Variant
+	err := callContext(ctx, c.sysobj, "org.freedesktop.DBus.Properties.Get", "org.freedesktop.systemd1.Manager", prop).Store(&variant)
 	if err != nil {
 		return "", err
 	}
 	return variant.String(), nil
 }
 
+// getManagerProperties returns all properties of the
+// org.freedesktop.systemd1.Manager interface.
+func (c *Conn) getManagerProperties(ctx context.Context) (map[string]interface{}, error) {
+	var props map[string]dbus.Variant
+	err := callContext(ctx, c.sysobj, "org.freedesktop.DBus.Properties.GetAll", "org.freedesktop.systemd1.Manager").Store(&props)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		out[k] = v.Value()
+	}
+	return out, nil
+}
+
 func dbusAuthConnection(createBus func() (*dbus.Conn, error)) (*dbus.Conn, error) {
 	conn, err := createBus()
 	if err != nil {
@@ -197,7 +307,3 @@ func dbusAuthHelloConnection(createBus func() (*dbus.Conn, error)) (*dbus.Conn,
 
 	return conn, nil
 }
-
-func systemdObject(conn *dbus.Conn) dbus.BusObject {
-	return conn.Object("org.freedesktop.systemd1", dbus.ObjectPath("/org/freedesktop/systemd1"))
-}
@@ -16,6 +16,8 @@ package dbus
 
 import (
 	"testing"
+
+	"github.com/godbus/dbus"
 )
 
 func TestNeedsEscape(t *testing.T) {
@@ -63,12 +65,56 @@ func TestPathBusEscape(t *testing.T) {
 		if got != want {
 			t.Errorf("bad result for PathBusEscape(%s): got %q, want %q", in, got, want)
 		}
+		if back, err := PathBusUnescape(got); err != nil || back != in {
+			t.Errorf("bad result for PathBusUnescape(%s): got %q, %v, want %q", got, back, err, in)
+		}
 	}
 
 }
 
+func TestPathBusUnescapeInvalid(t *testing.T) {
+	for _, in := range []string{
+		"foo_2",
+		"foo_",
+		"foo_zzservice",
+		"foo.service",
+		"0foo",
+		"",
+	} {
+		if got, err := PathBusUnescape(in); err == nil {
+			t.Errorf("PathBusUnescape(%q) returned %q, want an error", in, got)
+		}
+	}
+}
+
+func TestUnitNameFromPath(t *testing.T) {
+	for _, name := range []string{"foo.service", "woof@woof.service", "-.mount", "0123.socket"} {
+		got, err := UnitNameFromPath(UnitPath(name))
+		if err != nil || got != name {
+			t.Errorf("UnitNameFromPath(%s) returned %q, %v, want %q", UnitPath(name), got, err, name)
+		}
+	}
+
+	for _, p := range []dbus.ObjectPath{"/org/freedesktop/systemd1/job/1", "/org/freedesktop/systemd1/unit/foo_2"} {
+		if got, err := UnitNameFromPath(p); err == nil {
+			t.Errorf("UnitNameFromPath(%s) returned %q, want an error", p, got)
+		}
+	}
+
+	if id, err := JobIDFromPath(jobPath(42)); err != nil || id != 42 {
+		t.Errorf("JobIDFromPath(%s) returned %d, %v, want 42", jobPath(42), id, err)
+	}
+	for _, p := range []dbus.ObjectPath{"/org/freedesktop/systemd1/unit/foo_2eservice", "/org/freedesktop/systemd1/job/", "/org/freedesktop/systemd1/job/x"} {
+		if id, err := JobIDFromPath(p); err == nil {
+			t.Errorf("JobIDFromPath(%s) returned %d, want an error", p, id)
+		}
+	}
+}
+
 // TestNew ensures that New() works without errors.
 func TestNew(t *testing.T) {
+	requireSystemd(t)
+
 	_, err := New()
 
 	if err != nil {
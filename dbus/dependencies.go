@@ -0,0 +1,214 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// reverseDependencies maps the dependency properties of units to their
+// reverse property.
+var reverseDependencies = map[string]string{
+	"Requires":           "RequiredBy",
+	"Requisite":          "RequisiteOf",
+	"Wants":              "WantedBy",
+	"BindsTo":            "BoundBy",
+	"PartOf":             "ConsistsOf",
+	"Before":             "After",
+	"Conflicts":          "ConflictedBy",
+	"Triggers":           "TriggeredBy",
+	"OnFailure":          "OnFailureOf",
+	"PropagatesReloadTo": "ReloadPropagatedFrom",
+}
+
+func init() {
+	for p, r := range reverseDependencies {
+		if _, ok := reverseDependencies[r]; !ok {
+			reverseDependencies[r] = p
+		}
+	}
+}
+
+// ListDependencyTypes are the dependencies followed by default, the same as
+// the ones shown by 'systemctl list-dependencies'.
+var ListDependencyTypes = []string{"Requires", "Requisite", "Wants", "ConsistsOf", "BindsTo"}
+
+// DependencyWalkOptions configures GetDependencyGraph.
+type DependencyWalkOptions struct {
+	// Types are the dependency properties to follow, e.g. "Requires",
+	// "After" or "ConsistsOf". Defaults to ListDependencyTypes.
+	Types []string
+	// Reverse walks the units depending on the root unit instead, by
+	// following the reverse property of each type, e.g. RequiredBy for
+	// Requires.
+	Reverse bool
+	// MaxDepth limits the walk to units at most MaxDepth dependencies away
+	// from the root unit. 0 means no limit.
+	MaxDepth int
+}
+
+// DependencyEdge is a dependency between two units: From has a dependency of
+// type Type on To, e.g. From Requires To. Edges found in reverse walks are
+// stored the same way.
+type DependencyEdge struct {
+	From string // The unit having the dependency
+	To   string // The unit depended on
+	Type string // The dependency property of From, e.g. Requires
+}
+
+// DependencyGraph is the graph of dependencies reachable from a root unit.
+type DependencyGraph struct {
+	Root    string         // The unit the walk started at
+	Reverse bool           // Whether the graph has been walked in reverse
+	Units   map[string]int // The units reached, mapped to their distance from the root unit
+	Edges   []DependencyEdge
+}
+
+// GetDependencyGraph walks the dependencies of a unit over D-Bus and returns
+// the resulting graph, like 'systemctl list-dependencies'. Each unit's
+// dependencies are taken from its properties, see GetUnitProperties.
+func (c *Conn) GetDependencyGraph(root string, opts DependencyWalkOptions) (*DependencyGraph, error) {
+	return c.GetDependencyGraphContext(context.Background(), root, opts)
+}
+
+// GetDependencyGraphContext is the same as GetDependencyGraph with a context.
+func (c *Conn) GetDependencyGraphContext(ctx context.Context, root string, opts DependencyWalkOptions) (*DependencyGraph, error) {
+	return walkDependencies(ctx, root, opts, func(ctx context.Context, unit string) (map[string]interface{}, error) {
+		return c.getProperties(ctx, unit, "org.freedesktop.systemd1.Unit")
+	})
+}
+
+func walkDependencies(ctx context.Context, root string, opts DependencyWalkOptions, properties func(context.Context, string) (map[string]interface{}, error)) (*DependencyGraph, error) {
+	types := opts.Types
+	if types == nil {
+		types = ListDependencyTypes
+	}
+
+	g := &DependencyGraph{
+		Root:    root,
+		Reverse: opts.Reverse,
+		Units:   map[string]int{root: 0},
+	}
+	edges := make(map[DependencyEdge]bool)
+
+	queue := []string{root}
+	for len(queue) > 0 {
+		unit := queue[0]
+		queue = queue[1:]
+		depth := g.Units[unit]
+		if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			continue
+		}
+
+		props, err := properties(ctx, unit)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range types {
+			prop := t
+			if opts.Reverse {
+				r, ok := reverseDependencies[t]
+				if !ok {
+					return nil, fmt.Errorf("no reverse dependency for %s", t)
+				}
+				prop = r
+			}
+
+			deps, _ := props[prop].([]string)
+			for _, dep := range deps {
+				e := DependencyEdge{From: unit, To: dep, Type: t}
+				if opts.Reverse {
+					e = DependencyEdge{From: dep, To: unit, Type: t}
+				}
+				if !edges[e] {
+					edges[e] = true
+					g.Edges = append(g.Edges, e)
+				}
+
+				if _, ok := g.Units[dep]; !ok {
+					g.Units[dep] = depth + 1
+					queue = append(queue, dep)
+				}
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// Next returns the units reached from unit in the direction of the walk,
+// sorted by name. For a forward walk these are the units unit depends on, for
+// a reverse walk the units depending on unit.
+func (g *DependencyGraph) Next(unit string) []string {
+	seen := make(map[string]bool)
+	var next []string
+	for _, e := range g.Edges {
+		from, to := e.From, e.To
+		if g.Reverse {
+			from, to = to, from
+		}
+		if from == unit && !seen[to] {
+			seen[to] = true
+			next = append(next, to)
+		}
+	}
+	sort.Strings(next)
+	return next
+}
+
+// dotColors are the colors of the edges written by WriteDOT, the same as the
+// ones used by 'systemd-analyze dot'.
+var dotColors = map[string]string{
+	"Requires":  "black",
+	"Requisite": "darkblue",
+	"Wants":     "grey66",
+	"Conflicts": "red",
+	"After":     "green",
+	"Before":    "green",
+}
+
+// WriteDOT writes the graph in the DOT language of graphviz, like
+// 'systemd-analyze dot'.
+func (g *DependencyGraph) WriteDOT(w io.Writer) error {
+	edges := make([]DependencyEdge, len(g.Edges))
+	copy(edges, g.Edges)
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Type < b.Type
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph systemd {")
+	for _, e := range edges {
+		color, ok := dotColors[e.Type]
+		if !ok {
+			color = "black"
+		}
+		fmt.Fprintf(bw, "\t%q->%q [color=%q label=%q];\n", e.From, e.To, color, e.Type)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,124 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+var testDependencies = map[string]map[string]interface{}{
+	"multi-user.target": {
+		"Requires": []string{"basic.target"},
+		"Wants":    []string{"foo.service", "bar.service"},
+	},
+	"basic.target": {
+		"RequiredBy": []string{"multi-user.target"},
+		"Wants":      []string{"foo.service"},
+	},
+	"foo.service": {
+		"WantedBy": []string{"multi-user.target", "basic.target"},
+	},
+	"bar.service": {
+		"WantedBy": []string{"multi-user.target"},
+		"Requires": []string{"baz.socket"},
+	},
+	"baz.socket": {
+		"RequiredBy": []string{"bar.service"},
+	},
+}
+
+func testProperties(ctx context.Context, unit string) (map[string]interface{}, error) {
+	return testDependencies[unit], nil
+}
+
+func TestWalkDependencies(t *testing.T) {
+	g, err := walkDependencies(context.Background(), "multi-user.target", DependencyWalkOptions{}, testProperties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantUnits := map[string]int{
+		"multi-user.target": 0,
+		"basic.target":      1,
+		"foo.service":       1,
+		"bar.service":       1,
+		"baz.socket":        2,
+	}
+	if !reflect.DeepEqual(g.Units, wantUnits) {
+		t.Fatalf("Got units %v, want %v", g.Units, wantUnits)
+	}
+	if next := g.Next("multi-user.target"); !reflect.DeepEqual(next, []string{"bar.service", "basic.target", "foo.service"}) {
+		t.Fatalf("Unexpected dependencies of multi-user.target %v", next)
+	}
+	if len(g.Edges) != 5 {
+		t.Fatalf("Unexpected edges %v", g.Edges)
+	}
+
+	g, err = walkDependencies(context.Background(), "multi-user.target", DependencyWalkOptions{MaxDepth: 1}, testProperties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.Units["baz.socket"]; ok || len(g.Units) != 4 {
+		t.Fatalf("Depth limit exceeded: %v", g.Units)
+	}
+}
+
+func TestWalkDependenciesReverse(t *testing.T) {
+	g, err := walkDependencies(context.Background(), "foo.service", DependencyWalkOptions{Reverse: true, Types: []string{"Requires", "Wants"}}, testProperties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(g.Units) != 3 {
+		t.Fatalf("Unexpected units %v", g.Units)
+	}
+	if next := g.Next("foo.service"); !reflect.DeepEqual(next, []string{"basic.target", "multi-user.target"}) {
+		t.Fatalf("Unexpected reverse dependencies of foo.service %v", next)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph systemd {
+	"basic.target"->"foo.service" [color="grey66" label="Wants"];
+	"multi-user.target"->"basic.target" [color="black" label="Requires"];
+	"multi-user.target"->"foo.service" [color="grey66" label="Wants"];
+}
+`
+	if buf.String() != want {
+		t.Fatalf("Got DOT\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	if _, err := walkDependencies(context.Background(), "foo.service", DependencyWalkOptions{Reverse: true, Types: []string{"Foo"}}, testProperties); err == nil {
+		t.Fatal("Expected an error for an unknown dependency type")
+	}
+}
+
+// TestGetDependencyGraph walks the dependencies of the default target.
+func TestGetDependencyGraph(t *testing.T) {
+	conn := setupConn(t)
+
+	g, err := conn.GetDependencyGraph("default.target", DependencyWalkOptions{MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Units) < 2 || len(g.Edges) == 0 {
+		t.Fatalf("Unexpected graph %+v", g)
+	}
+}
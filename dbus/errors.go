@@ -0,0 +1,81 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"github.com/coreos/go-systemd/internal/dbusutil"
+)
+
+// Error is an error reply of systemd or the bus to a method call. The errors
+// returned by Conn's methods for such replies are of type *Error, and wrap
+// the original dbus.Error. They match the sentinel error with the same name
+// under errors.Is, e.g.:
+//
+//	if errors.Is(err, dbus.ErrNoSuchUnit) { ... }
+//
+// Use errors.As to get the name of errors without a sentinel. The login1 and
+// machine1 packages return the same type, so their errors match the bus
+// sentinels of this package too.
+type Error = dbusutil.Error
+
+// The errors returned by systemd, see
+// https://github.com/systemd/systemd/blob/main/src/libsystemd/sd-bus/bus-common-errors.h
+var (
+	ErrNoSuchUnit                 = &Error{Name: "org.freedesktop.systemd1.NoSuchUnit"}
+	ErrNoUnitForPID               = &Error{Name: "org.freedesktop.systemd1.NoUnitForPID"}
+	ErrNoUnitForInvocationID      = &Error{Name: "org.freedesktop.systemd1.NoUnitForInvocationID"}
+	ErrUnitExists                 = &Error{Name: "org.freedesktop.systemd1.UnitExists"}
+	ErrLoadFailed                 = &Error{Name: "org.freedesktop.systemd1.LoadFailed"}
+	ErrBadUnitSetting             = &Error{Name: "org.freedesktop.systemd1.BadUnitSetting"}
+	ErrJobFailed                  = &Error{Name: "org.freedesktop.systemd1.JobFailed"}
+	ErrNoSuchJob                  = &Error{Name: "org.freedesktop.systemd1.NoSuchJob"}
+	ErrNotSubscribed              = &Error{Name: "org.freedesktop.systemd1.NotSubscribed"}
+	ErrAlreadySubscribed          = &Error{Name: "org.freedesktop.systemd1.AlreadySubscribed"}
+	ErrOnlyByDependency           = &Error{Name: "org.freedesktop.systemd1.OnlyByDependency"}
+	ErrTransactionJobsConflicting = &Error{Name: "org.freedesktop.systemd1.TransactionJobsConflicting"}
+	ErrTransactionOrderIsCyclic   = &Error{Name: "org.freedesktop.systemd1.TransactionOrderIsCyclic"}
+	ErrTransactionIsDestructive   = &Error{Name: "org.freedesktop.systemd1.TransactionIsDestructive"}
+	ErrUnitMasked                 = &Error{Name: "org.freedesktop.systemd1.UnitMasked"}
+	ErrUnitGenerated              = &Error{Name: "org.freedesktop.systemd1.UnitGenerated"}
+	ErrUnitLinked                 = &Error{Name: "org.freedesktop.systemd1.UnitLinked"}
+	ErrUnitBad                    = &Error{Name: "org.freedesktop.systemd1.UnitBad"}
+	ErrUnitInactive               = &Error{Name: "org.freedesktop.systemd1.UnitInactive"}
+	ErrJobTypeNotApplicable       = &Error{Name: "org.freedesktop.systemd1.JobTypeNotApplicable"}
+	ErrNoIsolation                = &Error{Name: "org.freedesktop.systemd1.NoIsolation"}
+	ErrShuttingDown               = &Error{Name: "org.freedesktop.systemd1.ShuttingDown"}
+	ErrScopeNotRunning            = &Error{Name: "org.freedesktop.systemd1.ScopeNotRunning"}
+	ErrNoSuchDynamicUser          = &Error{Name: "org.freedesktop.systemd1.NoSuchDynamicUser"}
+	ErrNotReferenced              = &Error{Name: "org.freedesktop.systemd1.NotReferenced"}
+	ErrDiskFull                   = &Error{Name: "org.freedesktop.systemd1.DiskFull"}
+)
+
+// The errors returned by the bus, see
+// https://dbus.freedesktop.org/doc/dbus-specification.html
+var (
+	ErrAccessDenied                     = dbusutil.ErrAccessDenied
+	ErrInteractiveAuthorizationRequired = dbusutil.ErrInteractiveAuthorizationRequired
+	ErrInvalidArgs                      = dbusutil.ErrInvalidArgs
+	ErrNoReply                          = dbusutil.ErrNoReply
+	ErrNotSupported                     = dbusutil.ErrNotSupported
+	ErrServiceUnknown                   = dbusutil.ErrServiceUnknown
+	ErrUnknownMethod                    = dbusutil.ErrUnknownMethod
+	ErrUnknownObject                    = dbusutil.ErrUnknownObject
+	ErrUnknownProperty                  = dbusutil.ErrUnknownProperty
+)
+
+// wrapError returns err as an *Error if it is an error reply.
+func wrapError(err error) error {
+	return dbusutil.WrapError(err)
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+func TestErrors(t *testing.T) {
+	target := "mask-unmask.service"
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	_, err := conn.StartUnit("unexisting.service", "replace", nil)
+	if !errors.Is(err, ErrNoSuchUnit) || errors.Is(err, ErrNoSuchJob) {
+		t.Fatalf("Expected ErrNoSuchUnit, got %v", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Name != "org.freedesktop.systemd1.NoSuchUnit" || e.Message != "Unit unexisting.service not found." {
+		t.Fatalf("Unexpected error %#v", err)
+	}
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) || dbusErr.Name != e.Name {
+		t.Fatalf("Original error not wrapped: %#v", err)
+	}
+	if err.Error() != "Unit unexisting.service not found." {
+		t.Fatalf("Unexpected message %q", err.Error())
+	}
+
+	if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.MaskUnitFiles([]string{target}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.StartUnit(target, "replace", nil); !errors.Is(err, ErrUnitMasked) {
+		t.Fatalf("Expected ErrUnitMasked, got %v", err)
+	}
+
+	f.mu.Lock()
+	f.polkit = true
+	f.mu.Unlock()
+	if _, err := conn.GetManagerProperty("Version"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Reload(); !errors.Is(err, ErrInteractiveAuthorizationRequired) {
+		t.Fatalf("Expected ErrInteractiveAuthorizationRequired, got %v", err)
+	}
+}
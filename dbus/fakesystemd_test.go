@@ -0,0 +1,1295 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// fakeSystemd is an in-process stand-in for the org.freedesktop.systemd1
+// service, for tests which don't require a running systemd or root. It speaks
+// the D-Bus wire protocol on peer-to-peer connections, like systemd's private
+// socket, and models units, jobs and unit files as well as the signals systemd
+// sends about them. Jobs complete right after they have been enqueued.
+type fakeSystemd struct {
+	mu            sync.Mutex
+	conns         map[*fakeSystemdConn]struct{}
+	units         map[string]*fakeUnit
+	files         map[string]*fakeUnitFile
+	env           []string
+	defaultTarget string
+	nextJob       uint32
+	clock         uint64 // The fake CLOCK_MONOTONIC, in microseconds
+	boot          time.Time
+	// down makes dialing fail, see stop.
+	down bool
+	// polkit makes the Manager's methods fail unless they allow
+	// interactive authorization, as if polkit had to ask the user.
+	polkit bool
+	// pids are the units of the processes moved into transient units,
+	// by PID.
+	pids map[uint32]string
+	// sockets makes dial return connections over unix sockets, which
+	// pass file descriptors, rather than pipes. godbus delivers each
+	// signal from its own goroutine, so signals arriving faster than
+	// through a pipe may be reordered.
+	sockets bool
+}
+
+type fakeUnit struct {
+	name      string
+	props     map[string]dbus.Variant
+	job       *fakeJob
+	transient bool
+	builtin   bool
+	// failStart makes start jobs fail with the given service result.
+	failStart string
+	// ignoreTerm makes the unit's processes ignore SIGTERM.
+	ignoreTerm bool
+}
+
+type fakeJob struct {
+	id   uint32
+	unit string
+	typ  string
+}
+
+type fakeUnitFile struct {
+	path   string // The unit file, or the target of its symlink
+	state  string
+	masked bool
+}
+
+type fakeSystemdConn struct {
+	mu sync.Mutex
+	rw io.ReadWriteCloser
+	// bridge makes the connection behave like systemd-stdio-bridge,
+	// which only accepts anonymous clients and answers Hello.
+	bridge bool
+	// serial numbers the messages sent by the server.
+	serial uint32
+}
+
+// fakeBuiltinUnits are the units known to fakeSystemd from the start.
+var fakeBuiltinUnits = []struct {
+	name, active, sub string
+	deps              map[string][]string
+}{
+	{"-.mount", "active", "mounted", nil},
+	{"sysinit.target", "active", "active", map[string][]string{"Wants": {"systemd-journald.service"}, "After": {"-.mount"}}},
+	{"basic.target", "active", "active", map[string][]string{"Requires": {"sysinit.target"}, "After": {"sysinit.target"}}},
+	{"multi-user.target", "active", "active", map[string][]string{"Requires": {"basic.target"}, "After": {"basic.target", "systemd-journald.service"}}},
+	{"systemd-journald.service", "active", "running", map[string][]string{"After": {"-.mount"}}},
+}
+
+func newFakeSystemd() *fakeSystemd {
+	f := &fakeSystemd{
+		conns:         make(map[*fakeSystemdConn]struct{}),
+		units:         make(map[string]*fakeUnit),
+		files:         make(map[string]*fakeUnitFile),
+		pids:          make(map[uint32]string),
+		defaultTarget: "multi-user.target",
+		clock:         1000000,
+		boot:          time.Now(),
+	}
+
+	for _, b := range fakeBuiltinUnits {
+		f.files[b.name] = &fakeUnitFile{path: "/lib/systemd/system/" + b.name, state: "static"}
+		u := f.newUnit(b.name)
+		u.builtin = true
+		f.setState(u, b.active, b.sub)
+	}
+	for _, b := range fakeBuiltinUnits {
+		for dep, units := range b.deps {
+			f.addDependencies(b.name, dep, units...)
+			for _, d := range units {
+				f.addDependencies(d, reverseDependencies[dep], b.name)
+			}
+		}
+	}
+	f.units["default.target"] = f.units["multi-user.target"]
+	f.clock = 5000000
+	return f
+}
+
+func (f *fakeSystemd) addDependencies(unit, dep string, units ...string) {
+	u := f.units[unit]
+	deps, _ := u.props[dep].Value().([]string)
+	u.props[dep] = dbus.MakeVariant(append(deps, units...))
+}
+
+// newConn returns a Conn connected to f.
+func (f *fakeSystemd) newConn(t *testing.T) *Conn {
+	conn, err := NewConnection(func() (*dbus.Conn, error) {
+		return dbusAuthConnection(f.dial)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// dial returns a new unauthenticated peer-to-peer connection to f.
+func (f *fakeSystemd) dial() (*dbus.Conn, error) {
+	f.mu.Lock()
+	down, sockets := f.down, f.sockets
+	f.mu.Unlock()
+	if down {
+		return nil, errFakeDown
+	}
+
+	if !sockets {
+		client, server := net.Pipe()
+		go f.serve(&fakeSystemdConn{rw: server})
+		return dbus.NewConn(client)
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	client, err := fileUnixConn(fds[0])
+	if err != nil {
+		syscall.Close(fds[1])
+		return nil, err
+	}
+	server, err := fileUnixConn(fds[1])
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	go f.serve(&fakeSystemdConn{rw: &fakeSocket{UnixConn: server}})
+	return newUnixFDConn(client)
+}
+
+// fileUnixConn returns the unix socket fd as a *net.UnixConn.
+func fileUnixConn(fd int) (*net.UnixConn, error) {
+	file := os.NewFile(uintptr(fd), "")
+	defer file.Close()
+	c, err := net.FileConn(file)
+	if err != nil {
+		return nil, err
+	}
+	return c.(*net.UnixConn), nil
+}
+
+// fakeSocket is the server side of a connection, which keeps the file
+// descriptors received along with the messages.
+type fakeSocket struct {
+	*net.UnixConn
+	fds []int
+}
+
+func (s *fakeSocket) Read(b []byte) (int, error) {
+	oob := make([]byte, syscall.CmsgSpace(16*4))
+	n, oobn, _, _, err := s.ReadMsgUnix(b, oob)
+	if err != nil {
+		return 0, err
+	}
+	msgs, _ := syscall.ParseSocketControlMessage(oob[:oobn])
+	for _, m := range msgs {
+		fds, _ := syscall.ParseUnixRights(&m)
+		s.fds = append(s.fds, fds...)
+	}
+	return n, nil
+}
+
+// takeFDs returns the first n file descriptors received and not taken yet.
+func (s *fakeSocket) takeFDs(n int) []int {
+	if n > len(s.fds) {
+		n = len(s.fds)
+	}
+	fds := s.fds[:n]
+	s.fds = s.fds[n:]
+	return fds
+}
+
+// fakeUnixFDs replaces the dbus.UnixFDIndex values of v, in arrays, structs
+// and variants, by the file descriptors in fds they refer to.
+func fakeUnixFDs(v interface{}, fds []int) interface{} {
+	switch v := v.(type) {
+	case dbus.Variant:
+		if i, ok := v.Value().(dbus.UnixFDIndex); ok && int(i) < len(fds) {
+			return dbus.MakeVariant(dbus.UnixFD(fds[i]))
+		}
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = fakeUnixFDs(v[i], fds)
+		}
+		return out
+	case [][]interface{}:
+		out := make([][]interface{}, len(v))
+		for i := range v {
+			out[i] = fakeUnixFDs(v[i], fds).([]interface{})
+		}
+		return out
+	}
+	return v
+}
+
+// openBridge returns a new stream to f behaving like systemd-stdio-bridge.
+func (f *fakeSystemd) openBridge() (io.ReadWriteCloser, error) {
+	client, server := net.Pipe()
+	go f.serve(&fakeSystemdConn{rw: server, bridge: true})
+	return client, nil
+}
+
+var errFakeDown = errors.New("fake systemd is down")
+
+// stop drops all connections and refuses new ones until start is called,
+// like systemd re-executing.
+func (f *fakeSystemd) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = true
+	for c := range f.conns {
+		c.rw.Close()
+	}
+}
+
+// start accepts connections again after stop.
+func (f *fakeSystemd) start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = false
+}
+
+func (f *fakeSystemd) serve(c *fakeSystemdConn) {
+	defer c.rw.Close()
+
+	r := bufio.NewReader(c.rw)
+	if err := serverAuth(r, c.rw, c.bridge); err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	f.conns[c] = struct{}{}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, c)
+		f.mu.Unlock()
+	}()
+
+	for {
+		msg, err := dbus.DecodeMessage(r)
+		if err != nil {
+			return
+		}
+		if n, ok := msg.Headers[dbus.FieldUnixFDs].Value().(uint32); ok {
+			if sock, ok := c.rw.(*fakeSocket); ok {
+				msg.Body = fakeUnixFDs(msg.Body, sock.takeFDs(int(n))).([]interface{})
+			}
+		}
+		if msg.Type != dbus.TypeMethodCall {
+			continue
+		}
+		f.handleCall(c, msg)
+	}
+}
+
+// serverAuth runs the server side of the authentication, accepting any
+// EXTERNAL credentials, or only ANONYMOUS ones if anonymous is set, and unix
+// file descriptors.
+func serverAuth(r *bufio.Reader, w io.Writer, anonymous bool) error {
+	if b, err := r.ReadByte(); err != nil || b != 0 {
+		return fmt.Errorf("missing nul byte")
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+
+		var reply string
+		switch {
+		case line == "BEGIN":
+			return nil
+		case strings.HasPrefix(line, "AUTH EXTERNAL") && !anonymous,
+			strings.HasPrefix(line, "AUTH ANONYMOUS") && anonymous:
+			reply = "OK 0123456789abcdef0123456789abcdef"
+		case line == "NEGOTIATE_UNIX_FD":
+			reply = "AGREE_UNIX_FD"
+		case strings.HasPrefix(line, "AUTH"):
+			reply = "REJECTED EXTERNAL ANONYMOUS"
+		default:
+			reply = "ERROR"
+		}
+		if _, err := io.WriteString(w, reply+"\r\n"); err != nil {
+			return err
+		}
+	}
+}
+
+// send writes msg to the connection. godbus has no way to set the serial of
+// a message, so it is patched into the encoded header.
+func (c *fakeSystemdConn) send(msg *dbus.Message) error {
+	if len(msg.Body) > 0 {
+		msg.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(msg.Body...))
+	}
+
+	var buf bytes.Buffer
+	if err := msg.EncodeTo(&buf, binary.LittleEndian); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serial++
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint32(b[8:12], c.serial)
+	_, err := c.rw.Write(b)
+	return err
+}
+
+type fakeError struct {
+	name    string
+	message string
+}
+
+func (e *fakeError) Error() string {
+	return e.name + ": " + e.message
+}
+
+func fakeErrorf(name string, format string, args ...interface{}) *fakeError {
+	return &fakeError{name, fmt.Sprintf(format, args...)}
+}
+
+var errFakeInvalidArgs = fakeErrorf("org.freedesktop.DBus.Error.InvalidArgs", "Invalid arguments")
+
+func (f *fakeSystemd) handleCall(c *fakeSystemdConn, msg *dbus.Message) {
+	p, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	iface, _ := msg.Headers[dbus.FieldInterface].Value().(string)
+	member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var after []func()
+	var body []interface{}
+	var err *fakeError
+	switch {
+	case iface == "org.freedesktop.DBus" && member == "Hello" && c.bridge:
+		body = []interface{}{":1.1"}
+	case iface == "org.freedesktop.DBus":
+		// AddMatch, RemoveMatch and the like; signals are sent to all
+		// connections.
+	case iface == "org.freedesktop.DBus.Properties":
+		body, err = f.properties(p, member, msg.Body)
+	case iface == "org.freedesktop.systemd1.Manager" && f.polkit && msg.Flags&dbus.FlagAllowInteractiveAuthorization == 0:
+		err = fakeErrorf("org.freedesktop.DBus.Error.InteractiveAuthorizationRequired", "Interactive authentication required.")
+	case iface == "org.freedesktop.systemd1.Manager" && p == "/org/freedesktop/systemd1":
+		body, after, err = f.manager(member, msg.Body)
+	case iface == "org.freedesktop.systemd1.Unit" && member == "Unref":
+		name, _ := UnitNameFromPath(p)
+		if u := f.units[name]; u != nil {
+			delete(u.props, "AddRef")
+			f.gc(u)
+		}
+	default:
+		err = fakeErrorf("org.freedesktop.DBus.Error.UnknownMethod", "Unknown method %s.%s", iface, member)
+	}
+
+	reply := &dbus.Message{
+		Type:    dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial())},
+		Body:    body,
+	}
+	if err != nil {
+		reply.Type = dbus.TypeError
+		reply.Headers[dbus.FieldErrorName] = dbus.MakeVariant(err.name)
+		reply.Body = []interface{}{err.message}
+	}
+	if msg.Flags&dbus.FlagNoReplyExpected == 0 {
+		c.send(reply)
+	}
+
+	for _, a := range after {
+		a()
+	}
+}
+
+// emit sends a signal to all connections.
+func (f *fakeSystemd) emit(p dbus.ObjectPath, iface, member string, values ...interface{}) {
+	for c := range f.conns {
+		c.send(&dbus.Message{
+			Type: dbus.TypeSignal,
+			Headers: map[dbus.HeaderField]dbus.Variant{
+				dbus.FieldPath:      dbus.MakeVariant(p),
+				dbus.FieldInterface: dbus.MakeVariant(iface),
+				dbus.FieldMember:    dbus.MakeVariant(member),
+			},
+			Body: values,
+		})
+	}
+}
+
+func (f *fakeSystemd) properties(p dbus.ObjectPath, member string, args []interface{}) ([]interface{}, *fakeError) {
+	var props map[string]dbus.Variant
+	switch {
+	case p == "/org/freedesktop/systemd1":
+		props = f.managerProperties()
+	case strings.HasPrefix(string(p), "/org/freedesktop/systemd1/unit/"):
+		name, _ := UnitNameFromPath(p)
+		props = f.load(name).props
+	default:
+		return nil, fakeErrorf("org.freedesktop.DBus.Error.UnknownObject", "Unknown object '%s'.", p)
+	}
+
+	switch member {
+	case "GetAll":
+		// All interfaces share the same set of properties.
+		return []interface{}{props}, nil
+	case "Get":
+		var iface, name string
+		if dbus.Store(args, &iface, &name) != nil {
+			return nil, errFakeInvalidArgs
+		}
+		v, ok := props[name]
+		if !ok {
+			return nil, fakeErrorf("org.freedesktop.DBus.Error.UnknownProperty", "Unknown property %s", name)
+		}
+		return []interface{}{v}, nil
+	}
+	return nil, fakeErrorf("org.freedesktop.DBus.Error.UnknownMethod", "Unknown method %s", member)
+}
+
+func (f *fakeSystemd) managerProperties() map[string]dbus.Variant {
+	var failed uint32
+	for name, u := range f.units {
+		if name == u.name && u.props["ActiveState"].Value() == "failed" {
+			failed++
+		}
+	}
+
+	props := map[string]dbus.Variant{
+		"Version":                     dbus.MakeVariant("fake"),
+		"Features":                    dbus.MakeVariant(""),
+		"Virtualization":              dbus.MakeVariant(""),
+		"Architecture":                dbus.MakeVariant("x86-64"),
+		"SystemState":                 dbus.MakeVariant("running"),
+		"NNames":                      dbus.MakeVariant(uint32(len(f.units))),
+		"NFailedUnits":                dbus.MakeVariant(failed),
+		"NJobs":                       dbus.MakeVariant(uint32(0)),
+		"Environment":                 dbus.MakeVariant(append([]string{}, f.env...)),
+		"FirmwareTimestampMonotonic":  dbus.MakeVariant(uint64(0)),
+		"LoaderTimestampMonotonic":    dbus.MakeVariant(uint64(0)),
+		"InitRDTimestampMonotonic":    dbus.MakeVariant(uint64(0)),
+		"UserspaceTimestampMonotonic": dbus.MakeVariant(uint64(1000000)),
+		"FinishTimestampMonotonic":    dbus.MakeVariant(uint64(5000000)),
+	}
+	return props
+}
+
+// manager handles the calls to the Manager interface. The returned functions
+// are run once the reply has been sent.
+func (f *fakeSystemd) manager(member string, args []interface{}) ([]interface{}, []func(), *fakeError) {
+	var (
+		name, mode, typ string
+		names, states   []string
+		runtime, force  bool
+		props           []Property
+		aux             []PropertyCollection
+		changes         []UnitFileChange
+	)
+	store := func(dest ...interface{}) *fakeError {
+		if dbus.Store(args, dest...) != nil {
+			return errFakeInvalidArgs
+		}
+		return nil
+	}
+	reply := func(values ...interface{}) ([]interface{}, []func(), *fakeError) {
+		return values, nil, nil
+	}
+	filesChanged := func(values ...interface{}) ([]interface{}, []func(), *fakeError) {
+		return values, []func(){func() {
+			f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "UnitFilesChanged")
+		}}, nil
+	}
+
+	switch member {
+	case "Subscribe", "Unsubscribe":
+		return reply()
+
+	case "Reload":
+		return nil, []func(){func() {
+			f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "Reloading", true)
+			f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "Reloading", false)
+		}}, nil
+
+	case "GetJob":
+		var id uint32
+		if err := store(&id); err != nil {
+			return nil, nil, err
+		}
+		for _, u := range f.units {
+			if u.job != nil && u.job.id == id {
+				return reply(jobPath(int(id)))
+			}
+		}
+		return nil, nil, fakeErrorf("org.freedesktop.systemd1.NoSuchJob", "Job %d does not exist.", id)
+
+	case "GetUnit", "LoadUnit":
+		if err := store(&name); err != nil {
+			return nil, nil, err
+		}
+		u := f.units[name]
+		if u == nil && member == "GetUnit" {
+			return nil, nil, fakeErrorf("org.freedesktop.systemd1.NoSuchUnit", "Unit %s not loaded.", name)
+		}
+		if u == nil {
+			u = f.load(name)
+		}
+		return reply(UnitPath(u.name))
+
+	case "ListUnits", "ListUnitsFiltered", "ListUnitsByPatterns", "ListUnitsByNames":
+		var patterns []string
+		switch member {
+		case "ListUnitsFiltered":
+			if err := store(&states); err != nil {
+				return nil, nil, err
+			}
+		case "ListUnitsByPatterns":
+			if err := store(&states, &patterns); err != nil {
+				return nil, nil, err
+			}
+		case "ListUnitsByNames":
+			if err := store(&names); err != nil {
+				return nil, nil, err
+			}
+			for _, n := range names {
+				f.load(n)
+			}
+		}
+		return reply(f.listUnits(states, patterns, names))
+
+	case "StartUnit", "StopUnit", "RestartUnit", "ReloadUnit", "TryRestartUnit", "ReloadOrRestartUnit", "ReloadOrTryRestartUnit":
+		if err := store(&name, &mode); err != nil {
+			return nil, nil, err
+		}
+		j, err := f.enqueue(name, fakeJobType(member))
+		if err != nil {
+			return nil, nil, err
+		}
+		return []interface{}{jobPath(int(j.id))}, []func(){func() { f.runJob(j) }}, nil
+
+	case "EnqueueUnitJob":
+		if err := store(&name, &typ, &mode); err != nil {
+			return nil, nil, err
+		}
+		j, err := f.enqueue(name, typ)
+		if err != nil {
+			return nil, nil, err
+		}
+		type jobInfo struct {
+			ID      uint32
+			JobPath dbus.ObjectPath
+			Unit    string
+			Path    dbus.ObjectPath
+			Type    string
+		}
+		info := jobInfo{j.id, jobPath(int(j.id)), j.unit, UnitPath(j.unit), j.typ}
+		return []interface{}{info.ID, info.JobPath, info.Unit, info.Path, info.Type, []jobInfo{}}, []func(){func() { f.runJob(j) }}, nil
+
+	case "StartTransientUnit":
+		if err := store(&name, &mode, &props, &aux); err != nil {
+			return nil, nil, err
+		}
+		if u := f.units[name]; u != nil && u.props["LoadState"].Value() != "not-found" {
+			return nil, nil, fakeErrorf("org.freedesktop.systemd1.UnitExists", "Unit %s already exists.", name)
+		}
+		f.addTransientUnit(name, props)
+		for _, a := range aux {
+			f.addTransientUnit(a.Name, a.Properties)
+		}
+		j, err := f.enqueue(name, "start")
+		if err != nil {
+			return nil, nil, err
+		}
+		return []interface{}{jobPath(int(j.id))}, []func(){func() { f.runJob(j) }}, nil
+
+	case "SetUnitProperties":
+		if err := store(&name, &runtime, &props); err != nil {
+			return nil, nil, err
+		}
+		u := f.load(name)
+		changed := make(map[string]dbus.Variant)
+		for _, p := range props {
+			u.props[p.Name] = p.Value
+			changed[p.Name] = p.Value
+		}
+		f.emit(UnitPath(u.name), "org.freedesktop.DBus.Properties", "PropertiesChanged", "org.freedesktop.systemd1.Unit", changed, []string{})
+		return reply()
+
+	case "KillUnit", "QueueSignalUnit", "KillUnitSubgroup":
+		var signal, value int32
+		var subgroup string
+		var err *fakeError
+		switch member {
+		case "KillUnit":
+			err = store(&name, &typ, &signal)
+		case "QueueSignalUnit":
+			err = store(&name, &typ, &signal, &value)
+		default:
+			err = store(&name, &typ, &subgroup, &signal)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if member == "KillUnitSubgroup" && typ != "cgroup" ||
+			member != "KillUnitSubgroup" && !fakeContains([]string{"main", "control", "all"}, typ) {
+			return nil, nil, fakeErrorf("org.freedesktop.DBus.Error.InvalidArgs", "Invalid who argument: %s", typ)
+		}
+		u := f.units[name]
+		if u == nil {
+			return nil, nil, fakeErrorf("org.freedesktop.systemd1.NoSuchUnit", "Unit %s not loaded.", name)
+		}
+		return nil, []func(){func() { f.kill(u, signal) }}, nil
+
+	case "ResetFailedUnit":
+		if err := store(&name); err != nil {
+			return nil, nil, err
+		}
+		if u := f.units[name]; u != nil && u.props["ActiveState"].Value() == "failed" {
+			f.setResult(u, "success")
+			f.setState(u, "inactive", "dead")
+		}
+		return reply()
+
+	case "GetUnitProcesses":
+		if err := store(&name); err != nil {
+			return nil, nil, err
+		}
+		if u := f.units[name]; u == nil {
+			return nil, nil, fakeErrorf("org.freedesktop.systemd1.NoSuchUnit", "Unit %s not loaded.", name)
+		}
+		processes := []UnitProcess{}
+		for pid, unit := range f.pids {
+			if unit == name {
+				processes = append(processes, UnitProcess{Path: "/system.slice/" + name, PID: pid})
+			}
+		}
+		return reply(processes)
+
+	case "GetUnitByPID":
+		var pid uint32
+		if err := store(&pid); err != nil {
+			return nil, nil, err
+		}
+		unit, ok := f.pids[pid]
+		if !ok {
+			return nil, nil, fakeErrorf("org.freedesktop.systemd1.NoUnitForPID", "PID %d does not belong to any loaded unit.", pid)
+		}
+		return reply(UnitPath(unit))
+
+	case "AttachProcessesToUnit":
+		var subcgroup string
+		var pids []uint32
+		if err := store(&name, &subcgroup, &pids); err != nil {
+			return nil, nil, err
+		}
+		if u := f.units[name]; u == nil || u.props["ActiveState"].Value() != "active" {
+			return nil, nil, fakeErrorf("org.freedesktop.systemd1.UnitInactive", "Unit %s is not active.", name)
+		}
+		for _, pid := range pids {
+			f.pids[pid] = name
+		}
+		return reply()
+
+	case "ListUnitFiles", "ListUnitFilesByPatterns":
+		var patterns []string
+		if member == "ListUnitFilesByPatterns" {
+			if err := store(&states, &patterns); err != nil {
+				return nil, nil, err
+			}
+		}
+		files := []UnitFile{}
+		for name, uf := range f.files {
+			if len(states) > 0 && !fakeContains(states, uf.state) ||
+				len(patterns) > 0 && !fakeMatch(patterns, name) {
+				continue
+			}
+			files = append(files, UnitFile{Path: uf.path, Type: uf.state})
+		}
+		return reply(files)
+
+	case "GetUnitFileState":
+		if err := store(&name); err != nil {
+			return nil, nil, err
+		}
+		uf := f.files[name]
+		if uf == nil {
+			return nil, nil, fakeErrorf("org.freedesktop.DBus.Error.FileNotFound", "No such file or directory")
+		}
+		return reply(uf.state)
+
+	case "LinkUnitFiles", "EnableUnitFiles", "MaskUnitFiles":
+		if err := store(&names, &runtime, &force); err != nil {
+			return nil, nil, err
+		}
+		dir := "/etc/systemd/system/"
+		if runtime {
+			dir = "/run/systemd/system/"
+		}
+		for _, file := range names {
+			name := path.Base(file)
+			uf := f.files[name]
+			if filepath.IsAbs(file) {
+				if uf == nil || uf.path != file {
+					uf = &fakeUnitFile{path: file, state: "linked"}
+					f.files[name] = uf
+					changes = append(changes, UnitFileChange{"symlink", dir + name, file})
+				}
+			} else if uf == nil && member != "MaskUnitFiles" {
+				return nil, nil, fakeErrorf("org.freedesktop.DBus.Error.FileNotFound", "Unit file %s does not exist.", name)
+			}
+
+			switch member {
+			case "LinkUnitFiles":
+				uf.state = "linked"
+			case "EnableUnitFiles":
+				uf.state = "enabled"
+				changes = append(changes, UnitFileChange{"symlink", dir + "multi-user.target.wants/" + name, uf.path})
+			case "MaskUnitFiles":
+				if uf == nil {
+					uf = &fakeUnitFile{}
+					f.files[name] = uf
+				}
+				uf.masked = true
+				uf.state = "masked"
+				changes = append(changes, UnitFileChange{"symlink", dir + name, "/dev/null"})
+			}
+			if runtime {
+				uf.state += "-runtime"
+			}
+			f.updateUnitFile(name)
+		}
+		if changes == nil {
+			changes = []UnitFileChange{}
+		}
+		if member == "EnableUnitFiles" {
+			return filesChanged(true, changes)
+		}
+		return filesChanged(changes)
+
+	case "DisableUnitFiles", "UnmaskUnitFiles":
+		if err := store(&names, &runtime); err != nil {
+			return nil, nil, err
+		}
+		dir := "/etc/systemd/system/"
+		if runtime {
+			dir = "/run/systemd/system/"
+		}
+		changes = []UnitFileChange{}
+		for _, name := range names {
+			uf := f.files[name]
+			switch {
+			case uf == nil:
+			case member == "UnmaskUnitFiles" && uf.masked:
+				uf.masked = false
+				uf.state = "disabled"
+				if uf.path == "" {
+					delete(f.files, name)
+				}
+				changes = append(changes, UnitFileChange{"unlink", dir + name, ""})
+			case member == "DisableUnitFiles" && strings.HasPrefix(uf.state, "enabled"):
+				uf.state = "disabled"
+				changes = append(changes, UnitFileChange{"unlink", dir + "multi-user.target.wants/" + name, ""})
+			}
+			f.updateUnitFile(name)
+		}
+		return filesChanged(changes)
+
+	case "SetEnvironment", "UnsetEnvironment", "UnsetAndSetEnvironment":
+		var set []string
+		var err *fakeError
+		switch member {
+		case "SetEnvironment":
+			err = store(&set)
+		case "UnsetEnvironment":
+			err = store(&names)
+		default:
+			err = store(&names, &set)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		var env []string
+		for _, e := range f.env {
+			key := strings.SplitN(e, "=", 2)[0]
+			if !fakeContains(names, e) && !fakeContains(names, key) && !fakeSetsKey(set, key) {
+				env = append(env, e)
+			}
+		}
+		f.env = append(env, set...)
+		return reply()
+
+	case "GetDefaultTarget":
+		return reply(f.defaultTarget)
+
+	case "SetDefaultTarget":
+		if err := store(&name, &force); err != nil {
+			return nil, nil, err
+		}
+		f.defaultTarget = name
+		return reply([]UnitFileChange{{"symlink", "/etc/systemd/system/default.target", "/lib/systemd/system/" + name}})
+	}
+
+	return nil, nil, fakeErrorf("org.freedesktop.DBus.Error.UnknownMethod", "Unknown method %s", member)
+}
+
+func fakeContains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeMatch(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeSetsKey(env []string, key string) bool {
+	for _, e := range env {
+		if strings.HasPrefix(e, key+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeJobType(method string) string {
+	switch method {
+	case "StartUnit":
+		return "start"
+	case "StopUnit":
+		return "stop"
+	case "RestartUnit":
+		return "restart"
+	case "ReloadUnit":
+		return "reload"
+	case "TryRestartUnit":
+		return "try-restart"
+	case "ReloadOrRestartUnit":
+		return "reload-or-restart"
+	}
+	return "reload-or-try-restart"
+}
+
+// fakeSubStates are the sub states of the unit types when active.
+var fakeSubStates = map[string]string{
+	".service": "running",
+	".mount":   "mounted",
+	".socket":  "listening",
+	".timer":   "waiting",
+	".path":    "waiting",
+	".scope":   "running",
+}
+
+func fakeActiveSubState(name string) string {
+	if sub, ok := fakeSubStates[path.Ext(name)]; ok {
+		return sub
+	}
+	return "active"
+}
+
+func (f *fakeSystemd) now() uint64 {
+	f.clock += 1000
+	return f.clock
+}
+
+func (f *fakeSystemd) newUnit(name string) *fakeUnit {
+	u := &fakeUnit{
+		name: name,
+		props: map[string]dbus.Variant{
+			"Id":            dbus.MakeVariant(name),
+			"Names":         dbus.MakeVariant([]string{name}),
+			"Following":     dbus.MakeVariant(""),
+			"Description":   dbus.MakeVariant(name),
+			"LoadState":     dbus.MakeVariant("not-found"),
+			"ActiveState":   dbus.MakeVariant("inactive"),
+			"SubState":      dbus.MakeVariant("dead"),
+			"FragmentPath":  dbus.MakeVariant(""),
+			"UnitFileState": dbus.MakeVariant(""),
+			"InvocationID":  dbus.MakeVariant([]byte{}),
+			"Job": dbus.MakeVariant(struct {
+				ID   uint32
+				Path dbus.ObjectPath
+			}{0, "/"}),
+		},
+	}
+	for _, ts := range []string{"StateChange", "InactiveExit", "ActiveEnter", "ActiveExit", "InactiveEnter"} {
+		u.props[ts+"Timestamp"] = dbus.MakeVariant(uint64(0))
+		u.props[ts+"TimestampMonotonic"] = dbus.MakeVariant(uint64(0))
+	}
+	for _, dep := range []string{"Requires", "Wants", "BindsTo", "PartOf", "ConsistsOf", "RequiredBy", "WantedBy", "BoundBy", "Before", "After", "Conflicts"} {
+		u.props[dep] = dbus.MakeVariant([]string{})
+	}
+	if path.Ext(name) == ".service" {
+		u.props["Result"] = dbus.MakeVariant("success")
+		u.props["MainPID"] = dbus.MakeVariant(uint32(0))
+		u.props["ExecMainCode"] = dbus.MakeVariant(int32(0))
+		u.props["ExecMainStatus"] = dbus.MakeVariant(int32(0))
+		// Resource accounting is not available.
+		u.props["CPUUsageNSec"] = dbus.MakeVariant(uint64(math.MaxUint64))
+		u.props["MemoryPeak"] = dbus.MakeVariant(uint64(math.MaxUint64))
+	}
+
+	f.units[name] = u
+	f.updateUnitFile(name)
+	return u
+}
+
+// load returns the unit name, loading it if needed.
+func (f *fakeSystemd) load(name string) *fakeUnit {
+	if u := f.units[name]; u != nil {
+		return u
+	}
+	u := f.newUnit(name)
+	f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "UnitNew", name, UnitPath(name))
+	return u
+}
+
+// updateUnitFile updates the properties of the unit name after its unit file
+// changed.
+func (f *fakeSystemd) updateUnitFile(name string) {
+	u := f.units[name]
+	if u == nil || u.transient {
+		return
+	}
+
+	uf := f.files[name]
+	switch {
+	case uf == nil:
+		u.props["LoadState"] = dbus.MakeVariant("not-found")
+		u.props["FragmentPath"] = dbus.MakeVariant("")
+		u.props["UnitFileState"] = dbus.MakeVariant("")
+	case uf.masked:
+		u.props["LoadState"] = dbus.MakeVariant("masked")
+		u.props["FragmentPath"] = dbus.MakeVariant("")
+		u.props["UnitFileState"] = dbus.MakeVariant(uf.state)
+	default:
+		u.props["LoadState"] = dbus.MakeVariant("loaded")
+		u.props["FragmentPath"] = dbus.MakeVariant(uf.path)
+		u.props["UnitFileState"] = dbus.MakeVariant(uf.state)
+	}
+}
+
+func (f *fakeSystemd) addTransientUnit(name string, props []Property) {
+	u := f.units[name]
+	if u == nil {
+		u = f.load(name)
+	}
+	u.transient = true
+	u.props["LoadState"] = dbus.MakeVariant("loaded")
+	u.props["Transient"] = dbus.MakeVariant(true)
+	for _, p := range props {
+		switch {
+		case p.Name == "PIDs":
+			pids, _ := p.Value.Value().([]uint32)
+			for _, pid := range pids {
+				f.pids[pid] = name
+			}
+		case strings.HasPrefix(p.Name, "Exec"):
+			// Read back in a different format.
+		default:
+			u.props[p.Name] = p.Value
+		}
+	}
+}
+
+func (f *fakeSystemd) listUnits(states, patterns, names []string) []UnitStatus {
+	units := []UnitStatus{}
+	for name, u := range f.units {
+		if names != nil && !fakeContains(names, name) ||
+			patterns != nil && len(patterns) > 0 && !fakeMatch(patterns, name) {
+			continue
+		}
+		if names == nil && u.props["LoadState"].Value() == "not-found" {
+			continue
+		}
+		if len(states) > 0 &&
+			!fakeContains(states, u.props["LoadState"].Value().(string)) &&
+			!fakeContains(states, u.props["ActiveState"].Value().(string)) &&
+			!fakeContains(states, u.props["SubState"].Value().(string)) {
+			continue
+		}
+
+		s := UnitStatus{
+			Name:        name,
+			Description: u.props["Description"].Value().(string),
+			LoadState:   u.props["LoadState"].Value().(string),
+			ActiveState: u.props["ActiveState"].Value().(string),
+			SubState:    u.props["SubState"].Value().(string),
+			Path:        UnitPath(u.name),
+			JobPath:     "/",
+		}
+		if u.job != nil {
+			s.JobId = u.job.id
+			s.JobType = u.job.typ
+			s.JobPath = jobPath(int(u.job.id))
+		}
+		units = append(units, s)
+	}
+	return units
+}
+
+func (f *fakeSystemd) enqueue(name string, typ string) (*fakeJob, *fakeError) {
+	u := f.load(name)
+	switch u.props["LoadState"].Value() {
+	case "not-found":
+		if typ != "stop" {
+			return nil, fakeErrorf("org.freedesktop.systemd1.NoSuchUnit", "Unit %s not found.", name)
+		}
+	case "masked":
+		if typ != "stop" {
+			return nil, fakeErrorf("org.freedesktop.systemd1.UnitMasked", "Unit %s is masked.", name)
+		}
+	}
+
+	f.nextJob++
+	j := &fakeJob{id: f.nextJob, unit: u.name, typ: typ}
+	u.job = j
+	f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "JobNew", j.id, jobPath(int(j.id)), j.unit)
+	return j, nil
+}
+
+// runJob runs the job j to completion.
+func (f *fakeSystemd) runJob(j *fakeJob) {
+	u := f.units[j.unit]
+	active := u.props["ActiveState"].Value() == "active"
+
+	stop := func() {
+		if u.props["ActiveState"].Value() == "active" {
+			f.setState(u, "deactivating", "stop")
+			f.setState(u, "inactive", "dead")
+		}
+	}
+	start := func() string {
+		if u.props["ActiveState"].Value() == "active" {
+			return "done"
+		}
+		// Required units are started along, and the job fails if
+		// one of them does not start.
+		requires, _ := u.props["Requires"].Value().([]string)
+		for _, name := range requires {
+			d := f.load(name)
+			if d.props["ActiveState"].Value() == "active" {
+				continue
+			}
+			f.setState(d, "activating", "start")
+			if d.failStart != "" {
+				f.setResult(d, d.failStart)
+				f.setState(d, "failed", "failed")
+				return "dependency"
+			}
+			f.setResult(d, "success")
+			f.setState(d, "active", fakeActiveSubState(d.name))
+		}
+		f.setState(u, "activating", "start")
+		if u.failStart != "" {
+			f.setResult(u, u.failStart)
+			f.setState(u, "failed", "failed")
+			return "failed"
+		}
+		f.setResult(u, "success")
+		f.setState(u, "active", fakeActiveSubState(u.name))
+		return "done"
+	}
+
+	result := "done"
+	switch j.typ {
+	case "start":
+		result = start()
+	case "stop":
+		stop()
+	case "restart", "reload-or-restart":
+		stop()
+		result = start()
+	case "try-restart", "reload-or-try-restart":
+		if active {
+			stop()
+			result = start()
+		}
+	case "reload":
+		if !active {
+			result = "invalid"
+		}
+	}
+
+	u.job = nil
+	f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "JobRemoved", j.id, jobPath(int(j.id)), j.unit, result)
+	f.gc(u)
+}
+
+// gc unloads u if it is inactive, like systemd's garbage collection.
+func (f *fakeSystemd) gc(u *fakeUnit) {
+	if ref, _ := u.props["AddRef"].Value().(bool); ref {
+		return
+	}
+	if !u.builtin && u.props["ActiveState"].Value() == "inactive" {
+		delete(f.units, u.name)
+		for _, v := range u.props {
+			if fd, ok := v.Value().(dbus.UnixFD); ok {
+				syscall.Close(int(fd))
+			}
+		}
+		f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "UnitRemoved", u.name, UnitPath(u.name))
+	}
+}
+
+// kill sends a signal to the processes of u: SIGTERM makes it exit cleanly,
+// unless it ignores it, and SIGKILL makes it fail.
+func (f *fakeSystemd) kill(u *fakeUnit, signal int32) {
+	if u.props["ActiveState"].Value() != "active" {
+		return
+	}
+	switch {
+	case signal == int32(syscall.SIGTERM) && !u.ignoreTerm:
+		f.setState(u, "deactivating", "stop-sigterm")
+		f.setState(u, "inactive", "dead")
+	case signal == int32(syscall.SIGKILL):
+		f.setResult(u, "signal")
+		f.setState(u, "failed", "failed")
+	}
+	f.gc(u)
+}
+
+// setResult sets the result of a service, signaled before its state changes
+// like systemd does.
+func (f *fakeSystemd) setResult(u *fakeUnit, result string) {
+	if _, ok := u.props["Result"]; !ok {
+		return
+	}
+	u.props["Result"] = dbus.MakeVariant(result)
+	f.emit(UnitPath(u.name), "org.freedesktop.DBus.Properties", "PropertiesChanged", "org.freedesktop.systemd1.Service", map[string]dbus.Variant{"Result": u.props["Result"]}, []string{})
+}
+
+// setState changes the state of u, updates its timestamps and signals the
+// change.
+func (f *fakeSystemd) setState(u *fakeUnit, active, sub string) {
+	old, _ := u.props["ActiveState"].Value().(string)
+	inactive := func(s string) bool { return s == "inactive" || s == "failed" }
+
+	now := f.now()
+	changed := map[string]dbus.Variant{
+		"ActiveState": dbus.MakeVariant(active),
+		"SubState":    dbus.MakeVariant(sub),
+	}
+	stamp := func(name string) {
+		changed[name+"Timestamp"] = dbus.MakeVariant(uint64(f.boot.UnixNano()/1000) + now)
+		changed[name+"TimestampMonotonic"] = dbus.MakeVariant(now)
+	}
+	stamp("StateChange")
+	if inactive(old) && !inactive(active) {
+		stamp("InactiveExit")
+	}
+	if old != "active" && active == "active" {
+		stamp("ActiveEnter")
+	}
+	if old == "active" && active != "active" {
+		stamp("ActiveExit")
+	}
+	if !inactive(old) && inactive(active) {
+		stamp("InactiveEnter")
+		for pid, unit := range f.pids {
+			if unit == u.name {
+				delete(f.pids, pid)
+			}
+		}
+	}
+	if old == "inactive" && active == "activating" {
+		b := make([]byte, 16)
+		binary.LittleEndian.PutUint64(b, now)
+		changed["InvocationID"] = dbus.MakeVariant(b)
+	}
+
+	for k, v := range changed {
+		u.props[k] = v
+	}
+	f.emit(UnitPath(u.name), "org.freedesktop.DBus.Properties", "PropertiesChanged", "org.freedesktop.systemd1.Unit", changed, []string{})
+}
+
+// runUnitJob runs a job for the unit name, as if it was enqueued by another
+// client.
+func (f *fakeSystemd) runUnitJob(name, typ string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if j, err := f.enqueue(name, typ); err == nil {
+		f.runJob(j)
+	}
+}
+
+// ignoreSIGTERM makes the processes of the loaded unit name ignore SIGTERM.
+func (f *fakeSystemd) ignoreSIGTERM(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.load(name).ignoreTerm = true
+}
+
+// exitService makes the main process of the running service name exit with
+// status, as if its command finished.
+func (f *fakeSystemd) exitService(name string, status int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.units[name]
+	if u == nil || u.props["ActiveState"].Value() != "active" {
+		return
+	}
+
+	u.props["ExecMainCode"] = dbus.MakeVariant(int32(1)) // CLD_EXITED
+	u.props["ExecMainStatus"] = dbus.MakeVariant(status)
+	f.setState(u, "deactivating", "stop-post")
+	if status == 0 {
+		f.setResult(u, "success")
+		f.setState(u, "inactive", "dead")
+	} else {
+		f.setResult(u, "exit-code")
+		f.setState(u, "failed", "failed")
+	}
+	f.gc(u)
+}
+
+// failUnit makes the start jobs of the loaded service name fail with result.
+func (f *fakeSystemd) failUnit(name string, result string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.load(name).failStart = result
+}
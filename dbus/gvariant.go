@@ -0,0 +1,756 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/godbus/dbus"
+)
+
+// ParseGVariant parses a value in the GVariant text format, as returned by
+// GetManagerProperty, see
+// https://developer.gnome.org/glib/stable/gvariant-text.html
+//
+// typ is the D-Bus signature of the value, e.g. "as" or "a(ss)". If empty,
+// the type is inferred from the text and its type annotations; untyped
+// integers are int32 and untyped floating point numbers float64, as in
+// GVariant. The value is returned with the Go types used by godbus, e.g. uint64
+// for "t", []string for "as" and []interface{} for structs. Arrays of structs
+// may also be written in brackets instead of parentheses, as done by
+// dbus.Variant.String.
+func ParseGVariant(text string, typ string) (interface{}, error) {
+	p := &gvParser{s: text}
+	n, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.i < len(p.s) {
+		return nil, p.errorf("unexpected %q after value", p.s[p.i:])
+	}
+
+	if typ == "" {
+		typ, err = n.infer()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := parseSignature(typ); err != nil {
+		return nil, err
+	}
+	return n.value(typ)
+}
+
+type gvKind int
+
+const (
+	gvNumber gvKind = iota
+	gvString
+	gvBool
+	gvBytes
+	gvArray
+	gvTuple
+	gvDict
+	gvDictEntry
+	gvVariant
+)
+
+// gvNode is a parsed GVariant text value, whose type may not be known yet.
+type gvNode struct {
+	kind  gvKind
+	typ   string // The type given by an annotation or keyword, if any
+	text  string // The literal of numbers, the contents of strings
+	b     bool
+	elems []*gvNode // The elements of arrays and tuples, the alternating keys and values of dicts
+}
+
+// gvKeywords are the type keywords which may precede a value.
+var gvKeywords = map[string]string{
+	"boolean":    "b",
+	"byte":       "y",
+	"int16":      "n",
+	"uint16":     "q",
+	"int32":      "i",
+	"uint32":     "u",
+	"handle":     "h",
+	"int64":      "x",
+	"uint64":     "t",
+	"double":     "d",
+	"string":     "s",
+	"objectpath": "o",
+	"signature":  "g",
+}
+
+type gvParser struct {
+	s string
+	i int
+}
+
+func (p *gvParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("gvariant: offset %d: %s", p.i, fmt.Sprintf(format, args...))
+}
+
+func (p *gvParser) skipSpace() {
+	for p.i < len(p.s) && strings.IndexByte(" \t\n\r", p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// consume skips c, if it is the next character.
+func (p *gvParser) consume(c byte) bool {
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *gvParser) expect(c byte) error {
+	if !p.consume(c) {
+		return p.errorf("expected %q", c)
+	}
+	return nil
+}
+
+func (p *gvParser) parseValue() (*gvNode, error) {
+	p.skipSpace()
+	if p.i >= len(p.s) {
+		return nil, p.errorf("unexpected end of text")
+	}
+
+	switch c := p.s[p.i]; {
+	case c == '@':
+		p.i++
+		typ, _, err := splitSignature(p.s[p.i:])
+		if err != nil {
+			return nil, p.errorf("invalid type annotation: %v", err)
+		}
+		p.i += len(typ)
+		n, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		n.typ = typ
+		return n, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &gvNode{kind: gvString, text: s}, nil
+	case c == 'b' && p.i+1 < len(p.s) && (p.s[p.i+1] == '\'' || p.s[p.i+1] == '"'):
+		p.i++
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &gvNode{kind: gvBytes, text: s + "\x00"}, nil
+	case c == '[':
+		p.i++
+		elems, err := p.parseList(']')
+		if err != nil {
+			return nil, err
+		}
+		return &gvNode{kind: gvArray, elems: elems}, nil
+	case c == '(':
+		p.i++
+		elems, err := p.parseList(')')
+		if err != nil {
+			return nil, err
+		}
+		return &gvNode{kind: gvTuple, elems: elems}, nil
+	case c == '{':
+		p.i++
+		return p.parseDict()
+	case c == '<':
+		p.i++
+		n, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('>'); err != nil {
+			return nil, err
+		}
+		return &gvNode{kind: gvVariant, elems: []*gvNode{n}}, nil
+	}
+
+	start := p.i
+	for p.i < len(p.s) && isGVWordChar(p.s[p.i]) {
+		p.i++
+	}
+	word := p.s[start:p.i]
+	switch {
+	case word == "":
+		return nil, p.errorf("unexpected %q", p.s[p.i])
+	case word == "true" || word == "false":
+		return &gvNode{kind: gvBool, b: word == "true"}, nil
+	case gvKeywords[word] != "":
+		n, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		n.typ = gvKeywords[word]
+		return n, nil
+	case word[0] >= '0' && word[0] <= '9' || word[0] == '-' || word[0] == '+' || word == "inf" || word == "nan":
+		return &gvNode{kind: gvNumber, text: word}, nil
+	}
+	return nil, p.errorf("unknown keyword %q", word)
+}
+
+func isGVWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_+-.", c) >= 0
+}
+
+// parseList parses comma separated values up to end.
+func (p *gvParser) parseList(end byte) ([]*gvNode, error) {
+	var elems []*gvNode
+	if p.consume(end) {
+		return elems, nil
+	}
+	for {
+		n, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, n)
+		if p.consume(end) {
+			return elems, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseDict parses either a dictionary, {k1: v1, k2: v2}, or a single
+// dictionary entry, {k, v}.
+func (p *gvParser) parseDict() (*gvNode, error) {
+	n := &gvNode{kind: gvDict}
+	if p.consume('}') {
+		return n, nil
+	}
+	for {
+		k, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if len(n.elems) == 0 && p.consume(',') {
+			n.kind = gvDictEntry
+		} else if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		n.elems = append(n.elems, k, v)
+
+		if p.consume('}') {
+			return n, nil
+		}
+		if n.kind == gvDictEntry {
+			return nil, p.errorf("expected '}'")
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *gvParser) parseString() (string, error) {
+	quote := p.s[p.i]
+	p.i++
+
+	var b bytes.Buffer
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\\':
+		default:
+			b.WriteByte(c)
+			continue
+		}
+
+		if p.i >= len(p.s) {
+			break
+		}
+		c = p.s[p.i]
+		p.i++
+		switch c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'u', 'U':
+			digits := 4
+			if c == 'U' {
+				digits = 8
+			}
+			if p.i+digits > len(p.s) {
+				return "", p.errorf("truncated escape sequence")
+			}
+			r, err := strconv.ParseUint(p.s[p.i:p.i+digits], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("invalid escape sequence \\%c%s", c, p.s[p.i:p.i+digits])
+			}
+			p.i += digits
+			b.WriteRune(rune(r))
+		case 'x':
+			// A single byte, as used by strconv.Quote for control
+			// characters and invalid UTF-8.
+			if p.i+2 > len(p.s) {
+				return "", p.errorf("truncated escape sequence")
+			}
+			v, err := strconv.ParseUint(p.s[p.i:p.i+2], 16, 8)
+			if err != nil {
+				return "", p.errorf("invalid escape sequence \\x%s", p.s[p.i:p.i+2])
+			}
+			p.i += 2
+			b.WriteByte(byte(v))
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Up to three octal digits, as in C.
+			v := uint(c - '0')
+			for n := 1; n < 3 && p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '7'; n++ {
+				v = v*8 + uint(p.s[p.i]-'0')
+				p.i++
+			}
+			if v > 0xff {
+				return "", p.errorf("invalid octal escape sequence")
+			}
+			b.WriteByte(byte(v))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// infer returns the type of n if it has no type annotation, using the
+// default types of GVariant for numbers.
+func (n *gvNode) infer() (string, error) {
+	if n.typ != "" {
+		return n.typ, nil
+	}
+
+	switch n.kind {
+	case gvNumber:
+		if strings.ContainsAny(n.text, ".ein") && !strings.HasPrefix(strings.TrimLeft(n.text, "+-"), "0x") {
+			return "d", nil
+		}
+		return "i", nil
+	case gvString:
+		return "s", nil
+	case gvBool:
+		return "b", nil
+	case gvBytes:
+		return "ay", nil
+	case gvVariant:
+		return "v", nil
+	case gvTuple:
+		typ := "("
+		for _, e := range n.elems {
+			t, err := e.infer()
+			if err != nil {
+				return "", err
+			}
+			typ += t
+		}
+		return typ + ")", nil
+	case gvArray:
+		if len(n.elems) == 0 {
+			return "", fmt.Errorf("gvariant: cannot infer the type of an empty array")
+		}
+		t, err := inferCommon(n.elems)
+		if err != nil {
+			return "", err
+		}
+		return "a" + t, nil
+	case gvDict, gvDictEntry:
+		if len(n.elems) == 0 {
+			return "", fmt.Errorf("gvariant: cannot infer the type of an empty dictionary")
+		}
+		var keys, values []*gvNode
+		for i := 0; i < len(n.elems); i += 2 {
+			keys = append(keys, n.elems[i])
+			values = append(values, n.elems[i+1])
+		}
+		k, err := inferCommon(keys)
+		if err != nil {
+			return "", err
+		}
+		v, err := inferCommon(values)
+		if err != nil {
+			return "", err
+		}
+		if n.kind == gvDictEntry {
+			return "{" + k + v + "}", nil
+		}
+		return "a{" + k + v + "}", nil
+	}
+	return "", fmt.Errorf("gvariant: cannot infer type")
+}
+
+// inferCommon returns the type of the elements of an array. An annotated or
+// otherwise unambiguous element determines it, numbers are doubles if any of
+// them is.
+func inferCommon(nodes []*gvNode) (string, error) {
+	var typ string
+	for _, n := range nodes {
+		t, err := n.infer()
+		if err != nil {
+			return "", err
+		}
+		if n.typ != "" || n.kind != gvNumber {
+			return t, nil
+		}
+		if typ == "" || t == "d" {
+			typ = t
+		}
+	}
+	return typ, nil
+}
+
+// value converts n to the Go value of type typ.
+func (n *gvNode) value(typ string) (interface{}, error) {
+	if n.typ != "" && n.typ != typ {
+		return nil, fmt.Errorf("gvariant: value of type %s used as %s", n.typ, typ)
+	}
+	mismatch := fmt.Errorf("gvariant: cannot use %s as %s", n.describe(), typ)
+
+	switch typ[0] {
+	case 'y', 'n', 'q', 'i', 'u', 'x', 't', 'h', 'd':
+		if n.kind != gvNumber {
+			return nil, mismatch
+		}
+		return gvNumberValue(n.text, typ[0])
+	case 'b':
+		if n.kind != gvBool {
+			return nil, mismatch
+		}
+		return n.b, nil
+	case 's', 'o', 'g':
+		if n.kind != gvString {
+			return nil, mismatch
+		}
+		switch typ[0] {
+		case 'o':
+			o := dbus.ObjectPath(n.text)
+			if !o.IsValid() {
+				return nil, fmt.Errorf("gvariant: invalid object path %q", n.text)
+			}
+			return o, nil
+		case 'g':
+			return parseSignature(n.text)
+		}
+		return n.text, nil
+	case 'v':
+		if n.kind != gvVariant {
+			return nil, mismatch
+		}
+		t, err := n.elems[0].infer()
+		if err != nil {
+			return nil, err
+		}
+		v, err := n.elems[0].value(t)
+		if err != nil {
+			return nil, err
+		}
+		return dbus.MakeVariant(v), nil
+	case '(':
+		if n.kind != gvTuple && n.kind != gvArray {
+			return nil, mismatch
+		}
+		var fields []string
+		for rest := typ[1 : len(typ)-1]; rest != ""; {
+			var f string
+			f, rest, _ = splitSignature(rest)
+			fields = append(fields, f)
+		}
+		if len(fields) != len(n.elems) {
+			return nil, mismatch
+		}
+		s := make([]interface{}, len(fields))
+		for i, f := range fields {
+			v, err := n.elems[i].value(f)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		return s, nil
+	case 'a':
+		if typ[1] == '{' {
+			return n.dictValue(typ, mismatch)
+		}
+		if n.kind == gvBytes && typ == "ay" {
+			return []byte(n.text), nil
+		}
+		if n.kind != gvArray {
+			return nil, mismatch
+		}
+		t, err := gvGoType(typ)
+		if err != nil {
+			return nil, err
+		}
+		s := reflect.MakeSlice(t, len(n.elems), len(n.elems))
+		for i, e := range n.elems {
+			v, err := e.value(typ[1:])
+			if err != nil {
+				return nil, err
+			}
+			s.Index(i).Set(reflect.ValueOf(v))
+		}
+		return s.Interface(), nil
+	}
+	return nil, mismatch
+}
+
+// dictValue converts a dictionary, or an array of dictionary entries, to a
+// map of type typ.
+func (n *gvNode) dictValue(typ string, mismatch error) (interface{}, error) {
+	var elems []*gvNode
+	switch n.kind {
+	case gvDict:
+		elems = n.elems
+	case gvArray:
+		for _, e := range n.elems {
+			if e.kind != gvDictEntry {
+				return nil, mismatch
+			}
+			elems = append(elems, e.elems...)
+		}
+	default:
+		return nil, mismatch
+	}
+
+	t, err := gvGoType(typ)
+	if err != nil {
+		return nil, err
+	}
+	key, val, _ := splitSignature(typ[2 : len(typ)-1])
+	m := reflect.MakeMap(t)
+	for i := 0; i < len(elems); i += 2 {
+		k, err := elems[i].value(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := elems[i+1].value(val)
+		if err != nil {
+			return nil, err
+		}
+		m.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(v))
+	}
+	return m.Interface(), nil
+}
+
+func (n *gvNode) describe() string {
+	switch n.kind {
+	case gvNumber:
+		return "number " + n.text
+	case gvString:
+		return "string"
+	case gvBool:
+		return "boolean"
+	case gvBytes:
+		return "bytestring"
+	case gvArray:
+		return "array"
+	case gvTuple:
+		return "tuple"
+	case gvDict:
+		return "dictionary"
+	case gvDictEntry:
+		return "dictionary entry"
+	}
+	return "variant"
+}
+
+func gvNumberValue(text string, typ byte) (interface{}, error) {
+	if typ == 'd' {
+		switch text {
+		case "inf", "+inf", "-inf", "nan":
+			// ParseFloat spells them differently.
+			text = strings.Replace(text, "inf", "Inf", 1)
+			text = strings.Replace(text, "nan", "NaN", 1)
+		}
+		return strconv.ParseFloat(text, 64)
+	}
+
+	signed := map[byte]int{'n': 16, 'i': 32, 'x': 64}
+	unsigned := map[byte]int{'y': 8, 'q': 16, 'u': 32, 'h': 32, 't': 64}
+	if bits, ok := signed[typ]; ok {
+		v, err := strconv.ParseInt(text, 0, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case 'n':
+			return int16(v), nil
+		case 'i':
+			return int32(v), nil
+		}
+		return v, nil
+	}
+
+	v, err := strconv.ParseUint(strings.TrimPrefix(text, "+"), 0, unsigned[typ])
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case 'y':
+		return byte(v), nil
+	case 'q':
+		return uint16(v), nil
+	case 'u':
+		return uint32(v), nil
+	case 'h':
+		return dbus.UnixFDIndex(v), nil
+	}
+	return v, nil
+}
+
+// gvGoType returns the Go type godbus uses for values of type typ.
+func gvGoType(typ string) (reflect.Type, error) {
+	switch typ[0] {
+	case 'y':
+		return reflect.TypeOf(byte(0)), nil
+	case 'b':
+		return reflect.TypeOf(false), nil
+	case 'n':
+		return reflect.TypeOf(int16(0)), nil
+	case 'q':
+		return reflect.TypeOf(uint16(0)), nil
+	case 'i':
+		return reflect.TypeOf(int32(0)), nil
+	case 'u':
+		return reflect.TypeOf(uint32(0)), nil
+	case 'x':
+		return reflect.TypeOf(int64(0)), nil
+	case 't':
+		return reflect.TypeOf(uint64(0)), nil
+	case 'h':
+		return reflect.TypeOf(dbus.UnixFDIndex(0)), nil
+	case 'd':
+		return reflect.TypeOf(float64(0)), nil
+	case 's':
+		return reflect.TypeOf(""), nil
+	case 'o':
+		return reflect.TypeOf(dbus.ObjectPath("")), nil
+	case 'g':
+		return reflect.TypeOf(dbus.Signature{}), nil
+	case 'v':
+		return reflect.TypeOf(dbus.Variant{}), nil
+	case '(':
+		return reflect.TypeOf([]interface{}{}), nil
+	case 'a':
+		if typ[1] == '{' {
+			key, val, err := splitSignature(typ[2 : len(typ)-1])
+			if err != nil {
+				return nil, err
+			}
+			k, err := gvGoType(key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := gvGoType(val)
+			if err != nil {
+				return nil, err
+			}
+			return reflect.MapOf(k, v), nil
+		}
+		e, err := gvGoType(typ[1:])
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(e), nil
+	}
+	return nil, fmt.Errorf("gvariant: invalid type %q", typ)
+}
+
+// parseSignature is the same as dbus.ParseSignature, which panics on some
+// invalid signatures, such as the ones with empty dict entries.
+func parseSignature(sig string) (dbus.Signature, error) {
+	for rest := sig; rest != ""; {
+		var err error
+		if _, rest, err = splitSignature(rest); err != nil {
+			return dbus.Signature{}, fmt.Errorf("gvariant: %v", err)
+		}
+	}
+	return dbus.ParseSignature(sig)
+}
+
+// splitSignature splits the first complete type off a D-Bus signature.
+func splitSignature(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("missing type")
+	}
+
+	switch sig[0] {
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'h', 'd', 's', 'o', 'g', 'v':
+		return sig[:1], sig[1:], nil
+	case 'a':
+		elem, rest, err := splitSignature(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		end := byte(')')
+		if sig[0] == '{' {
+			end = '}'
+		}
+		i := 1
+		var types []string
+		for i < len(sig) && sig[i] != end {
+			t, _, err := splitSignature(sig[i:])
+			if err != nil {
+				return "", "", err
+			}
+			types = append(types, t)
+			i += len(t)
+		}
+		if i >= len(sig) {
+			return "", "", fmt.Errorf("unterminated type %q", sig)
+		}
+		switch {
+		case len(types) == 0:
+			return "", "", fmt.Errorf("empty type %q", sig[:i+1])
+		case end == '}' && (len(types) != 2 || len(types[0]) != 1 || !strings.Contains("ybnqiuxthdsog", types[0])):
+			return "", "", fmt.Errorf("invalid dict entry type %q", sig[:i+1])
+		}
+		return sig[:i+1], sig[i+1:], nil
+	}
+	return "", "", fmt.Errorf("invalid type %q", sig)
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+func TestParseGVariant(t *testing.T) {
+	tests := []struct {
+		text string
+		typ  string
+		want interface{}
+	}{
+		{`'running'`, "", "running"},
+		{`"it's \"quoted\"\né"`, "", "it's \"quoted\"\né"},
+		{`@t 1234`, "", uint64(1234)},
+		{`uint32 0x10`, "", uint32(16)},
+		{`-5`, "", int32(-5)},
+		{`-5`, "x", int64(-5)},
+		{`0.5`, "", float64(0.5)},
+		{`true`, "", true},
+		{`@h 3`, "", dbus.UnixFDIndex(3)},
+		{`objectpath '/org/freedesktop/systemd1'`, "", dbus.ObjectPath("/org/freedesktop/systemd1")},
+		{`['PATH=/bin', 'LANG=C']`, "", []string{"PATH=/bin", "LANG=C"}},
+		{`@as []`, "", []string{}},
+		{`[]`, "as", []string{}},
+		{`[1, 2.5]`, "", []float64{1, 2.5}},
+		{`[byte 0x01, 0x02]`, "", []byte{1, 2}},
+		{`b'ab'`, "", []byte{'a', 'b', 0}},
+		{`('a', 1, [true])`, "", []interface{}{"a", int32(1), []bool{true}}},
+		{`[('a', 'b')]`, "", [][]interface{}{{"a", "b"}}},
+		{`@a(ss) [["a", "b"]]`, "", [][]interface{}{{"a", "b"}}},
+		{`{'a': 1, 'b': 2}`, "", map[string]int32{"a": 1, "b": 2}},
+		{`[{'a', 1}]`, "", map[string]int32{"a": 1}},
+		{`@a{sv} {}`, "", map[string]dbus.Variant{}},
+		{`{'a': <'x'>, 'b': <@u 1>}`, "", map[string]dbus.Variant{"a": dbus.MakeVariant("x"), "b": dbus.MakeVariant(uint32(1))}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseGVariant(tt.text, tt.typ)
+		if err != nil {
+			t.Errorf("ParseGVariant(%q, %q): %v", tt.text, tt.typ, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseGVariant(%q, %q) = %#v, want %#v", tt.text, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestParseGVariantErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		typ  string
+	}{
+		{`'unterminated`, ""},
+		{`[]`, ""},
+		{`[1, 'a']`, ""},
+		{`@u 'a'`, ""},
+		{`@y 256`, ""},
+		{`'a' 'b'`, ""},
+		{`objectpath 'a'`, ""},
+		{`('a', 1)`, "(s)"},
+		{`nothing`, ""},
+		{`1`, "z"},
+		{`@a{}{}`, ""},
+		{`{}`, "a{}"},
+		{`()`, "()"},
+		{`{}`, "a{s}"},
+		{`{}`, "a{sss}"},
+		{`{}`, "a{vs}"},
+		{`{}`, "a{ass}"},
+		{`<'a'>`, "{sv}"},
+		{`signature 'a{}'`, ""},
+	}
+
+	for _, tt := range tests {
+		if v, err := ParseGVariant(tt.text, tt.typ); err == nil {
+			t.Errorf("ParseGVariant(%q, %q) = %#v, expected an error", tt.text, tt.typ, v)
+		}
+	}
+}
+
+// TestParseGVariantString checks that the text returned by
+// dbus.Variant.String is parsed back.
+func TestParseGVariantString(t *testing.T) {
+	for _, v := range []interface{}{
+		"running",
+		uint64(1234),
+		[]string{"a", "b"},
+		[]string{},
+		map[string]uint32{"a": 1},
+		dbus.MakeVariant(int16(-1)),
+	} {
+		text := dbus.MakeVariant(v).String()
+		got, err := ParseGVariant(text, "")
+		if err != nil {
+			t.Errorf("ParseGVariant(%q): %v", text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("ParseGVariant(%q) = %#v, want %#v", text, got, v)
+		}
+	}
+}
+
+// TestParseGVariantStringEscapes checks that strings with control characters
+// and invalid UTF-8, which strconv.Quote escapes, are parsed back unchanged.
+func TestParseGVariantStringEscapes(t *testing.T) {
+	for _, s := range []string{
+		"a\x01b",
+		"\x00\x1f\x7f",
+		"tab\there\nnewline",
+		"\xff\xfe invalid",
+		"caf\xc3",
+		"quote\" and 'apostrophe' \\ backslash",
+		"  separator",
+	} {
+		text := dbus.MakeVariant(s).String()
+		got, err := ParseGVariant(text, "")
+		if err != nil {
+			t.Errorf("ParseGVariant(%q): %v", text, err)
+			continue
+		}
+		if got != s {
+			t.Errorf("ParseGVariant(%q) = %q, want %q", text, got, s)
+		}
+	}
+
+	got, err := ParseGVariant(`"\101\7\0"`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "A\a\x00" {
+		t.Errorf("Unexpected octal escapes %q", got)
+	}
+	for _, text := range []string{`"\x4"`, `"\xzz"`, `"\400"`} {
+		if _, err := ParseGVariant(text, ""); err == nil {
+			t.Errorf("ParseGVariant(%q): expected an error", text)
+		}
+	}
+}
+
+func TestGetManagerProperties(t *testing.T) {
+	conn := setupConn(t)
+
+	props, err := conn.GetManagerProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.Version == "" || props.NNames == 0 {
+		t.Fatalf("Unexpected manager properties %+v", props)
+	}
+
+	version, err := conn.GetManagerProperty("Version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := ParseGVariant(version, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != props.Version {
+		t.Fatalf("Got version %q, want %q", v, props.Version)
+	}
+}
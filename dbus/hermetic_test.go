@@ -0,0 +1,419 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// The tests in this file run against fakeSystemd, and don't need root or a
+// running systemd.
+
+func TestFakeStartStopUnit(t *testing.T) {
+	target := "start-stop.service"
+	conn := newFakeSystemd().newConn(t)
+	defer conn.Close()
+
+	changes, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Filename != "/run/systemd/system/"+target {
+		t.Fatalf("Unexpected changes %v", changes)
+	}
+
+	reschan := make(chan string)
+	if _, err := conn.StartUnit(target, "replace", reschan); err != nil {
+		t.Fatal(err)
+	}
+	if job := <-reschan; job != "done" {
+		t.Fatal("Job is not done:", job)
+	}
+
+	units, err := conn.ListUnits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unit := getUnitStatus(units, target); unit == nil || unit.ActiveState != "active" || unit.SubState != "running" {
+		t.Fatalf("Test unit not active: %+v", unit)
+	}
+
+	props, err := conn.GetTypedUnitProperties(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.FragmentPath != findFixture(target, t) || props.ActiveEnterTimestamp.IsZero() || len(props.InvocationID) != 16 {
+		t.Fatalf("Unexpected unit properties %+v", props)
+	}
+
+	if _, err := conn.StopUnit(target, "replace", reschan); err != nil {
+		t.Fatal(err)
+	}
+	if job := <-reschan; job != "done" {
+		t.Fatal("Job is not done:", job)
+	}
+
+	units, err = conn.ListUnits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unit := getUnitStatus(units, target); unit != nil {
+		t.Fatalf("Test unit found in list, should be stopped")
+	}
+
+	if _, err := conn.StartUnit("unexisting.service", "replace", nil); err == nil {
+		t.Fatal("Expected an error starting a missing unit")
+	}
+}
+
+func TestFakeFailedUnit(t *testing.T) {
+	target := "start-stop.service"
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	f.failUnit(target, "exit-code")
+
+	job, _, err := conn.EnqueueUnitJob(target, "start", "replace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := job.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != JobFailed {
+		t.Fatalf("Expected the job to fail, got %s", result)
+	}
+
+	service, err := conn.GetServiceProperties(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.Result != "exit-code" {
+		t.Fatalf("Unexpected result %q", service.Result)
+	}
+
+	failed, err := conn.ListUnitsFiltered([]string{"failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Name != target {
+		t.Fatalf("Unexpected failed units %+v", failed)
+	}
+
+	if err := conn.ResetFailedUnit(target); err != nil {
+		t.Fatal(err)
+	}
+	prop, err := conn.GetUnitProperty(target, "ActiveState")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prop.Value.Value() != "inactive" {
+		t.Fatalf("Unit not reset: %v", prop.Value)
+	}
+}
+
+func TestFakeUnitFiles(t *testing.T) {
+	target := "enable-disable.service"
+	conn := newFakeSystemd().newConn(t)
+	defer conn.Close()
+
+	install, changes, err := conn.EnableUnitFiles([]string{findFixture(target, t)}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !install || len(changes) != 2 {
+		t.Fatalf("Unexpected changes %v", changes)
+	}
+
+	state, err := conn.GetUnitFileState(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "enabled" {
+		t.Fatalf("Unexpected unit file state %q", state)
+	}
+
+	files, err := conn.ListUnitFilesByPatterns([]string{"enabled"}, []string{"enable-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != findFixture(target, t) {
+		t.Fatalf("Unexpected unit files %v", files)
+	}
+
+	dchanges, err := conn.DisableUnitFiles([]string{target}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dchanges) != 1 || dchanges[0].Type != "unlink" {
+		t.Fatalf("Unexpected changes %v", dchanges)
+	}
+
+	if _, err := conn.MaskUnitFiles([]string{target}, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.StartUnit(target, "replace", nil); err == nil {
+		t.Fatal("Expected an error starting a masked unit")
+	}
+	if _, err := conn.UnmaskUnitFiles([]string{target}, false); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := conn.GetUnitFileState(target); err != nil || state != "disabled" {
+		t.Fatalf("Unexpected unit file state %q: %v", state, err)
+	}
+}
+
+func TestFakeTransientUnitTransitions(t *testing.T) {
+	target := "fake-transient.service"
+	conn := newFakeSystemd().newConn(t)
+	defer conn.Close()
+
+	sub, err := conn.SubscribeUnitTransitions(16, TransitionBlock, func(unit string) bool { return unit != target })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	reschan := make(chan string)
+	props := []Property{PropDescription("fake transient"), PropExecStart([]string{"/bin/true"}, false)}
+	if _, err := conn.StartTransientUnit(target, "replace", props, reschan); err != nil {
+		t.Fatal(err)
+	}
+	if job := <-reschan; job != "done" {
+		t.Fatal("Job is not done:", job)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case tr := <-sub.Transitions():
+			if tr.To.ActiveState == "active" {
+				if tr.To.SubState != "running" || tr.ActiveEnterTimestamp.IsZero() {
+					t.Fatalf("Unexpected transition %+v", tr)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("Reached timeout")
+		}
+	}
+}
+
+func TestFakeKillUnit(t *testing.T) {
+	target := "start-stop.service"
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	start := func() {
+		reschan := make(chan string)
+		if _, err := conn.StartUnit(target, "replace", reschan); err != nil {
+			t.Fatal(err)
+		}
+		if job := <-reschan; job != "done" {
+			t.Fatal("Job is not done:", job)
+		}
+	}
+
+	start()
+	if err := conn.KillUnitWithTarget(target, Who("nobody"), int32(syscall.SIGTERM)); err == nil {
+		t.Fatal("Expected an error for an invalid target")
+	}
+	if err := conn.QueueSignalUnit(target, WhoMain, 34, 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.KillUnitSubgroup(target, "/foo", int32(syscall.SIGHUP)); err != nil {
+		t.Fatal(err)
+	}
+
+	killed, err := conn.TerminateUnit(target, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if killed {
+		t.Fatal("Unit was killed although it exited on SIGTERM")
+	}
+
+	// The unit exits a while after SIGTERM.
+	start()
+	f.ignoreSIGTERM(target)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f.exitService(target, 0)
+	}()
+	killed, err = conn.TerminateUnit(target, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if killed {
+		t.Fatal("Unit was killed although it exited before the timeout")
+	}
+
+	start()
+	f.ignoreSIGTERM(target)
+	killed, err = conn.TerminateUnit(target, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !killed {
+		t.Fatal("Unit was not killed although it ignored SIGTERM")
+	}
+	prop, err := conn.GetUnitProperty(target, "ActiveState")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prop.Value.Value() != "failed" {
+		t.Fatalf("Unexpected state %v after SIGKILL", prop.Value)
+	}
+
+	if err := conn.KillUnitWithTarget("unexisting.service", WhoAll, int32(syscall.SIGTERM)); err == nil {
+		t.Fatal("Expected an error killing a missing unit")
+	}
+}
+
+func TestFakeManager(t *testing.T) {
+	conn := newFakeSystemd().newConn(t)
+	defer conn.Close()
+
+	if err := conn.SetEnvironment([]string{"FOO=bar", "BAZ=1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.UnsetEnvironment([]string{"BAZ"}); err != nil {
+		t.Fatal(err)
+	}
+	props, err := conn.GetManagerProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(props.Environment) != 1 || props.Environment[0] != "FOO=bar" {
+		t.Fatalf("Unexpected environment %v", props.Environment)
+	}
+
+	g, err := conn.GetDependencyGraph("default.target", DependencyWalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.Units["sysinit.target"]; !ok || g.Units["sysinit.target"] != 2 {
+		t.Fatalf("Unexpected dependency graph %+v", g)
+	}
+
+	chain, err := conn.CriticalChain("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.Name != "default.target" || len(chain.After) != 1 || chain.After[0].Name != "systemd-journald.service" {
+		t.Fatalf("Unexpected critical chain %+v", chain)
+	}
+}
+
+func TestFakeInteractiveAuthorization(t *testing.T) {
+	target := "start-stop.service"
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.polkit = true
+	f.mu.Unlock()
+
+	if _, err := conn.StartUnit(target, "replace", nil); err == nil {
+		t.Fatal("Expected an error without interactive authorization")
+	}
+
+	conn.SetInteractiveAuthorization(true)
+	reschan := make(chan string)
+	if _, err := conn.StartUnit(target, "replace", reschan); err != nil {
+		t.Fatal(err)
+	}
+	if job := <-reschan; job != "done" {
+		t.Fatal("Job is not done:", job)
+	}
+	prop, err := conn.GetUnitTypeProperty(target, "Service", "Result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prop.Value.Value() != "success" {
+		t.Fatalf("Unexpected result %v", prop.Value)
+	}
+}
+
+func TestFakeSubscriptionSet(t *testing.T) {
+	target := "subscribe-events-set.service"
+	for _, lose := range []bool{false, true} {
+		f := newFakeSystemd()
+		conn := f.newConn(t)
+
+		if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+			t.Fatal(err)
+		}
+		subSet := conn.NewSubscriptionSet()
+		subSet.Add(target)
+		evChan, errChan := subSet.Subscribe()
+
+		reschan := make(chan string)
+		if _, err := conn.StartUnit(target, "replace", reschan); err != nil {
+			t.Fatal(err)
+		}
+		<-reschan
+
+		timeout := time.After(5 * time.Second)
+	wait:
+		for {
+			select {
+			case changes := <-evChan:
+				if u := changes[target]; u != nil && u.ActiveState == "active" {
+					break wait
+				}
+			case err := <-errChan:
+				t.Fatal(err)
+			case <-timeout:
+				t.Fatal("Reached timeout")
+			}
+		}
+
+		want := errConnClosed
+		if lose {
+			want = errConnLost
+			f.stop()
+		} else {
+			conn.Close()
+		}
+		for range evChan {
+		}
+		select {
+		case err := <-errChan:
+			if err != want {
+				t.Fatalf("Expected %v, got %v", want, err)
+			}
+		case <-timeout:
+			t.Fatal("Reached timeout waiting for the error")
+		}
+		conn.Close()
+	}
+}
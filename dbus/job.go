@@ -0,0 +1,248 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"errors"
+
+	"github.com/godbus/dbus"
+)
+
+// JobResult is the result of a completed job, as sent to the channels passed
+// to StartUnit and friends.
+type JobResult string
+
+const (
+	// JobDone indicates successful execution of a job.
+	JobDone JobResult = "done"
+	// JobCanceled indicates that a job has been canceled before it
+	// finished execution.
+	JobCanceled JobResult = "canceled"
+	// JobTimeout indicates that the job timeout was reached.
+	JobTimeout JobResult = "timeout"
+	// JobFailed indicates that the job failed.
+	JobFailed JobResult = "failed"
+	// JobDependency indicates that a job this job has been depending on
+	// failed and the job hence has been removed too.
+	JobDependency JobResult = "dependency"
+	// JobSkipped indicates that a job was skipped because it didn't apply
+	// to the unit's current state.
+	JobSkipped JobResult = "skipped"
+)
+
+var (
+	// ErrJobGone is returned by Job.Wait if the job no longer exists and
+	// its result is unknown.
+	ErrJobGone = errors.New("job no longer exists")
+
+	// ErrJobAlreadyWaited is returned by Job.Wait if the job's result is
+	// already being waited for, either by another call to Wait or through
+	// the channel passed to the method which enqueued the job.
+	ErrJobAlreadyWaited = errors.New("job is already being waited for")
+)
+
+// Job is a job queued in systemd.
+type Job struct {
+	ID       uint32          // The numeric job id
+	Unit     string          // The primary name of the unit the job belongs to
+	Type     string          // The job type, e.g. start, stop or reload
+	State    string          // The job state, either waiting or running
+	Path     dbus.ObjectPath // The job object path
+	UnitPath dbus.ObjectPath // The unit object path
+
+	conn *Conn
+}
+
+func (c *Conn) listJobsInternal(f storeFunc) ([]Job, error) {
+	result := make([][]interface{}, 0)
+	err := f(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	resultInterface := make([]interface{}, len(result))
+	for i := range result {
+		resultInterface[i] = result[i]
+	}
+
+	jobs := make([]Job, len(result))
+	jobsInterface := make([]interface{}, len(jobs))
+	for i := range jobs {
+		jobsInterface[i] = &jobs[i]
+	}
+
+	err = dbus.Store(resultInterface, jobsInterface...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range jobs {
+		jobs[i].conn = c
+	}
+
+	return jobs, nil
+}
+
+// ListJobs returns all jobs currently queued in systemd.
+func (c *Conn) ListJobs() ([]Job, error) {
+	return c.ListJobsContext(context.Background())
+}
+
+// ListJobsContext is the same as ListJobs with a context.
+func (c *Conn) ListJobsContext(ctx context.Context) ([]Job, error) {
+	return c.listJobsInternal(callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ListJobs").Store)
+}
+
+// GetJob returns the job with the given ID.
+func (c *Conn) GetJob(id uint32) (*Job, error) {
+	return c.GetJobContext(context.Background(), id)
+}
+
+// GetJobContext is the same as GetJob with a context.
+func (c *Conn) GetJobContext(ctx context.Context, id uint32) (*Job, error) {
+	var p dbus.ObjectPath
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetJob", id).Store(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	var props map[string]dbus.Variant
+	obj := c.object(p)
+	err = callContext(ctx, obj, "org.freedesktop.DBus.Properties.GetAll", "org.freedesktop.systemd1.Job").Store(&props)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{ID: id, Path: p, conn: c}
+	unit := struct {
+		Name string
+		Path dbus.ObjectPath
+	}{}
+	if v, ok := props["Unit"]; ok {
+		if err := dbus.Store([]interface{}{v.Value()}, &unit); err != nil {
+			return nil, err
+		}
+	}
+	job.Unit, job.UnitPath = unit.Name, unit.Path
+	job.Type, _ = props["JobType"].Value().(string)
+	job.State, _ = props["State"].Value().(string)
+
+	return job, nil
+}
+
+// CancelJob cancels the job with the given ID. Canceling a job also cancels
+// the jobs depending on it.
+func (c *Conn) CancelJob(id uint32) error {
+	return c.CancelJobContext(context.Background(), id)
+}
+
+// CancelJobContext is the same as CancelJob with a context.
+func (c *Conn) CancelJobContext(ctx context.Context, id uint32) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.CancelJob", id).Store()
+}
+
+// ClearJobs flushes the job queue, canceling all pending jobs.
+func (c *Conn) ClearJobs() error {
+	return c.ClearJobsContext(context.Background())
+}
+
+// ClearJobsContext is the same as ClearJobs with a context.
+func (c *Conn) ClearJobsContext(ctx context.Context) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ClearJobs").Store()
+}
+
+// Cancel cancels the job.
+func (j *Job) Cancel(ctx context.Context) error {
+	return j.conn.CancelJobContext(ctx, j.ID)
+}
+
+// Wait blocks until the job completes and returns its result. If ctx is done
+// first, ctx.Err() is returned and the job keeps running. Subscribe is called
+// if needed, as systemd only sends the job's completion to subscribers.
+//
+// ErrJobGone is returned if the job already completed before Wait was called,
+// or while the connection was being reestablished, and ErrJobAlreadyWaited if
+// the job was enqueued with a non-nil result channel.
+func (j *Job) Wait(ctx context.Context) (JobResult, error) {
+	c := j.conn
+	if err := c.subscribeIfNeeded(ctx); err != nil {
+		return "", err
+	}
+	ch := make(chan string, 1)
+
+	c.jobListener.Lock()
+	if _, ok := c.jobListener.jobs[j.Path]; ok {
+		c.jobListener.Unlock()
+		return "", ErrJobAlreadyWaited
+	}
+	c.jobListener.jobs[j.Path] = ch
+	c.jobListener.Unlock()
+
+	stopListening := func() {
+		c.jobListener.Lock()
+		delete(c.jobListener.jobs, j.Path)
+		c.jobListener.Unlock()
+	}
+
+	// The job may have completed before the listener was in place, in
+	// which case its JobRemoved signal has been missed.
+	var p dbus.ObjectPath
+	if err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetJob", j.ID).Store(&p); err != nil {
+		stopListening()
+		select {
+		case result := <-ch:
+			return jobResult(result)
+		default:
+		}
+		if errors.Is(err, ErrNoSuchJob) {
+			return "", ErrJobGone
+		}
+		return "", err
+	}
+
+	select {
+	case result := <-ch:
+		return jobResult(result)
+	case <-ctx.Done():
+		stopListening()
+		return "", ctx.Err()
+	}
+}
+
+// jobResult converts a result sent to a job listener. The result is empty if
+// the job's completion was missed while reconnecting.
+func jobResult(result string) (JobResult, error) {
+	if result == "" {
+		return "", ErrJobGone
+	}
+	return JobResult(result), nil
+}
+
+// GetAfter returns the jobs which are waiting for this job to complete.
+// Requires systemd 236 or newer.
+func (j *Job) GetAfter(ctx context.Context) ([]Job, error) {
+	return j.conn.listJobsInternal(callContext(ctx, j.object(), "org.freedesktop.systemd1.Job.GetAfter").Store)
+}
+
+// GetBefore returns the jobs this job is waiting for to complete before it
+// can run. Requires systemd 236 or newer.
+func (j *Job) GetBefore(ctx context.Context) ([]Job, error) {
+	return j.conn.listJobsInternal(callContext(ctx, j.object(), "org.freedesktop.systemd1.Job.GetBefore").Store)
+}
+
+func (j *Job) object() dbus.BusObject {
+	return j.conn.object(j.Path)
+}
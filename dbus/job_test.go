@@ -0,0 +1,170 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// replyObject is a dbus.BusObject answering method calls with reply.
+type replyObject struct {
+	dbus.BusObject
+	reply func(method string, args ...interface{}) ([]interface{}, error)
+}
+
+func (o replyObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	call := &dbus.Call{Method: method, Args: args, Done: ch}
+	call.Body, call.Err = o.reply(method, args...)
+	ch <- call
+	return call
+}
+
+func TestListJobsInternal(t *testing.T) {
+	conn := &Conn{}
+	store := func(retvalues ...interface{}) error {
+		return dbus.Store([]interface{}{[][]interface{}{
+			{uint32(7), "foo.service", "start", "running", dbus.ObjectPath("/org/freedesktop/systemd1/job/7"), UnitPath("foo.service")},
+		}}, retvalues...)
+	}
+
+	jobs, err := conn.listJobsInternal(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 1 {
+		t.Fatalf("Expected one job, got %v", jobs)
+	}
+
+	j := jobs[0]
+	if j.ID != 7 || j.Unit != "foo.service" || j.Type != "start" || j.State != "running" {
+		t.Fatalf("Unexpected job %+v", j)
+	}
+	if j.Path != jobPath(7) || j.UnitPath != UnitPath("foo.service") {
+		t.Fatalf("Unexpected job paths %+v", j)
+	}
+	if j.conn != conn {
+		t.Fatal("Job is not bound to its connection")
+	}
+}
+
+func TestJobWait(t *testing.T) {
+	conn := &Conn{}
+	conn.state.subscribed = true
+	conn.jobListener.jobs = make(map[dbus.ObjectPath]chan<- string)
+	conn.sysobj = replyObject{reply: func(method string, args ...interface{}) ([]interface{}, error) {
+		if args[0].(uint32) != 7 {
+			return nil, dbus.Error{Name: "org.freedesktop.systemd1.NoSuchJob"}
+		}
+		return []interface{}{jobPath(7)}, nil
+	}}
+
+	job := &Job{ID: 7, Path: jobPath(7), conn: conn}
+	go func() {
+		for {
+			conn.jobListener.Lock()
+			_, ok := conn.jobListener.jobs[job.Path]
+			conn.jobListener.Unlock()
+			if ok {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		conn.jobComplete(&dbus.Signal{
+			Name: "org.freedesktop.systemd1.Manager.JobRemoved",
+			Body: []interface{}{uint32(7), job.Path, "foo.service", "failed"},
+		})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != JobFailed {
+		t.Fatalf("Expected JobFailed, got %q", result)
+	}
+
+	gone := &Job{ID: 8, Path: jobPath(8), conn: conn}
+	if _, err := gone.Wait(ctx); err != ErrJobGone {
+		t.Fatalf("Expected ErrJobGone, got %v", err)
+	}
+
+	if len(conn.jobListener.jobs) != 0 {
+		t.Fatal("JobListener jobs leaked")
+	}
+}
+
+// TestListJobs enqueues a start job and ensures it can be found and waited
+// for.
+func TestListJobs(t *testing.T) {
+	target := "start-stop.service"
+	conn := setupConn(t)
+
+	setupUnit(target, conn, t)
+	linkUnit(target, conn, t)
+
+	id, err := conn.StartUnit(target, "replace", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := conn.GetJob(uint32(id))
+	if err != nil {
+		// the job may have completed already
+		t.Skip(err)
+	}
+	if job.Unit != target || job.Type != "start" {
+		t.Fatalf("Unexpected job %+v", job)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := job.Wait(ctx)
+	if err != nil && err != ErrJobGone {
+		t.Fatal(err)
+	}
+	if err == nil && result != JobDone {
+		t.Fatal("Job is not done:", result)
+	}
+
+	conn.StopUnit(target, "replace", nil)
+}
+
+// TestFakeJobWaitSubscribes ensures that Wait subscribes, as systemd only
+// sends the JobRemoved signals of the jobs of other clients to subscribers.
+func TestFakeJobWaitSubscribes(t *testing.T) {
+	conn := newFakeSystemd().newConn(t)
+	defer conn.Close()
+
+	job := &Job{ID: 999, Path: jobPath(999), conn: conn}
+	if _, err := job.Wait(context.Background()); err != ErrJobGone {
+		t.Fatalf("Expected ErrJobGone, got %v", err)
+	}
+
+	conn.connMu.RLock()
+	subscribed := conn.state.subscribed
+	conn.connMu.RUnlock()
+	if !subscribed {
+		t.Fatal("Wait did not subscribe")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"time"
+)
+
+// ManagerProperties holds the properties of the
+// org.freedesktop.systemd1.Manager interface. Properties not known to the
+// running systemd are left empty. The Firmware and Loader monotonic timestamps
+// count backwards from the start of the kernel.
+type ManagerProperties struct {
+	Version        string
+	Features       string
+	Virtualization string
+	Architecture   string
+	Tainted        string
+	SystemState    string
+	NNames         uint32
+	NFailedUnits   uint32
+	NJobs          uint32
+	NInstalledJobs uint32
+	NFailedJobs    uint32
+	Progress       float64
+	Environment    []string
+	UnitPath       []string
+
+	FirmwareTimestamp                  time.Time
+	FirmwareTimestampMonotonic         time.Duration
+	LoaderTimestamp                    time.Time
+	LoaderTimestampMonotonic           time.Duration
+	KernelTimestamp                    time.Time
+	KernelTimestampMonotonic           time.Duration
+	InitRDTimestamp                    time.Time
+	InitRDTimestampMonotonic           time.Duration
+	UserspaceTimestamp                 time.Time
+	UserspaceTimestampMonotonic        time.Duration
+	FinishTimestamp                    time.Time
+	FinishTimestampMonotonic           time.Duration
+	SecurityStartTimestamp             time.Time
+	SecurityStartTimestampMonotonic    time.Duration
+	SecurityFinishTimestamp            time.Time
+	SecurityFinishTimestampMonotonic   time.Duration
+	GeneratorsStartTimestamp           time.Time
+	GeneratorsStartTimestampMonotonic  time.Duration
+	GeneratorsFinishTimestamp          time.Time
+	GeneratorsFinishTimestampMonotonic time.Duration
+	UnitsLoadStartTimestamp            time.Time
+	UnitsLoadStartTimestampMonotonic   time.Duration
+	UnitsLoadFinishTimestamp           time.Time
+	UnitsLoadFinishTimestampMonotonic  time.Duration
+}
+
+// GetManagerProperties returns the properties of the
+// org.freedesktop.systemd1.Manager interface as a ManagerProperties struct.
+func (c *Conn) GetManagerProperties() (*ManagerProperties, error) {
+	return c.GetManagerPropertiesContext(context.Background())
+}
+
+// GetManagerPropertiesContext is the same as GetManagerProperties with a
+// context.
+func (c *Conn) GetManagerPropertiesContext(ctx context.Context) (*ManagerProperties, error) {
+	props, err := c.getManagerProperties(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ManagerProperties{}
+	if err := storeProperties(props, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,423 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// UnitRemoved is sent by a UnitRemovedSubscription when a unit is unloaded.
+type UnitRemoved struct {
+	Name string          // The primary unit name
+	Path dbus.ObjectPath // The unit object path
+}
+
+// JobNew is sent by a JobNewSubscription when a job is enqueued.
+type JobNew struct {
+	ID   uint32          // The numeric job id
+	Path dbus.ObjectPath // The job object path
+	Unit string          // The primary name of the unit the job belongs to
+}
+
+// signalQueueSize is how many signals a subscription queues for a receiver
+// which falls behind before it drops the oldest ones.
+const signalQueueSize = 1024
+
+// managerSignals are the subscriptions to the signals of the
+// org.freedesktop.systemd1.Manager interface, by member.
+type managerSignals struct {
+	sync.Mutex
+	subs map[string]map[*signalSubscription]struct{}
+	// stopped is why the subscriptions were ended, once the connection
+	// is gone for good.
+	stopped error
+}
+
+// signalSubscription queues the signals of a Manager member until they are
+// delivered, so that dispatch never waits for the receiver. Up to
+// signalQueueSize signals are queued, older ones are dropped.
+type signalSubscription struct {
+	conn   *Conn
+	member string
+
+	mu      sync.Mutex
+	queue   []*dbus.Signal
+	dropped uint64
+	err     error
+	notify  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// subscribeSignal subscribes to the Manager signal member. deliver is called
+// with each signal and must return once done is closed.
+func (c *Conn) subscribeSignal(ctx context.Context, member string, deliver func(signal *dbus.Signal, done <-chan struct{}), closeCh func()) (*signalSubscription, error) {
+	if err := c.addMatch("type='signal',interface='org.freedesktop.systemd1.Manager',member='" + member + "'"); err != nil {
+		return nil, err
+	}
+	if err := c.subscribeIfNeeded(ctx); err != nil {
+		return nil, err
+	}
+
+	s := &signalSubscription{
+		conn:   c,
+		member: member,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	ms := &c.managerSignals
+	ms.Lock()
+	stopped := ms.stopped
+	if stopped == nil {
+		if ms.subs == nil {
+			ms.subs = make(map[string]map[*signalSubscription]struct{})
+		}
+		if ms.subs[member] == nil {
+			ms.subs[member] = make(map[*signalSubscription]struct{})
+		}
+		ms.subs[member][s] = struct{}{}
+	}
+	ms.Unlock()
+
+	go s.run(deliver, closeCh)
+	if stopped != nil {
+		s.stop(stopped)
+	}
+	return s, nil
+}
+
+// stop ends all subscriptions, and the ones made later, with err.
+func (ms *managerSignals) stop(err error) {
+	ms.Lock()
+	subs := ms.subs
+	ms.subs = nil
+	if ms.stopped == nil {
+		ms.stopped = err
+	}
+	ms.Unlock()
+
+	for _, member := range subs {
+		for s := range member {
+			s.stop(err)
+		}
+	}
+}
+
+// handleSignal queues a signal of the Manager for its subscriptions.
+func (ms *managerSignals) handleSignal(signal *dbus.Signal) {
+	if !strings.HasPrefix(signal.Name, "org.freedesktop.systemd1.Manager.") {
+		return
+	}
+	member := strings.TrimPrefix(signal.Name, "org.freedesktop.systemd1.Manager.")
+
+	ms.Lock()
+	defer ms.Unlock()
+	for s := range ms.subs[member] {
+		s.mu.Lock()
+		if len(s.queue) == signalQueueSize {
+			s.queue = s.queue[1:]
+			s.dropped++
+		}
+		s.queue = append(s.queue, signal)
+		s.mu.Unlock()
+
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Dropped returns how many signals were dropped because the receiver fell
+// behind by more than 1024 signals. The oldest signals are dropped first.
+func (s *signalSubscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close stops the subscription, and closes its channel.
+func (s *signalSubscription) Close() {
+	s.once.Do(func() {
+		ms := &s.conn.managerSignals
+		ms.Lock()
+		delete(ms.subs[s.member], s)
+		ms.Unlock()
+		close(s.done)
+	})
+}
+
+// Err returns why the subscription's channel was closed: nil if it was closed
+// by Close, or an error if the connection was closed, or lost while
+// reconnecting is not enabled.
+func (s *signalSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// stop ends the subscription with err.
+func (s *signalSubscription) stop(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+func (s *signalSubscription) run(deliver func(*dbus.Signal, <-chan struct{}), closeCh func()) {
+	defer closeCh()
+
+	for {
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, signal := range queue {
+			deliver(signal, s.done)
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// ReloadingSubscription delivers systemd's Reloading signals.
+type ReloadingSubscription struct {
+	*signalSubscription
+	ch chan bool
+}
+
+// SubscribeReloading returns a subscription to systemd's Reloading signal,
+// which is sent when systemd starts reloading its configuration, e.g. on
+// daemon-reload, and once it is done. Subscribe is called if needed.
+func (c *Conn) SubscribeReloading() (*ReloadingSubscription, error) {
+	return c.SubscribeReloadingContext(context.Background())
+}
+
+// SubscribeReloadingContext is the same as SubscribeReloading with a context.
+func (c *Conn) SubscribeReloadingContext(ctx context.Context) (*ReloadingSubscription, error) {
+	s := &ReloadingSubscription{ch: make(chan bool)}
+	var err error
+	s.signalSubscription, err = c.subscribeSignal(ctx, "Reloading", func(signal *dbus.Signal, done <-chan struct{}) {
+		var active bool
+		if dbus.Store(signal.Body, &active) != nil {
+			return
+		}
+		select {
+		case s.ch <- active:
+		case <-done:
+		}
+	}, func() { close(s.ch) })
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reloading returns the channel the subscription's signals are sent to: true
+// when systemd starts reloading, false when it is done. The channel is closed
+// by Close, or once the connection is closed or lost, see Err.
+func (s *ReloadingSubscription) Reloading() <-chan bool {
+	return s.ch
+}
+
+// StartupFinishedSubscription delivers systemd's StartupFinished signals.
+type StartupFinishedSubscription struct {
+	*signalSubscription
+	ch chan BootTimes
+}
+
+// SubscribeStartupFinished returns a subscription to systemd's
+// StartupFinished signal, which is sent with the durations of the boot phases
+// once the boot finished. If the boot has already finished, no signal is sent:
+// call GetBootTimes after subscribing, which returns ErrBootNotFinished while
+// the system is still booting. Subscribe is called if needed.
+func (c *Conn) SubscribeStartupFinished() (*StartupFinishedSubscription, error) {
+	return c.SubscribeStartupFinishedContext(context.Background())
+}
+
+// SubscribeStartupFinishedContext is the same as SubscribeStartupFinished
+// with a context.
+func (c *Conn) SubscribeStartupFinishedContext(ctx context.Context) (*StartupFinishedSubscription, error) {
+	s := &StartupFinishedSubscription{ch: make(chan BootTimes)}
+	var err error
+	s.signalSubscription, err = c.subscribeSignal(ctx, "StartupFinished", func(signal *dbus.Signal, done <-chan struct{}) {
+		var firmware, loader, kernel, initrd, userspace, total uint64
+		if dbus.Store(signal.Body, &firmware, &loader, &kernel, &initrd, &userspace, &total) != nil {
+			return
+		}
+		usec := func(u uint64) time.Duration {
+			return time.Duration(u) * time.Microsecond
+		}
+		times := BootTimes{
+			Firmware:  usec(firmware),
+			Loader:    usec(loader),
+			Kernel:    usec(kernel),
+			InitRD:    usec(initrd),
+			Userspace: usec(userspace),
+			Total:     usec(total),
+		}
+		select {
+		case s.ch <- times:
+		case <-done:
+		}
+	}, func() { close(s.ch) })
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StartupFinished returns the channel the subscription's signals are sent to.
+// The channel is closed by Close, or once the connection is closed or lost,
+// see Err.
+func (s *StartupFinishedSubscription) StartupFinished() <-chan BootTimes {
+	return s.ch
+}
+
+// UnitFilesChangedSubscription delivers systemd's UnitFilesChanged signals.
+type UnitFilesChangedSubscription struct {
+	*signalSubscription
+	ch chan struct{}
+}
+
+// SubscribeUnitFilesChanged returns a subscription to systemd's
+// UnitFilesChanged signal, which is sent when unit files are enabled,
+// disabled, masked or otherwise changed through systemd. Subscribe is called
+// if needed.
+func (c *Conn) SubscribeUnitFilesChanged() (*UnitFilesChangedSubscription, error) {
+	return c.SubscribeUnitFilesChangedContext(context.Background())
+}
+
+// SubscribeUnitFilesChangedContext is the same as SubscribeUnitFilesChanged
+// with a context.
+func (c *Conn) SubscribeUnitFilesChangedContext(ctx context.Context) (*UnitFilesChangedSubscription, error) {
+	s := &UnitFilesChangedSubscription{ch: make(chan struct{})}
+	var err error
+	s.signalSubscription, err = c.subscribeSignal(ctx, "UnitFilesChanged", func(signal *dbus.Signal, done <-chan struct{}) {
+		select {
+		case s.ch <- struct{}{}:
+		case <-done:
+		}
+	}, func() { close(s.ch) })
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UnitFilesChanged returns the channel the subscription's signals are sent
+// to. The channel is closed by Close, or once the connection is closed or
+// lost, see Err.
+func (s *UnitFilesChangedSubscription) UnitFilesChanged() <-chan struct{} {
+	return s.ch
+}
+
+// UnitRemovedSubscription delivers systemd's UnitRemoved signals.
+type UnitRemovedSubscription struct {
+	*signalSubscription
+	ch chan UnitRemoved
+}
+
+// SubscribeUnitRemoved returns a subscription to systemd's UnitRemoved
+// signal, which is sent when a unit is unloaded. Subscribe is called if
+// needed.
+func (c *Conn) SubscribeUnitRemoved() (*UnitRemovedSubscription, error) {
+	return c.SubscribeUnitRemovedContext(context.Background())
+}
+
+// SubscribeUnitRemovedContext is the same as SubscribeUnitRemoved with a
+// context.
+func (c *Conn) SubscribeUnitRemovedContext(ctx context.Context) (*UnitRemovedSubscription, error) {
+	s := &UnitRemovedSubscription{ch: make(chan UnitRemoved)}
+	var err error
+	s.signalSubscription, err = c.subscribeSignal(ctx, "UnitRemoved", func(signal *dbus.Signal, done <-chan struct{}) {
+		var u UnitRemoved
+		if dbus.Store(signal.Body, &u.Name, &u.Path) != nil {
+			return
+		}
+		select {
+		case s.ch <- u:
+		case <-done:
+		}
+	}, func() { close(s.ch) })
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UnitRemoved returns the channel the subscription's signals are sent to.
+// The channel is closed by Close, or once the connection is closed or lost,
+// see Err.
+func (s *UnitRemovedSubscription) UnitRemoved() <-chan UnitRemoved {
+	return s.ch
+}
+
+// JobNewSubscription delivers systemd's JobNew signals.
+type JobNewSubscription struct {
+	*signalSubscription
+	ch chan JobNew
+}
+
+// SubscribeJobNew returns a subscription to systemd's JobNew signal, which is
+// sent when a job is enqueued. Subscribe is called if needed.
+func (c *Conn) SubscribeJobNew() (*JobNewSubscription, error) {
+	return c.SubscribeJobNewContext(context.Background())
+}
+
+// SubscribeJobNewContext is the same as SubscribeJobNew with a context.
+func (c *Conn) SubscribeJobNewContext(ctx context.Context) (*JobNewSubscription, error) {
+	s := &JobNewSubscription{ch: make(chan JobNew)}
+	var err error
+	s.signalSubscription, err = c.subscribeSignal(ctx, "JobNew", func(signal *dbus.Signal, done <-chan struct{}) {
+		var j JobNew
+		if dbus.Store(signal.Body, &j.ID, &j.Path, &j.Unit) != nil {
+			return
+		}
+		select {
+		case s.ch <- j:
+		case <-done:
+		}
+	}, func() { close(s.ch) })
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// JobNew returns the channel the subscription's signals are sent to. The
+// channel is closed by Close, or once the connection is closed or lost, see
+// Err.
+func (s *JobNewSubscription) JobNew() <-chan JobNew {
+	return s.ch
+}
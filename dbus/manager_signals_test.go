@@ -0,0 +1,221 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManagerSignals(t *testing.T) {
+	target := "start-stop.service"
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	reloading, err := conn.SubscribeReloading()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloading.Close()
+	startup, err := conn.SubscribeStartupFinished()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer startup.Close()
+	files, err := conn.SubscribeUnitFilesChanged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+	removed, err := conn.SubscribeUnitRemoved()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removed.Close()
+	jobs, err := conn.SubscribeJobNew()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobs.Close()
+
+	timeout := time.After(5 * time.Second)
+
+	if err := conn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// godbus does not preserve the order of signals.
+	seen := make(map[bool]bool)
+	for len(seen) < 2 {
+		select {
+		case active := <-reloading.Reloading():
+			seen[active] = true
+		case <-timeout:
+			t.Fatalf("Reached timeout, got Reloading %v", seen)
+		}
+	}
+
+	f.mu.Lock()
+	f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "StartupFinished",
+		uint64(1000), uint64(2000), uint64(3000), uint64(0), uint64(4000), uint64(10000))
+	f.mu.Unlock()
+	select {
+	case times := <-startup.StartupFinished():
+		if times.Firmware != time.Millisecond || times.Userspace != 4*time.Millisecond || times.Total != 10*time.Millisecond {
+			t.Fatalf("Unexpected boot times %+v", times)
+		}
+	case <-timeout:
+		t.Fatal("Reached timeout waiting for StartupFinished")
+	}
+
+	if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-files.UnitFilesChanged():
+	case <-timeout:
+		t.Fatal("Reached timeout waiting for UnitFilesChanged")
+	}
+
+	reschan := make(chan string)
+	id, err := conn.StartUnit(target, "replace", reschan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-reschan
+	select {
+	case j := <-jobs.JobNew():
+		if j.ID != uint32(id) || j.Path != jobPath(id) || j.Unit != target {
+			t.Fatalf("Unexpected JobNew %+v", j)
+		}
+	case <-timeout:
+		t.Fatal("Reached timeout waiting for JobNew")
+	}
+
+	if _, err := conn.StopUnit(target, "replace", reschan); err != nil {
+		t.Fatal(err)
+	}
+	<-reschan
+	select {
+	case u := <-removed.UnitRemoved():
+		if u.Name != target || u.Path != UnitPath(target) {
+			t.Fatalf("Unexpected UnitRemoved %+v", u)
+		}
+	case <-timeout:
+		t.Fatal("Reached timeout waiting for UnitRemoved")
+	}
+
+	jobs.Close()
+	if _, ok := <-jobs.JobNew(); ok {
+		t.Fatal("Channel not closed")
+	}
+}
+
+// TestManagerSignalsDropped ensures that signals are dropped, and counted,
+// once a receiver falls behind.
+func TestManagerSignalsDropped(t *testing.T) {
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	jobs, err := conn.SubscribeJobNew()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobs.Close()
+
+	const n = 3 * signalQueueSize
+	f.mu.Lock()
+	for i := uint32(1); i <= n; i++ {
+		f.emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", "JobNew", i, jobPath(int(i)), "fake.service")
+	}
+	f.mu.Unlock()
+
+	timeout := time.After(10 * time.Second)
+	for jobs.Dropped() == 0 {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("Reached timeout, no signal dropped")
+		}
+	}
+	var received uint64
+	for received+jobs.Dropped() < n {
+		select {
+		case <-jobs.JobNew():
+			received++
+		case <-timeout:
+			t.Fatalf("Reached timeout, received %d and dropped %d signals", received, jobs.Dropped())
+		}
+	}
+	if received > 2*signalQueueSize+1 {
+		t.Fatalf("Received %d signals, expected at most %d to be queued", received, 2*signalQueueSize+1)
+	}
+}
+
+// TestManagerSignalsClosed ensures that the subscriptions end once the
+// connection is closed or lost.
+func TestManagerSignalsClosed(t *testing.T) {
+	for _, lose := range []bool{false, true} {
+		f := newFakeSystemd()
+		conn := f.newConn(t)
+
+		reloading, err := conn.SubscribeReloading()
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := conn.SubscribeJobNew()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := errConnClosed
+		if lose {
+			want = errConnLost
+			f.stop()
+		} else {
+			conn.Close()
+		}
+
+		timeout := time.After(5 * time.Second)
+		select {
+		case _, ok := <-reloading.Reloading():
+			if ok {
+				t.Fatal("Unexpected Reloading signal")
+			}
+		case <-timeout:
+			t.Fatal("Reached timeout waiting for the Reloading channel to be closed")
+		}
+		select {
+		case _, ok := <-jobs.JobNew():
+			if ok {
+				t.Fatal("Unexpected JobNew signal")
+			}
+		case <-timeout:
+			t.Fatal("Reached timeout waiting for the JobNew channel to be closed")
+		}
+		if reloading.Err() != want || jobs.Err() != want {
+			t.Fatalf("Expected %v, got %v and %v", want, reloading.Err(), jobs.Err())
+		}
+
+		// Subscribing afterwards fails or ends right away.
+		if later, err := conn.SubscribeReloading(); err == nil {
+			if _, ok := <-later.Reloading(); ok || later.Err() != want {
+				t.Fatalf("Unexpected subscription after the connection ended: %v", later.Err())
+			}
+		}
+		conn.Close()
+	}
+}
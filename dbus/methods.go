@@ -15,9 +15,14 @@
 package dbus
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"path"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/godbus/dbus"
 )
@@ -37,14 +42,36 @@ func (c *Conn) jobComplete(signal *dbus.Signal) {
 	c.jobListener.Unlock()
 }
 
-func (c *Conn) startJob(ch chan<- string, job string, args ...interface{}) (int, error) {
+// callContext calls method on obj like BusObject.Call, but returns as soon as
+// ctx is done. godbus has no way to abort a call once it has been sent, so in
+// that case the reply, if it ever arrives, is discarded.
+func callContext(ctx context.Context, obj dbus.BusObject, method string, args ...interface{}) *dbus.Call {
+	select {
+	case <-ctx.Done():
+		return &dbus.Call{Err: ctx.Err()}
+	default:
+	}
+
+	call := obj.Go(method, 0, make(chan *dbus.Call, 1), args...)
+	select {
+	case call = <-call.Done:
+		call.Err = wrapError(call.Err)
+		return call
+	case <-ctx.Done():
+		return &dbus.Call{Err: ctx.Err()}
+	}
+}
+
+func (c *Conn) startJob(ctx context.Context, ch chan<- string, job string, args ...interface{}) (int, error) {
 	if ch != nil {
 		c.jobListener.Lock()
 		defer c.jobListener.Unlock()
 	}
 
+	// A reply arriving after ctx is done is dropped by callContext, so the
+	// job, if enqueued, is never tracked and nothing is sent to ch.
 	var p dbus.ObjectPath
-	err := c.sysobj.Call(job, 0, args...).Store(&p)
+	err := callContext(ctx, c.sysobj, job, args...).Store(&p)
 	if err != nil {
 		return 0, err
 	}
@@ -59,6 +86,39 @@ func (c *Conn) startJob(ch chan<- string, job string, args ...interface{}) (int,
 	return jobID, nil
 }
 
+// WaitJobContext waits for the job with the given ID to complete and returns
+// its result. ch must be the channel passed to the method which enqueued the
+// job, and must not be read from by anyone else.
+//
+// If ctx is done before the job completes, the job is no longer tracked, so
+// that nothing will be sent to ch, and ctx.Err() is returned. The job itself
+// is not canceled.
+func (c *Conn) WaitJobContext(ctx context.Context, id int, ch <-chan string) (string, error) {
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-ctx.Done():
+	}
+
+	// jobComplete holds the lock while sending the result, so keep
+	// receiving until the listener is gone.
+	removed := make(chan struct{})
+	go func() {
+		c.jobListener.Lock()
+		delete(c.jobListener.jobs, jobPath(id))
+		c.jobListener.Unlock()
+		close(removed)
+	}()
+
+	select {
+	case result := <-ch:
+		<-removed
+		return result, nil
+	case <-removed:
+		return "", ctx.Err()
+	}
+}
+
 // StartUnit enqueues a start job and depending jobs, if any (unless otherwise
 // specified by the mode string).
 //
@@ -90,42 +150,91 @@ func (c *Conn) startJob(ch chan<- string, job string, args ...interface{}) (int,
 //
 // If an error does occur, it will be returned to the user alongside a job ID of 0.
 func (c *Conn) StartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.StartUnit", name, mode)
+	return c.StartUnitContext(context.Background(), name, mode, ch)
+}
+
+// StartUnitContext is the same as StartUnit, but returns ctx.Err() if ctx is
+// done before systemd replied. The job may have been enqueued nonetheless, but
+// nothing is sent to ch then.
+func (c *Conn) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.StartUnit", name, mode)
 }
 
 // StopUnit is similar to StartUnit but stops the specified unit rather
 // than starting it.
 func (c *Conn) StopUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.StopUnit", name, mode)
+	return c.StopUnitContext(context.Background(), name, mode, ch)
+}
+
+// StopUnitContext is the same as StopUnit, but returns ctx.Err() if ctx is done
+// before systemd replied. The job may have been enqueued nonetheless, but
+// nothing is sent to ch then.
+func (c *Conn) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.StopUnit", name, mode)
 }
 
 // ReloadUnit reloads a unit.  Reloading is done only if the unit is already running and fails otherwise.
 func (c *Conn) ReloadUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.ReloadUnit", name, mode)
+	return c.ReloadUnitContext(context.Background(), name, mode, ch)
+}
+
+// ReloadUnitContext is the same as ReloadUnit, but returns ctx.Err() if ctx is
+// done before systemd replied. The job may have been enqueued nonetheless, but
+// nothing is sent to ch then.
+func (c *Conn) ReloadUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.ReloadUnit", name, mode)
 }
 
 // RestartUnit restarts a service.  If a service is restarted that isn't
 // running it will be started.
 func (c *Conn) RestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.RestartUnit", name, mode)
+	return c.RestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// RestartUnitContext is the same as RestartUnit, but returns ctx.Err() if ctx
+// is done before systemd replied. The job may have been enqueued nonetheless,
+// but nothing is sent to ch then.
+func (c *Conn) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.RestartUnit", name, mode)
 }
 
 // TryRestartUnit is like RestartUnit, except that a service that isn't running
 // is not affected by the restart.
 func (c *Conn) TryRestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.TryRestartUnit", name, mode)
+	return c.TryRestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// TryRestartUnitContext is the same as TryRestartUnit, but returns ctx.Err() if
+// ctx is done before systemd replied. The job may have been enqueued
+// nonetheless, but nothing is sent to ch then.
+func (c *Conn) TryRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.TryRestartUnit", name, mode)
 }
 
 // ReloadOrRestart attempts a reload if the unit supports it and use a restart
 // otherwise.
 func (c *Conn) ReloadOrRestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.ReloadOrRestartUnit", name, mode)
+	return c.ReloadOrRestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// ReloadOrRestartUnitContext is the same as ReloadOrRestartUnit, but returns
+// ctx.Err() if ctx is done before systemd replied. The job may have been
+// enqueued nonetheless, but nothing is sent to ch then.
+func (c *Conn) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.ReloadOrRestartUnit", name, mode)
 }
 
 // ReloadOrTryRestart attempts a reload if the unit supports it and use a "Try"
 // flavored restart otherwise.
 func (c *Conn) ReloadOrTryRestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.ReloadOrTryRestartUnit", name, mode)
+	return c.ReloadOrTryRestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// ReloadOrTryRestartUnitContext is the same as ReloadOrTryRestartUnit, but
+// returns ctx.Err() if ctx is done before systemd replied. The job may have
+// been enqueued nonetheless, but nothing is sent to ch then.
+func (c *Conn) ReloadOrTryRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.ReloadOrTryRestartUnit", name, mode)
 }
 
 // StartTransientUnit() may be used to create and start a transient unit, which
@@ -134,32 +243,192 @@ func (c *Conn) ReloadOrTryRestartUnit(name string, mode string, ch chan<- string
 // unique. mode is the same as in StartUnit(), properties contains properties
 // of the unit.
 func (c *Conn) StartTransientUnit(name string, mode string, properties []Property, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.StartTransientUnit", name, mode, properties, make([]PropertyCollection, 0))
+	return c.StartTransientUnitContext(context.Background(), name, mode, properties, ch)
+}
+
+// StartTransientUnitContext is the same as StartTransientUnit, but returns
+// ctx.Err() if ctx is done before systemd replied. The job may have been
+// enqueued nonetheless, but nothing is sent to ch then.
+func (c *Conn) StartTransientUnitContext(ctx context.Context, name string, mode string, properties []Property, ch chan<- string) (int, error) {
+	return c.StartTransientUnitAuxContext(ctx, name, mode, properties, nil, ch)
+}
+
+// StartTransientUnitAux is the same as StartTransientUnit, but also creates
+// the auxiliary transient units aux along with the unit, e.g. the service a
+// transient timer or socket unit activates.
+func (c *Conn) StartTransientUnitAux(name string, mode string, properties []Property, aux []PropertyCollection, ch chan<- string) (int, error) {
+	return c.StartTransientUnitAuxContext(context.Background(), name, mode, properties, aux, ch)
+}
+
+// StartTransientUnitAuxContext is the same as StartTransientUnitAux, but
+// returns ctx.Err() if ctx is done before systemd replied. The job may have
+// been enqueued nonetheless, but nothing is sent to ch then.
+func (c *Conn) StartTransientUnitAuxContext(ctx context.Context, name string, mode string, properties []Property, aux []PropertyCollection, ch chan<- string) (int, error) {
+	if aux == nil {
+		aux = make([]PropertyCollection, 0)
+	}
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.StartTransientUnit", name, mode, properties, aux)
+}
+
+// StartTransientTimer creates and starts the transient timer unit
+// name.timer, which activates the transient service name.service, like
+// 'systemd-run --on-calendar'. Both units are created with a single call.
+// timerProperties should contain at least one of PropOnCalendar,
+// PropOnActiveSec, PropOnBootSec or PropOnUnitActiveSec, and
+// serviceProperties at least PropExecStart. The job started is the one of the
+// timer, the service is only started when the timer elapses.
+func (c *Conn) StartTransientTimer(name string, mode string, timerProperties []Property, serviceProperties []Property, ch chan<- string) (int, error) {
+	return c.StartTransientTimerContext(context.Background(), name, mode, timerProperties, serviceProperties, ch)
+}
+
+// StartTransientTimerContext is the same as StartTransientTimer, but returns
+// ctx.Err() if ctx is done before systemd replied. The job may have been
+// enqueued nonetheless, but nothing is sent to ch then.
+func (c *Conn) StartTransientTimerContext(ctx context.Context, name string, mode string, timerProperties []Property, serviceProperties []Property, ch chan<- string) (int, error) {
+	aux := []PropertyCollection{{Name: name + ".service", Properties: serviceProperties}}
+	return c.StartTransientUnitAuxContext(ctx, name+".timer", mode, timerProperties, aux, ch)
 }
 
+// Who selects the processes of a unit a signal is sent to.
+type Who string
+
+const (
+	// WhoAll sends the signal to all processes of the unit.
+	WhoAll Who = "all"
+	// WhoMain sends the signal to the main process of the unit.
+	WhoMain Who = "main"
+	// WhoControl sends the signal to the control process of the unit,
+	// e.g. the one running ExecReload.
+	WhoControl Who = "control"
+)
+
 // KillUnit takes the unit name and a UNIX signal number to send.  All of the unit's
-// processes are killed.
+// processes are killed. Errors are ignored, see KillUnitWithTarget.
 func (c *Conn) KillUnit(name string, signal int32) {
-	c.sysobj.Call("org.freedesktop.systemd1.Manager.KillUnit", 0, name, "all", signal).Store()
+	c.KillUnitContext(context.Background(), name, signal)
+}
+
+// KillUnitContext is the same as KillUnit with a context.
+func (c *Conn) KillUnitContext(ctx context.Context, name string, signal int32) {
+	c.KillUnitWithTargetContext(ctx, name, WhoAll, signal)
+}
+
+// KillUnitWithTarget sends the UNIX signal number signal to the processes of
+// the unit name selected by target.
+func (c *Conn) KillUnitWithTarget(name string, target Who, signal int32) error {
+	return c.KillUnitWithTargetContext(context.Background(), name, target, signal)
+}
+
+// KillUnitWithTargetContext is the same as KillUnitWithTarget with a context.
+func (c *Conn) KillUnitWithTargetContext(ctx context.Context, name string, target Who, signal int32) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.KillUnit", name, string(target), signal).Store()
+}
+
+// QueueSignalUnit queues the realtime UNIX signal number signal, with value
+// as its payload, to the main or control process of the unit name, like
+// sigqueue(3). Requires systemd 254 or newer.
+func (c *Conn) QueueSignalUnit(name string, target Who, signal int32, value int32) error {
+	return c.QueueSignalUnitContext(context.Background(), name, target, signal, value)
+}
+
+// QueueSignalUnitContext is the same as QueueSignalUnit with a context.
+func (c *Conn) QueueSignalUnitContext(ctx context.Context, name string, target Who, signal int32, value int32) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.QueueSignalUnit", name, string(target), signal, value).Store()
+}
+
+// KillUnitSubgroup sends the UNIX signal number signal to all processes in
+// the control group subgroup of the unit name, relative to the unit's own
+// control group (e.g. "/foo"). Requires systemd 258 or newer.
+func (c *Conn) KillUnitSubgroup(name string, subgroup string, signal int32) error {
+	return c.KillUnitSubgroupContext(context.Background(), name, subgroup, signal)
+}
+
+// KillUnitSubgroupContext is the same as KillUnitSubgroup with a context.
+func (c *Conn) KillUnitSubgroupContext(ctx context.Context, name string, subgroup string, signal int32) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.KillUnitSubgroup", name, "cgroup", subgroup, signal).Store()
+}
+
+// TerminateUnit sends SIGTERM to all processes of the unit name and waits up
+// to timeout for the unit to become inactive. If it does not, SIGKILL is sent
+// to all its remaining processes, and true is returned. Unlike StopUnit, no
+// stop job is enqueued, so ExecStop and the unit's own stop timeout are not
+// involved. Subscribe is called if needed.
+func (c *Conn) TerminateUnit(name string, timeout time.Duration) (bool, error) {
+	return c.TerminateUnitContext(context.Background(), name, timeout)
+}
+
+// TerminateUnitContext is the same as TerminateUnit with a context. If ctx is
+// done before the unit became inactive, ctx.Err() is returned and SIGKILL is
+// not sent.
+func (c *Conn) TerminateUnitContext(ctx context.Context, name string, timeout time.Duration) (bool, error) {
+	// Subscribe before sending SIGTERM, so that the unit becoming inactive
+	// can't be missed.
+	sub, err := c.SubscribeUnitTransitionsContext(ctx, 16, TransitionCoalesce, func(unit string) bool { return unit != name })
+	if err != nil {
+		return false, err
+	}
+	defer sub.Close()
+
+	if err := c.KillUnitWithTargetContext(ctx, name, WhoAll, int32(syscall.SIGTERM)); err != nil {
+		return false, err
+	}
+
+	stopped := func(state interface{}) bool {
+		return state == "inactive" || state == "failed"
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	resync := true
+	for {
+		if resync {
+			prop, err := c.GetUnitPropertyContext(ctx, name, "ActiveState")
+			if err != nil {
+				return false, err
+			}
+			if stopped(prop.Value.Value()) {
+				return false, nil
+			}
+			resync = false
+		}
+
+		select {
+		case t := <-sub.Transitions():
+			if t.Overflow {
+				resync = true
+			} else if stopped(t.To.ActiveState) {
+				return false, nil
+			}
+		case <-deadline.C:
+			return true, c.KillUnitWithTargetContext(ctx, name, WhoAll, int32(syscall.SIGKILL))
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
 }
 
 // ResetFailedUnit resets the "failed" state of a specific unit.
 func (c *Conn) ResetFailedUnit(name string) error {
-	return c.sysobj.Call("org.freedesktop.systemd1.Manager.ResetFailedUnit", 0, name).Store()
+	return c.ResetFailedUnitContext(context.Background(), name)
+}
+
+// ResetFailedUnitContext is the same as ResetFailedUnit with a context.
+func (c *Conn) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ResetFailedUnit", name).Store()
 }
 
 // getProperties takes the unit name and returns all of its dbus object properties, for the given dbus interface
-func (c *Conn) getProperties(unit string, dbusInterface string) (map[string]interface{}, error) {
+func (c *Conn) getProperties(ctx context.Context, unit string, dbusInterface string) (map[string]interface{}, error) {
 	var err error
 	var props map[string]dbus.Variant
 
-	path := unitPath(unit)
+	path := UnitPath(unit)
 	if !path.IsValid() {
 		return nil, errors.New("invalid unit name: " + unit)
 	}
 
-	obj := c.sysconn.Object("org.freedesktop.systemd1", path)
-	err = obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, dbusInterface).Store(&props)
+	obj := c.object(path)
+	err = callContext(ctx, obj, "org.freedesktop.DBus.Properties.GetAll", dbusInterface).Store(&props)
 	if err != nil {
 		return nil, err
 	}
@@ -174,20 +443,25 @@ func (c *Conn) getProperties(unit string, dbusInterface string) (map[string]inte
 
 // GetUnitProperties takes the unit name and returns all of its dbus object properties.
 func (c *Conn) GetUnitProperties(unit string) (map[string]interface{}, error) {
-	return c.getProperties(unit, "org.freedesktop.systemd1.Unit")
+	return c.GetUnitPropertiesContext(context.Background(), unit)
 }
 
-func (c *Conn) getProperty(unit string, dbusInterface string, propertyName string) (*Property, error) {
+// GetUnitPropertiesContext is the same as GetUnitProperties with a context.
+func (c *Conn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]interface{}, error) {
+	return c.getProperties(ctx, unit, "org.freedesktop.systemd1.Unit")
+}
+
+func (c *Conn) getProperty(ctx context.Context, unit string, dbusInterface string, propertyName string) (*Property, error) {
 	var err error
 	var prop dbus.Variant
 
-	path := unitPath(unit)
+	path := UnitPath(unit)
 	if !path.IsValid() {
 		return nil, errors.New("invalid unit name: " + unit)
 	}
 
-	obj := c.sysconn.Object("org.freedesktop.systemd1", path)
-	err = obj.Call("org.freedesktop.DBus.Properties.Get", 0, dbusInterface, propertyName).Store(&prop)
+	obj := c.object(path)
+	err = callContext(ctx, obj, "org.freedesktop.DBus.Properties.Get", dbusInterface, propertyName).Store(&prop)
 	if err != nil {
 		return nil, err
 	}
@@ -196,19 +470,35 @@ func (c *Conn) getProperty(unit string, dbusInterface string, propertyName strin
 }
 
 func (c *Conn) GetUnitProperty(unit string, propertyName string) (*Property, error) {
-	return c.getProperty(unit, "org.freedesktop.systemd1.Unit", propertyName)
+	return c.GetUnitPropertyContext(context.Background(), unit, propertyName)
+}
+
+// GetUnitPropertyContext is the same as GetUnitProperty with a context.
+func (c *Conn) GetUnitPropertyContext(ctx context.Context, unit string, propertyName string) (*Property, error) {
+	return c.getProperty(ctx, unit, "org.freedesktop.systemd1.Unit", propertyName)
 }
 
 // GetServiceProperty returns property for given service name and property name
 func (c *Conn) GetServiceProperty(service string, propertyName string) (*Property, error) {
-	return c.getProperty(service, "org.freedesktop.systemd1.Service", propertyName)
+	return c.GetServicePropertyContext(context.Background(), service, propertyName)
+}
+
+// GetServicePropertyContext is the same as GetServiceProperty with a context.
+func (c *Conn) GetServicePropertyContext(ctx context.Context, service string, propertyName string) (*Property, error) {
+	return c.getProperty(ctx, service, "org.freedesktop.systemd1.Service", propertyName)
 }
 
 // GetUnitTypeProperties returns the extra properties for a unit, specific to the unit type.
 // Valid values for unitType: Service, Socket, Target, Device, Mount, Automount, Snapshot, Timer, Swap, Path, Slice, Scope
 // return "dbus.Error: Unknown interface" if the unitType is not the correct type of the unit
 func (c *Conn) GetUnitTypeProperties(unit string, unitType string) (map[string]interface{}, error) {
-	return c.getProperties(unit, "org.freedesktop.systemd1."+unitType)
+	return c.GetUnitTypePropertiesContext(context.Background(), unit, unitType)
+}
+
+// GetUnitTypePropertiesContext is the same as GetUnitTypeProperties with a
+// context.
+func (c *Conn) GetUnitTypePropertiesContext(ctx context.Context, unit string, unitType string) (map[string]interface{}, error) {
+	return c.getProperties(ctx, unit, "org.freedesktop.systemd1."+unitType)
 }
 
 // SetUnitProperties() may be used to modify certain unit properties at runtime.
@@ -219,11 +509,22 @@ func (c *Conn) GetUnitTypeProperties(unit string, unitType string) (map[string]i
 // to modify. properties are the settings to set, encoded as an array of property
 // name and value pairs.
 func (c *Conn) SetUnitProperties(name string, runtime bool, properties ...Property) error {
-	return c.sysobj.Call("org.freedesktop.systemd1.Manager.SetUnitProperties", 0, name, runtime, properties).Store()
+	return c.SetUnitPropertiesContext(context.Background(), name, runtime, properties...)
+}
+
+// SetUnitPropertiesContext is the same as SetUnitProperties with a context.
+func (c *Conn) SetUnitPropertiesContext(ctx context.Context, name string, runtime bool, properties ...Property) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.SetUnitProperties", name, runtime, properties).Store()
 }
 
 func (c *Conn) GetUnitTypeProperty(unit string, unitType string, propertyName string) (*Property, error) {
-	return c.getProperty(unit, "org.freedesktop.systemd1."+unitType, propertyName)
+	return c.GetUnitTypePropertyContext(context.Background(), unit, unitType, propertyName)
+}
+
+// GetUnitTypePropertyContext is the same as GetUnitTypeProperty with a
+// context.
+func (c *Conn) GetUnitTypePropertyContext(ctx context.Context, unit string, unitType string, propertyName string) (*Property, error) {
+	return c.getProperty(ctx, unit, "org.freedesktop.systemd1."+unitType, propertyName)
 }
 
 type UnitStatus struct {
@@ -271,13 +572,23 @@ func (c *Conn) listUnitsInternal(f storeFunc) ([]UnitStatus, error) {
 // units may be known by multiple names at the same time, and hence there might
 // be more unit names loaded than actual units behind them.
 func (c *Conn) ListUnits() ([]UnitStatus, error) {
-	return c.listUnitsInternal(c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnits", 0).Store)
+	return c.ListUnitsContext(context.Background())
+}
+
+// ListUnitsContext is the same as ListUnits with a context.
+func (c *Conn) ListUnitsContext(ctx context.Context) ([]UnitStatus, error) {
+	return c.listUnitsInternal(callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ListUnits").Store)
 }
 
 // ListUnitsFiltered returns an array with units filtered by state.
 // It takes a list of units' statuses to filter.
 func (c *Conn) ListUnitsFiltered(states []string) ([]UnitStatus, error) {
-	return c.listUnitsInternal(c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnitsFiltered", 0, states).Store)
+	return c.ListUnitsFilteredContext(context.Background(), states)
+}
+
+// ListUnitsFilteredContext is the same as ListUnitsFiltered with a context.
+func (c *Conn) ListUnitsFilteredContext(ctx context.Context, states []string) ([]UnitStatus, error) {
+	return c.listUnitsInternal(callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ListUnitsFiltered", states).Store)
 }
 
 // ListUnitsByPatterns returns an array with units.
@@ -285,7 +596,13 @@ func (c *Conn) ListUnitsFiltered(states []string) ([]UnitStatus, error) {
 // Note that units may be known by multiple names at the same time,
 // and hence there might be more unit names loaded than actual units behind them.
 func (c *Conn) ListUnitsByPatterns(states []string, patterns []string) ([]UnitStatus, error) {
-	return c.listUnitsInternal(c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnitsByPatterns", 0, states, patterns).Store)
+	return c.ListUnitsByPatternsContext(context.Background(), states, patterns)
+}
+
+// ListUnitsByPatternsContext is the same as ListUnitsByPatterns with a
+// context.
+func (c *Conn) ListUnitsByPatternsContext(ctx context.Context, states []string, patterns []string) ([]UnitStatus, error) {
+	return c.listUnitsInternal(callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ListUnitsByPatterns", states, patterns).Store)
 }
 
 // ListUnitsByNames returns an array with units. It takes a list of units'
@@ -293,7 +610,12 @@ func (c *Conn) ListUnitsByPatterns(states []string, patterns []string) ([]UnitSt
 // method, this method returns statuses even for inactive or non-existing
 // units. Input array should contain exact unit names, but not patterns.
 func (c *Conn) ListUnitsByNames(units []string) ([]UnitStatus, error) {
-	return c.listUnitsInternal(c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnitsByNames", 0, units).Store)
+	return c.ListUnitsByNamesContext(context.Background(), units)
+}
+
+// ListUnitsByNamesContext is the same as ListUnitsByNames with a context.
+func (c *Conn) ListUnitsByNamesContext(ctx context.Context, units []string) ([]UnitStatus, error) {
+	return c.listUnitsInternal(callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ListUnitsByNames", units).Store)
 }
 
 type UnitFile struct {
@@ -329,12 +651,23 @@ func (c *Conn) listUnitFilesInternal(f storeFunc) ([]UnitFile, error) {
 
 // ListUnitFiles returns an array of all available units on disk.
 func (c *Conn) ListUnitFiles() ([]UnitFile, error) {
-	return c.listUnitFilesInternal(c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnitFiles", 0).Store)
+	return c.ListUnitFilesContext(context.Background())
+}
+
+// ListUnitFilesContext is the same as ListUnitFiles with a context.
+func (c *Conn) ListUnitFilesContext(ctx context.Context) ([]UnitFile, error) {
+	return c.listUnitFilesInternal(callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ListUnitFiles").Store)
 }
 
 // ListUnitFilesByPatterns returns an array of all available units on disk matched the patterns.
 func (c *Conn) ListUnitFilesByPatterns(states []string, patterns []string) ([]UnitFile, error) {
-	return c.listUnitFilesInternal(c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnitFilesByPatterns", 0, states, patterns).Store)
+	return c.ListUnitFilesByPatternsContext(context.Background(), states, patterns)
+}
+
+// ListUnitFilesByPatternsContext is the same as ListUnitFilesByPatterns with
+// a context.
+func (c *Conn) ListUnitFilesByPatternsContext(ctx context.Context, states []string, patterns []string) ([]UnitFile, error) {
+	return c.listUnitFilesInternal(callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ListUnitFilesByPatterns", states, patterns).Store)
 }
 
 type LinkUnitFileChange EnableUnitFileChange
@@ -354,8 +687,13 @@ type LinkUnitFileChange EnableUnitFileChange
 // or unlink), the file name of the symlink and the destination of the
 // symlink.
 func (c *Conn) LinkUnitFiles(files []string, runtime bool, force bool) ([]LinkUnitFileChange, error) {
+	return c.LinkUnitFilesContext(context.Background(), files, runtime, force)
+}
+
+// LinkUnitFilesContext is the same as LinkUnitFiles with a context.
+func (c *Conn) LinkUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) ([]LinkUnitFileChange, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.LinkUnitFiles", 0, files, runtime, force).Store(&result)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.LinkUnitFiles", files, runtime, force).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -396,10 +734,15 @@ func (c *Conn) LinkUnitFiles(files []string, runtime bool, force bool) ([]LinkUn
 // or unlink), the file name of the symlink and the destination of the
 // symlink.
 func (c *Conn) EnableUnitFiles(files []string, runtime bool, force bool) (bool, []EnableUnitFileChange, error) {
+	return c.EnableUnitFilesContext(context.Background(), files, runtime, force)
+}
+
+// EnableUnitFilesContext is the same as EnableUnitFiles with a context.
+func (c *Conn) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []EnableUnitFileChange, error) {
 	var carries_install_info bool
 
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.EnableUnitFiles", 0, files, runtime, force).Store(&carries_install_info, &result)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.EnableUnitFiles", files, runtime, force).Store(&carries_install_info, &result)
 	if err != nil {
 		return false, nil, err
 	}
@@ -442,8 +785,13 @@ type EnableUnitFileChange struct {
 // symlink or unlink), the file name of the symlink and the destination of the
 // symlink.
 func (c *Conn) DisableUnitFiles(files []string, runtime bool) ([]DisableUnitFileChange, error) {
+	return c.DisableUnitFilesContext(context.Background(), files, runtime)
+}
+
+// DisableUnitFilesContext is the same as DisableUnitFiles with a context.
+func (c *Conn) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]DisableUnitFileChange, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.DisableUnitFiles", 0, files, runtime).Store(&result)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.DisableUnitFiles", files, runtime).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -483,8 +831,13 @@ type DisableUnitFileChange struct {
 //     only (true, /run/systemd/..), or persistently (false, /etc/systemd/..)
 //   * force flag
 func (c *Conn) MaskUnitFiles(files []string, runtime bool, force bool) ([]MaskUnitFileChange, error) {
+	return c.MaskUnitFilesContext(context.Background(), files, runtime, force)
+}
+
+// MaskUnitFilesContext is the same as MaskUnitFiles with a context.
+func (c *Conn) MaskUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) ([]MaskUnitFileChange, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.MaskUnitFiles", 0, files, runtime, force).Store(&result)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.MaskUnitFiles", files, runtime, force).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -523,8 +876,13 @@ type MaskUnitFileChange struct {
 //   * runtime to specify whether the unit was enabled for runtime
 //     only (true, /run/systemd/..), or persistently (false, /etc/systemd/..)
 func (c *Conn) UnmaskUnitFiles(files []string, runtime bool) ([]UnmaskUnitFileChange, error) {
+	return c.UnmaskUnitFilesContext(context.Background(), files, runtime)
+}
+
+// UnmaskUnitFilesContext is the same as UnmaskUnitFiles with a context.
+func (c *Conn) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]UnmaskUnitFileChange, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.UnmaskUnitFiles", 0, files, runtime).Store(&result)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.UnmaskUnitFiles", files, runtime).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -557,9 +915,460 @@ type UnmaskUnitFileChange struct {
 // Reload instructs systemd to scan for and reload unit files. This is
 // equivalent to a 'systemctl daemon-reload'.
 func (c *Conn) Reload() error {
-	return c.sysobj.Call("org.freedesktop.systemd1.Manager.Reload", 0).Store()
+	return c.ReloadContext(context.Background())
+}
+
+// ReloadContext is the same as Reload with a context.
+func (c *Conn) ReloadContext(ctx context.Context) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.Reload").Store()
+}
+
+// GetUnitByPID returns the object path of the unit the process with the given
+// PID belongs to.
+func (c *Conn) GetUnitByPID(pid uint32) (dbus.ObjectPath, error) {
+	return c.GetUnitByPIDContext(context.Background(), pid)
+}
+
+// GetUnitByPIDContext is the same as GetUnitByPID with a context.
+func (c *Conn) GetUnitByPIDContext(ctx context.Context, pid uint32) (dbus.ObjectPath, error) {
+	var p dbus.ObjectPath
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetUnitByPID", pid).Store(&p)
+	return p, err
+}
+
+// GetUnitByInvocationID returns the object path of the unit with the given
+// 128-bit invocation ID. Requires systemd 232 or newer.
+func (c *Conn) GetUnitByInvocationID(id []byte) (dbus.ObjectPath, error) {
+	return c.GetUnitByInvocationIDContext(context.Background(), id)
+}
+
+// GetUnitByInvocationIDContext is the same as GetUnitByInvocationID with a
+// context.
+func (c *Conn) GetUnitByInvocationIDContext(ctx context.Context, id []byte) (dbus.ObjectPath, error) {
+	var p dbus.ObjectPath
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetUnitByInvocationID", id).Store(&p)
+	return p, err
+}
+
+// LoadUnit loads the unit with the given name, if it is not loaded yet, and
+// returns its object path.
+func (c *Conn) LoadUnit(name string) (dbus.ObjectPath, error) {
+	return c.LoadUnitContext(context.Background(), name)
+}
+
+// LoadUnitContext is the same as LoadUnit with a context.
+func (c *Conn) LoadUnitContext(ctx context.Context, name string) (dbus.ObjectPath, error) {
+	var p dbus.ObjectPath
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.LoadUnit", name).Store(&p)
+	return p, err
+}
+
+// Reexecute serializes the state of systemd, reexecutes it and deserializes
+// the state again. This is equivalent to a 'systemctl daemon-reexec'.
+//
+// systemd does not reply to this call, it returns once systemd disconnected.
+// Connections made directly to systemd are lost then.
+func (c *Conn) Reexecute() error {
+	return c.ReexecuteContext(context.Background())
+}
+
+// ReexecuteContext is the same as Reexecute with a context.
+func (c *Conn) ReexecuteContext(ctx context.Context) error {
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.Reexecute").Store()
+	if errors.Is(err, ErrNoReply) {
+		return nil
+	}
+	return err
+}
+
+// Dump returns a human readable dump of the state of systemd, as printed by
+// 'systemd-analyze dump'. Its format is not stable.
+func (c *Conn) Dump() (string, error) {
+	return c.DumpContext(context.Background())
+}
+
+// DumpContext is the same as Dump with a context.
+func (c *Conn) DumpContext(ctx context.Context) (string, error) {
+	var dump string
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.Dump").Store(&dump)
+	return dump, err
+}
+
+// SetEnvironment sets environment variables passed to all processes spawned
+// by systemd. The assignments take the form "KEY=value".
+func (c *Conn) SetEnvironment(assignments []string) error {
+	return c.SetEnvironmentContext(context.Background(), assignments)
+}
+
+// SetEnvironmentContext is the same as SetEnvironment with a context.
+func (c *Conn) SetEnvironmentContext(ctx context.Context, assignments []string) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.SetEnvironment", assignments).Store()
+}
+
+// UnsetEnvironment unsets environment variables passed to all processes
+// spawned by systemd. names may be either variable names or assignments, in
+// which case a variable is only unset if it has the given value.
+func (c *Conn) UnsetEnvironment(names []string) error {
+	return c.UnsetEnvironmentContext(context.Background(), names)
+}
+
+// UnsetEnvironmentContext is the same as UnsetEnvironment with a context.
+func (c *Conn) UnsetEnvironmentContext(ctx context.Context, names []string) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.UnsetEnvironment", names).Store()
+}
+
+// UnsetAndSetEnvironment atomically unsets and then sets environment
+// variables passed to all processes spawned by systemd, see UnsetEnvironment
+// and SetEnvironment.
+func (c *Conn) UnsetAndSetEnvironment(names []string, assignments []string) error {
+	return c.UnsetAndSetEnvironmentContext(context.Background(), names, assignments)
+}
+
+// UnsetAndSetEnvironmentContext is the same as UnsetAndSetEnvironment with a
+// context.
+func (c *Conn) UnsetAndSetEnvironmentContext(ctx context.Context, names []string, assignments []string) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.UnsetAndSetEnvironment", names, assignments).Store()
+}
+
+// GetDefaultTarget returns the name of the default target, i.e. the unit
+// default.target is linked to.
+func (c *Conn) GetDefaultTarget() (string, error) {
+	return c.GetDefaultTargetContext(context.Background())
+}
+
+// GetDefaultTargetContext is the same as GetDefaultTarget with a context.
+func (c *Conn) GetDefaultTargetContext(ctx context.Context) (string, error) {
+	var name string
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetDefaultTarget").Store(&name)
+	return name, err
 }
 
-func unitPath(name string) dbus.ObjectPath {
+// SetDefaultTarget links default.target to the given target. force controls
+// whether an existing link shall be replaced. It returns the changes made.
+func (c *Conn) SetDefaultTarget(name string, force bool) ([]UnitFileChange, error) {
+	return c.SetDefaultTargetContext(context.Background(), name, force)
+}
+
+// SetDefaultTargetContext is the same as SetDefaultTarget with a context.
+func (c *Conn) SetDefaultTargetContext(ctx context.Context, name string, force bool) ([]UnitFileChange, error) {
+	result := make([][]interface{}, 0)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.SetDefaultTarget", name, force).Store(&result)
+	if err != nil {
+		return nil, err
+	}
+	return unitFileChanges(result)
+}
+
+// PresetUnitFiles enables or disables the given unit files according to the
+// preset policy. runtime and force have the same meaning as for
+// EnableUnitFiles.
+//
+// This call returns whether the unit files contained any enablement
+// information and the changes made.
+func (c *Conn) PresetUnitFiles(files []string, runtime bool, force bool) (bool, []UnitFileChange, error) {
+	return c.PresetUnitFilesContext(context.Background(), files, runtime, force)
+}
+
+// PresetUnitFilesContext is the same as PresetUnitFiles with a context.
+func (c *Conn) PresetUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []UnitFileChange, error) {
+	return c.installUnitFiles(ctx, "org.freedesktop.systemd1.Manager.PresetUnitFiles", files, runtime, force)
+}
+
+// PresetAllUnitFiles enables or disables all unit files according to the
+// preset policy. mode is one of "full", "enable-only" or "disable-only".
+// runtime and force have the same meaning as for EnableUnitFiles.
+func (c *Conn) PresetAllUnitFiles(mode string, runtime bool, force bool) ([]UnitFileChange, error) {
+	return c.PresetAllUnitFilesContext(context.Background(), mode, runtime, force)
+}
+
+// PresetAllUnitFilesContext is the same as PresetAllUnitFiles with a context.
+func (c *Conn) PresetAllUnitFilesContext(ctx context.Context, mode string, runtime bool, force bool) ([]UnitFileChange, error) {
+	result := make([][]interface{}, 0)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.PresetAllUnitFiles", mode, runtime, force).Store(&result)
+	if err != nil {
+		return nil, err
+	}
+	return unitFileChanges(result)
+}
+
+// ReenableUnitFiles disables and then enables the given unit files again.
+// The arguments and return values are the same as for EnableUnitFiles.
+func (c *Conn) ReenableUnitFiles(files []string, runtime bool, force bool) (bool, []UnitFileChange, error) {
+	return c.ReenableUnitFilesContext(context.Background(), files, runtime, force)
+}
+
+// ReenableUnitFilesContext is the same as ReenableUnitFiles with a context.
+func (c *Conn) ReenableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []UnitFileChange, error) {
+	return c.installUnitFiles(ctx, "org.freedesktop.systemd1.Manager.ReenableUnitFiles", files, runtime, force)
+}
+
+// installUnitFiles calls a method taking unit files, runtime and force, and
+// returning whether the unit files carry install information and the changes
+// made.
+func (c *Conn) installUnitFiles(ctx context.Context, method string, files []string, runtime bool, force bool) (bool, []UnitFileChange, error) {
+	var carriesInstallInfo bool
+	result := make([][]interface{}, 0)
+	err := callContext(ctx, c.sysobj, method, files, runtime, force).Store(&carriesInstallInfo, &result)
+	if err != nil {
+		return false, nil, err
+	}
+
+	changes, err := unitFileChanges(result)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return carriesInstallInfo, changes, nil
+}
+
+// GetUnitFileState returns the enablement state of a unit file, e.g.
+// "enabled", "disabled", "static" or "masked".
+func (c *Conn) GetUnitFileState(file string) (string, error) {
+	return c.GetUnitFileStateContext(context.Background(), file)
+}
+
+// GetUnitFileStateContext is the same as GetUnitFileState with a context.
+func (c *Conn) GetUnitFileStateContext(ctx context.Context, file string) (string, error) {
+	var state string
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetUnitFileState", file).Store(&state)
+	return state, err
+}
+
+// GetUnitFileLinks returns the symlinks pointing to a unit file, either the
+// runtime (true, /run) or the persistent (false, /etc) ones. Requires systemd
+// 236 or newer.
+func (c *Conn) GetUnitFileLinks(name string, runtime bool) ([]string, error) {
+	return c.GetUnitFileLinksContext(context.Background(), name, runtime)
+}
+
+// GetUnitFileLinksContext is the same as GetUnitFileLinks with a context.
+func (c *Conn) GetUnitFileLinksContext(ctx context.Context, name string, runtime bool) ([]string, error) {
+	var links []string
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetUnitFileLinks", name, runtime).Store(&links)
+	return links, err
+}
+
+// AddDependencyUnitFiles adds a dependency of the given type, either "Wants"
+// or "Requires", from target to the given unit files, by creating symlinks in
+// the target's .wants or .requires directory. runtime and force have the same
+// meaning as for EnableUnitFiles.
+func (c *Conn) AddDependencyUnitFiles(files []string, target string, depType string, runtime bool, force bool) ([]UnitFileChange, error) {
+	return c.AddDependencyUnitFilesContext(context.Background(), files, target, depType, runtime, force)
+}
+
+// AddDependencyUnitFilesContext is the same as AddDependencyUnitFiles with a
+// context.
+func (c *Conn) AddDependencyUnitFilesContext(ctx context.Context, files []string, target string, depType string, runtime bool, force bool) ([]UnitFileChange, error) {
+	result := make([][]interface{}, 0)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.AddDependencyUnitFiles", files, target, depType, runtime, force).Store(&result)
+	if err != nil {
+		return nil, err
+	}
+	return unitFileChanges(result)
+}
+
+// RevertUnitFiles removes the drop-ins and overriding unit files of the given
+// units, as well as their masks, reverting them to their vendor version.
+// Requires systemd 230 or newer.
+func (c *Conn) RevertUnitFiles(files []string) ([]UnitFileChange, error) {
+	return c.RevertUnitFilesContext(context.Background(), files)
+}
+
+// RevertUnitFilesContext is the same as RevertUnitFiles with a context.
+func (c *Conn) RevertUnitFilesContext(ctx context.Context, files []string) ([]UnitFileChange, error) {
+	result := make([][]interface{}, 0)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.RevertUnitFiles", files).Store(&result)
+	if err != nil {
+		return nil, err
+	}
+	return unitFileChanges(result)
+}
+
+// UnitFileChange is a change made to the unit files.
+type UnitFileChange struct {
+	Type        string // Type of the change (one of symlink or unlink)
+	Filename    string // File name of the symlink
+	Destination string // Destination of the symlink
+}
+
+func unitFileChanges(result [][]interface{}) ([]UnitFileChange, error) {
+	resultInterface := make([]interface{}, len(result))
+	for i := range result {
+		resultInterface[i] = result[i]
+	}
+
+	changes := make([]UnitFileChange, len(result))
+	changesInterface := make([]interface{}, len(changes))
+	for i := range changes {
+		changesInterface[i] = &changes[i]
+	}
+
+	err := dbus.Store(resultInterface, changesInterface...)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// AttachProcessesToUnit moves the processes with the given PIDs into the
+// control group of a running unit, or the given sub-control group of it
+// (e.g. "/foo", or "" for the unit's own control group). Requires systemd 238
+// or newer.
+func (c *Conn) AttachProcessesToUnit(name string, subcgroup string, pids []uint32) error {
+	return c.AttachProcessesToUnitContext(context.Background(), name, subcgroup, pids)
+}
+
+// AttachProcessesToUnitContext is the same as AttachProcessesToUnit with a
+// context.
+func (c *Conn) AttachProcessesToUnitContext(ctx context.Context, name string, subcgroup string, pids []uint32) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.AttachProcessesToUnit", name, subcgroup, pids).Store()
+}
+
+// UnitProcess is a process in the control group of a unit.
+type UnitProcess struct {
+	Path    string // The control group path of the process
+	PID     uint32 // The process ID
+	Command string // The command line of the process
+}
+
+// GetUnitProcesses returns the processes in the control group of a unit.
+// Requires systemd 238 or newer.
+func (c *Conn) GetUnitProcesses(name string) ([]UnitProcess, error) {
+	return c.GetUnitProcessesContext(context.Background(), name)
+}
+
+// GetUnitProcessesContext is the same as GetUnitProcesses with a context.
+func (c *Conn) GetUnitProcessesContext(ctx context.Context, name string) ([]UnitProcess, error) {
+	result := make([][]interface{}, 0)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.GetUnitProcesses", name).Store(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	resultInterface := make([]interface{}, len(result))
+	for i := range result {
+		resultInterface[i] = result[i]
+	}
+
+	processes := make([]UnitProcess, len(result))
+	processesInterface := make([]interface{}, len(processes))
+	for i := range processes {
+		processesInterface[i] = &processes[i]
+	}
+
+	err = dbus.Store(resultInterface, processesInterface...)
+	if err != nil {
+		return nil, err
+	}
+
+	return processes, nil
+}
+
+// CleanUnit removes the runtime, state, cache, logs or configuration
+// directories of a stopped unit. mask selects them, and may contain
+// "runtime", "state", "cache", "logs", "configuration", "fdstore" and "all".
+// Requires systemd 243 or newer.
+func (c *Conn) CleanUnit(name string, mask []string) error {
+	return c.CleanUnitContext(context.Background(), name, mask)
+}
+
+// CleanUnitContext is the same as CleanUnit with a context.
+func (c *Conn) CleanUnitContext(ctx context.Context, name string, mask []string) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.CleanUnit", name, mask).Store()
+}
+
+// FreezeUnit freezes all processes of a unit using the cgroup freezer.
+// Requires systemd 246 or newer and the unified cgroup hierarchy.
+func (c *Conn) FreezeUnit(name string) error {
+	return c.FreezeUnitContext(context.Background(), name)
+}
+
+// FreezeUnitContext is the same as FreezeUnit with a context.
+func (c *Conn) FreezeUnitContext(ctx context.Context, name string) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.FreezeUnit", name).Store()
+}
+
+// ThawUnit thaws a unit frozen by FreezeUnit. Requires systemd 246 or newer.
+func (c *Conn) ThawUnit(name string) error {
+	return c.ThawUnitContext(context.Background(), name)
+}
+
+// ThawUnitContext is the same as ThawUnit with a context.
+func (c *Conn) ThawUnitContext(ctx context.Context, name string) error {
+	return callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.ThawUnit", name).Store()
+}
+
+// EnqueueUnitJob enqueues a job of the given type (e.g. "start", "stop",
+// "restart" or "reload") for a unit. mode is the same as for StartUnit.
+//
+// It returns the enqueued job and the other jobs which have been enqueued
+// along with it, e.g. for the unit's dependencies. Subscribe is called if
+// needed, so that waiting for the job does not have to. Requires systemd 242
+// or newer.
+func (c *Conn) EnqueueUnitJob(name string, jobType string, mode string) (*Job, []Job, error) {
+	return c.EnqueueUnitJobContext(context.Background(), name, jobType, mode)
+}
+
+// EnqueueUnitJobContext is the same as EnqueueUnitJob with a context.
+func (c *Conn) EnqueueUnitJobContext(ctx context.Context, name string, jobType string, mode string) (*Job, []Job, error) {
+	if err := c.subscribeIfNeeded(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	job := &Job{conn: c}
+	result := make([][]interface{}, 0)
+	err := callContext(ctx, c.sysobj, "org.freedesktop.systemd1.Manager.EnqueueUnitJob", name, jobType, mode).Store(
+		&job.ID, &job.Path, &job.Unit, &job.UnitPath, &job.Type, &result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	affected := make([]Job, len(result))
+	for i, r := range result {
+		j := &affected[i]
+		err = dbus.Store(r, &j.ID, &j.Path, &j.Unit, &j.UnitPath, &j.Type)
+		if err != nil {
+			return nil, nil, err
+		}
+		j.conn = c
+	}
+
+	return job, affected, nil
+}
+
+// UnitPath returns the object path of the unit name, without looking it up.
+// Signals about a unit loaded under several names are sent for the path of its
+// primary name, see LoadUnit for the lookup.
+func UnitPath(name string) dbus.ObjectPath {
 	return dbus.ObjectPath("/org/freedesktop/systemd1/unit/" + PathBusEscape(name))
 }
+
+// UnitNameFromPath returns the unit name encoded in a unit object path, as
+// returned by UnitPath. An error is returned if path is not a valid unit
+// object path.
+func UnitNameFromPath(path dbus.ObjectPath) (string, error) {
+	const prefix = "/org/freedesktop/systemd1/unit/"
+	if !strings.HasPrefix(string(path), prefix) {
+		return "", fmt.Errorf("%s is not a unit object path", path)
+	}
+	return PathBusUnescape(strings.TrimPrefix(string(path), prefix))
+}
+
+// JobIDFromPath returns the numeric id of the job with the given object
+// path. An error is returned if path is not a valid job object path.
+func JobIDFromPath(path dbus.ObjectPath) (uint32, error) {
+	const prefix = "/org/freedesktop/systemd1/job/"
+	if !strings.HasPrefix(string(path), prefix) {
+		return 0, fmt.Errorf("%s is not a job object path", path)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(string(path), prefix), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a job object path", path)
+	}
+	return uint32(id), nil
+}
+
+func jobPath(id int) dbus.ObjectPath {
+	return dbus.ObjectPath("/org/freedesktop/systemd1/job/" + strconv.Itoa(id))
+}
@@ -15,6 +15,7 @@
 package dbus
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -22,12 +23,25 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/godbus/dbus"
 )
 
+// requireSystemd skips the test unless it runs as root on a system booted
+// with systemd, as needed to test against the real systemd. Tests which don't
+// need it use fakeSystemd instead.
+func requireSystemd(t *testing.T) {
+	if _, err := os.Stat("/run/systemd/system"); err != nil || os.Geteuid() != 0 {
+		t.Skip("testing systemd requires root on a system booted with systemd")
+	}
+}
+
 func setupConn(t *testing.T) *Conn {
+	requireSystemd(t)
+
 	conn, err := New()
 	if err != nil {
 		t.Fatal(err)
@@ -407,6 +421,43 @@ func TestGetServiceProperty(t *testing.T) {
 	}
 }
 
+// TestGetTypedProperties reads the `-.mount` and `systemd-udevd.service`
+// units, which should exist on all systemd systems, into their typed
+// property structs.
+func TestGetTypedProperties(t *testing.T) {
+	conn := setupConn(t)
+
+	unit, err := conn.GetTypedUnitProperties("-.mount")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unit.Id != "-.mount" {
+		t.Fatalf("unexpected unit Id %q", unit.Id)
+	}
+
+	mount, err := conn.GetMountProperties("-.mount")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mount.Where != "/" {
+		t.Fatalf("unexpected mount point %q", mount.Where)
+	}
+
+	service, err := conn.GetServiceProperties("systemd-udevd.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if service.Type == "" {
+		t.Fatal("invalid service type")
+	}
+	if len(service.ExecStart) == 0 {
+		t.Fatal("service has no ExecStart")
+	}
+}
+
 // TestSetUnitProperties changes a cgroup setting on the `-.mount`
 // which should exist on all systemd systems and ensures that the
 // property was set.
@@ -553,6 +604,125 @@ func TestConnJobListener(t *testing.T) {
 	}
 }
 
+func TestStartStopUnitContext(t *testing.T) {
+	target := "start-stop.service"
+	conn := setupConn(t)
+
+	setupUnit(target, conn, t)
+	linkUnit(target, conn, t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reschan := make(chan string)
+	id, err := conn.StartUnitContext(ctx, target, "replace", reschan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := conn.WaitJobContext(ctx, id, reschan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job != "done" {
+		t.Fatal("Job is not done:", job)
+	}
+
+	id, err = conn.StopUnitContext(ctx, target, "replace", reschan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = conn.WaitJobContext(ctx, id, reschan); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hangingObject is a dbus.BusObject whose method calls never complete.
+type hangingObject struct {
+	dbus.BusObject
+}
+
+func (hangingObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return &dbus.Call{Method: method, Args: args, Done: ch}
+}
+
+func TestCallContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := callContext(ctx, hangingObject{}, "org.freedesktop.systemd1.Manager.ListUnits").Store()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	err = callContext(ctx, hangingObject{}, "org.freedesktop.systemd1.Manager.ListUnits").Store()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded for expired context, got %v", err)
+	}
+}
+
+func TestWaitJobContextCanceled(t *testing.T) {
+	conn := &Conn{}
+	conn.jobListener.jobs = make(map[dbus.ObjectPath]chan<- string)
+
+	reschan := make(chan string)
+	conn.jobListener.jobs[jobPath(42)] = reschan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := conn.WaitJobContext(ctx, 42, reschan); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if len(conn.jobListener.jobs) != 0 {
+		t.Fatal("JobListener jobs leaked")
+	}
+}
+
+// lateObject is a dbus.BusObject whose method calls complete once reply is
+// called.
+type lateObject struct {
+	dbus.BusObject
+	calls chan *dbus.Call
+}
+
+func (o lateObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	call := &dbus.Call{Method: method, Args: args, Done: ch}
+	o.calls <- call
+	return call
+}
+
+func TestStartUnitContextLateReply(t *testing.T) {
+	obj := lateObject{calls: make(chan *dbus.Call, 1)}
+	conn := &Conn{sysobj: obj}
+	conn.jobListener.jobs = make(map[dbus.ObjectPath]chan<- string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	reschan := make(chan string, 1)
+	if _, err := conn.StartUnitContext(ctx, "late.service", "replace", reschan); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// systemd enqueued the job after all.
+	call := <-obj.calls
+	call.Body = []interface{}{jobPath(42)}
+	call.Done <- call
+
+	conn.jobComplete(&dbus.Signal{Body: []interface{}{uint32(42), jobPath(42), "late.service", "done"}})
+	if len(conn.jobListener.jobs) != 0 {
+		t.Fatal("JobListener jobs leaked")
+	}
+	select {
+	case result := <-reschan:
+		t.Fatalf("Unexpected result %q", result)
+	default:
+	}
+}
+
 // Enables a unit and then masks/unmasks it
 func TestMaskUnmask(t *testing.T) {
 	target := "mask-unmask.service"
@@ -605,3 +775,303 @@ func TestMaskUnmask(t *testing.T) {
 	}
 
 }
+
+// TestManagerMethodArgs checks the arguments and replies of the Manager
+// methods which only forward their arguments.
+func TestManagerMethodArgs(t *testing.T) {
+	var gotMethod string
+	var gotArgs []interface{}
+	var reply []interface{}
+	conn := &Conn{}
+	conn.sysobj = replyObject{reply: func(method string, args ...interface{}) ([]interface{}, error) {
+		gotMethod, gotArgs = method, args
+		return reply, nil
+	}}
+
+	changes := [][]interface{}{{"symlink", "/etc/systemd/system/default.target", "/usr/lib/systemd/system/multi-user.target"}}
+	wantChanges := []UnitFileChange{{"symlink", "/etc/systemd/system/default.target", "/usr/lib/systemd/system/multi-user.target"}}
+
+	for _, tt := range []struct {
+		method string
+		reply  []interface{}
+		call   func() (interface{}, error)
+		args   []interface{}
+		want   interface{}
+	}{
+		{
+			"GetUnitByPID", []interface{}{UnitPath("foo.service")},
+			func() (interface{}, error) { return conn.GetUnitByPID(1) },
+			[]interface{}{uint32(1)}, UnitPath("foo.service"),
+		},
+		{
+			"GetUnitByInvocationID", []interface{}{UnitPath("foo.service")},
+			func() (interface{}, error) { return conn.GetUnitByInvocationID([]byte{1, 2}) },
+			[]interface{}{[]byte{1, 2}}, UnitPath("foo.service"),
+		},
+		{
+			"LoadUnit", []interface{}{UnitPath("foo.service")},
+			func() (interface{}, error) { return conn.LoadUnit("foo.service") },
+			[]interface{}{"foo.service"}, UnitPath("foo.service"),
+		},
+		{
+			"Dump", []interface{}{"dump"},
+			func() (interface{}, error) { return conn.Dump() },
+			nil, "dump",
+		},
+		{
+			"UnsetAndSetEnvironment", nil,
+			func() (interface{}, error) { return nil, conn.UnsetAndSetEnvironment([]string{"A"}, []string{"B=1"}) },
+			[]interface{}{[]string{"A"}, []string{"B=1"}}, nil,
+		},
+		{
+			"SetDefaultTarget", []interface{}{changes},
+			func() (interface{}, error) { return conn.SetDefaultTarget("multi-user.target", true) },
+			[]interface{}{"multi-user.target", true}, wantChanges,
+		},
+		{
+			"PresetAllUnitFiles", []interface{}{changes},
+			func() (interface{}, error) { return conn.PresetAllUnitFiles("full", false, true) },
+			[]interface{}{"full", false, true}, wantChanges,
+		},
+		{
+			"ReenableUnitFiles", []interface{}{true, changes},
+			func() (interface{}, error) {
+				install, changes, err := conn.ReenableUnitFiles([]string{"foo.service"}, true, false)
+				if !install {
+					t.Error("ReenableUnitFiles: install info is false")
+				}
+				return changes, err
+			},
+			[]interface{}{[]string{"foo.service"}, true, false}, wantChanges,
+		},
+		{
+			"GetUnitFileLinks", []interface{}{[]string{"/etc/systemd/system/multi-user.target.wants/foo.service"}},
+			func() (interface{}, error) { return conn.GetUnitFileLinks("foo.service", false) },
+			[]interface{}{"foo.service", false}, []string{"/etc/systemd/system/multi-user.target.wants/foo.service"},
+		},
+		{
+			"AddDependencyUnitFiles", []interface{}{changes},
+			func() (interface{}, error) {
+				return conn.AddDependencyUnitFiles([]string{"foo.service"}, "multi-user.target", "Wants", false, false)
+			},
+			[]interface{}{[]string{"foo.service"}, "multi-user.target", "Wants", false, false}, wantChanges,
+		},
+		{
+			"AttachProcessesToUnit", nil,
+			func() (interface{}, error) { return nil, conn.AttachProcessesToUnit("foo.scope", "/sub", []uint32{42}) },
+			[]interface{}{"foo.scope", "/sub", []uint32{42}}, nil,
+		},
+		{
+			"GetUnitProcesses", []interface{}{[][]interface{}{{"/system.slice/foo.service", uint32(42), "/bin/sleep 400"}}},
+			func() (interface{}, error) { return conn.GetUnitProcesses("foo.service") },
+			[]interface{}{"foo.service"}, []UnitProcess{{"/system.slice/foo.service", 42, "/bin/sleep 400"}},
+		},
+		{
+			"CleanUnit", nil,
+			func() (interface{}, error) { return nil, conn.CleanUnit("foo.service", []string{"cache"}) },
+			[]interface{}{"foo.service", []string{"cache"}}, nil,
+		},
+	} {
+		reply = tt.reply
+		got, err := tt.call()
+		if err != nil {
+			t.Errorf("%s: %v", tt.method, err)
+			continue
+		}
+		if gotMethod != "org.freedesktop.systemd1.Manager."+tt.method {
+			t.Errorf("%s: called %s", tt.method, gotMethod)
+		}
+		if len(tt.args) != 0 || len(gotArgs) != 0 {
+			if !reflect.DeepEqual(gotArgs, tt.args) {
+				t.Errorf("%s: called with %#v, want %#v", tt.method, gotArgs, tt.args)
+			}
+		}
+		if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestEnqueueUnitJobReply(t *testing.T) {
+	conn := &Conn{}
+	conn.state.subscribed = true
+	conn.sysobj = replyObject{reply: func(method string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{
+			uint32(7), jobPath(7), "foo.service", UnitPath("foo.service"), "start",
+			[][]interface{}{{uint32(8), jobPath(8), "bar.service", UnitPath("bar.service"), "start"}},
+		}, nil
+	}}
+
+	job, affected, err := conn.EnqueueUnitJob("foo.service", "start", "replace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != 7 || job.Path != jobPath(7) || job.Unit != "foo.service" || job.UnitPath != UnitPath("foo.service") || job.Type != "start" || job.conn != conn {
+		t.Fatalf("Unexpected job %+v", job)
+	}
+	if len(affected) != 1 || affected[0].ID != 8 || affected[0].Unit != "bar.service" || affected[0].conn != conn {
+		t.Fatalf("Unexpected affected jobs %+v", affected)
+	}
+}
+
+func TestReexecuteNoReply(t *testing.T) {
+	conn := &Conn{}
+	conn.sysobj = replyObject{reply: func(method string, args ...interface{}) ([]interface{}, error) {
+		return nil, dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply"}
+	}}
+
+	if err := conn.Reexecute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetUnitByPID(t *testing.T) {
+	conn := setupConn(t)
+
+	p, err := conn.GetUnitByPID(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.IsValid() || !strings.HasPrefix(string(p), "/org/freedesktop/systemd1/unit/") {
+		t.Fatalf("Unexpected unit path %q", p)
+	}
+}
+
+func TestLoadUnitAndFileState(t *testing.T) {
+	target := "start-stop.service"
+	conn := setupConn(t)
+
+	setupUnit(target, conn, t)
+	linkUnit(target, conn, t)
+
+	p, err := conn.LoadUnit(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != UnitPath(target) {
+		t.Fatalf("Unexpected unit path %q", p)
+	}
+
+	state, err := conn.GetUnitFileState(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "linked-runtime" {
+		t.Fatalf("Unexpected unit file state %q", state)
+	}
+
+	if _, err := conn.GetDefaultTarget(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetUnsetEnvironment(t *testing.T) {
+	conn := setupConn(t)
+
+	if err := conn.SetEnvironment([]string{"GO_SYSTEMD_TEST=1"}); err != nil {
+		t.Fatal(err)
+	}
+	env, err := conn.GetManagerProperty("Environment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(env, "GO_SYSTEMD_TEST=1") {
+		t.Fatalf("Environment not set: %s", env)
+	}
+
+	if err := conn.UnsetEnvironment([]string{"GO_SYSTEMD_TEST"}); err != nil {
+		t.Fatal(err)
+	}
+	env, err = conn.GetManagerProperty("Environment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(env, "GO_SYSTEMD_TEST") {
+		t.Fatalf("Environment not unset: %s", env)
+	}
+}
+
+func TestGetUnitProcesses(t *testing.T) {
+	target := "start-stop.service"
+	conn := setupConn(t)
+
+	setupUnit(target, conn, t)
+	linkUnit(target, conn, t)
+
+	reschan := make(chan string)
+	_, err := conn.StartUnit(target, "replace", reschan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-reschan
+	defer conn.StopUnit(target, "replace", nil)
+
+	procs, err := conn.GetUnitProcesses(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) == 0 || procs[0].PID == 0 {
+		t.Fatalf("Unexpected processes %+v", procs)
+	}
+}
+
+func TestStartTransientTimerArgs(t *testing.T) {
+	var gotArgs []interface{}
+	conn := &Conn{}
+	conn.sysobj = replyObject{reply: func(method string, args ...interface{}) ([]interface{}, error) {
+		if method != "org.freedesktop.systemd1.Manager.StartTransientUnit" {
+			t.Errorf("Unexpected method %s", method)
+		}
+		gotArgs = args
+		return []interface{}{jobPath(5)}, nil
+	}}
+
+	timerProps := []Property{PropOnCalendar("daily"), PropPersistent(true)}
+	serviceProps := []Property{PropExecStart([]string{"/bin/true"}, false)}
+	id, err := conn.StartTransientTimer("foo", "fail", timerProps, serviceProps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 5 {
+		t.Fatalf("Unexpected job id %d", id)
+	}
+
+	want := []interface{}{"foo.timer", "fail", timerProps, []PropertyCollection{{"foo.service", serviceProps}}}
+	if !reflect.DeepEqual(gotArgs, want) {
+		t.Fatalf("Called with %#v, want %#v", gotArgs, want)
+	}
+}
+
+// Ensure that a transient timer activates its transient service.
+func TestStartTransientTimer(t *testing.T) {
+	conn := setupConn(t)
+
+	name := fmt.Sprintf("testing-transient-timer-%d", rand.Int())
+	timerProps := []Property{PropOnActiveSec(time.Millisecond), PropAccuracySec(time.Millisecond)}
+	serviceProps := []Property{PropExecStart([]string{"/bin/sleep", "400"}, false)}
+
+	reschan := make(chan string)
+	_, err := conn.StartTransientTimer(name, "replace", timerProps, serviceProps, reschan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := <-reschan
+	if job != "done" {
+		t.Fatal("Job is not done:", job)
+	}
+	defer conn.StopUnit(name+".timer", "replace", nil)
+
+	for i := 0; i < 50; i++ {
+		units, err := conn.ListUnitsByNames([]string{name + ".service"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(units) == 1 && units[0].ActiveState == "active" {
+			conn.StopUnit(name+".service", "replace", nil)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("Service was not activated by the timer")
+}
@@ -15,6 +15,9 @@
 package dbus
 
 import (
+	"math"
+	"time"
+
 	"github.com/godbus/dbus"
 )
 
@@ -226,3 +229,336 @@ func PropPids(pids ...uint32) Property {
 		Value: dbus.MakeVariant(pids),
 	}
 }
+
+// usec converts a duration to microseconds, as used by the properties of
+// systemd. DurationInfinity is converted to infinity.
+func usec(d time.Duration) uint64 {
+	if d == DurationInfinity {
+		return math.MaxUint64
+	}
+	return uint64(d / time.Microsecond)
+}
+
+// PropEnvironment sets the Environment service property, a list of
+// "KEY=value" assignments. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#Environment=
+func PropEnvironment(assignments ...string) Property {
+	return Property{
+		Name:  "Environment",
+		Value: dbus.MakeVariant(assignments),
+	}
+}
+
+// PropUser sets the User service property. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#User=
+func PropUser(user string) Property {
+	return Property{
+		Name:  "User",
+		Value: dbus.MakeVariant(user),
+	}
+}
+
+// PropGroup sets the Group service property. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#Group=
+func PropGroup(group string) Property {
+	return Property{
+		Name:  "Group",
+		Value: dbus.MakeVariant(group),
+	}
+}
+
+// PropDynamicUser sets the DynamicUser service property. Requires systemd 232
+// or newer. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#DynamicUser=
+func PropDynamicUser(b bool) Property {
+	return Property{
+		Name:  "DynamicUser",
+		Value: dbus.MakeVariant(b),
+	}
+}
+
+// PropWorkingDirectory sets the WorkingDirectory service property. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#WorkingDirectory=
+func PropWorkingDirectory(dir string) Property {
+	return Property{
+		Name:  "WorkingDirectory",
+		Value: dbus.MakeVariant(dir),
+	}
+}
+
+// PropStandardOutput sets the StandardOutput service property, e.g. to
+// "journal", "null" or "inherit". See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#StandardOutput=
+func PropStandardOutput(output string) Property {
+	return Property{
+		Name:  "StandardOutput",
+		Value: dbus.MakeVariant(output),
+	}
+}
+
+// PropStandardError sets the StandardError service property. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#StandardError=
+func PropStandardError(output string) Property {
+	return Property{
+		Name:  "StandardError",
+		Value: dbus.MakeVariant(output),
+	}
+}
+
+// PropCPUQuota sets the CPUQuota unit property, in percent of the time of one
+// CPU. The value may exceed 100 for units running on more than one CPU. See
+// http://www.freedesktop.org/software/systemd/man/systemd.resource-control.html#CPUQuota=
+func PropCPUQuota(percent uint64) Property {
+	return Property{
+		Name:  "CPUQuotaPerSecUSec",
+		Value: dbus.MakeVariant(percent * 10000),
+	}
+}
+
+// PropMemoryMax sets the MemoryMax unit property, in bytes. Use
+// math.MaxUint64 for no limit. Requires the unified cgroup hierarchy. See
+// http://www.freedesktop.org/software/systemd/man/systemd.resource-control.html#MemoryMax=bytes
+func PropMemoryMax(bytes uint64) Property {
+	return Property{
+		Name:  "MemoryMax",
+		Value: dbus.MakeVariant(bytes),
+	}
+}
+
+// PropMemoryHigh sets the MemoryHigh unit property, in bytes. Use
+// math.MaxUint64 for no limit. Requires the unified cgroup hierarchy. See
+// http://www.freedesktop.org/software/systemd/man/systemd.resource-control.html#MemoryHigh=bytes
+func PropMemoryHigh(bytes uint64) Property {
+	return Property{
+		Name:  "MemoryHigh",
+		Value: dbus.MakeVariant(bytes),
+	}
+}
+
+// PropTasksMax sets the TasksMax unit property. Use math.MaxUint64 for no
+// limit. See
+// http://www.freedesktop.org/software/systemd/man/systemd.resource-control.html#TasksMax=N
+func PropTasksMax(tasks uint64) Property {
+	return Property{
+		Name:  "TasksMax",
+		Value: dbus.MakeVariant(tasks),
+	}
+}
+
+// PropIOWeight sets the IOWeight unit property, between 1 and 10000. See
+// http://www.freedesktop.org/software/systemd/man/systemd.resource-control.html#IOWeight=weight
+func PropIOWeight(weight uint64) Property {
+	return Property{
+		Name:  "IOWeight",
+		Value: dbus.MakeVariant(weight),
+	}
+}
+
+// PropKillMode sets the KillMode unit property, one of "control-group",
+// "process", "mixed" or "none". See
+// http://www.freedesktop.org/software/systemd/man/systemd.kill.html#KillMode=
+func PropKillMode(mode string) Property {
+	return Property{
+		Name:  "KillMode",
+		Value: dbus.MakeVariant(mode),
+	}
+}
+
+// PropTimeoutStopSec sets the TimeoutStopSec service and scope property. Use
+// DurationInfinity to disable the timeout. See
+// http://www.freedesktop.org/software/systemd/man/systemd.service.html#TimeoutStopSec=
+func PropTimeoutStopSec(d time.Duration) Property {
+	return Property{
+		Name:  "TimeoutStopUSec",
+		Value: dbus.MakeVariant(usec(d)),
+	}
+}
+
+// PropRuntimeMaxSec sets the RuntimeMaxSec service property. Use
+// DurationInfinity for no limit. See
+// http://www.freedesktop.org/software/systemd/man/systemd.service.html#RuntimeMaxSec=
+func PropRuntimeMaxSec(d time.Duration) Property {
+	return Property{
+		Name:  "RuntimeMaxUSec",
+		Value: dbus.MakeVariant(usec(d)),
+	}
+}
+
+// PropRestart sets the Restart service property, e.g. to "no", "on-failure"
+// or "always". See
+// http://www.freedesktop.org/software/systemd/man/systemd.service.html#Restart=
+func PropRestart(restart string) Property {
+	return Property{
+		Name:  "Restart",
+		Value: dbus.MakeVariant(restart),
+	}
+}
+
+// PropProtectSystem sets the ProtectSystem service property, one of "no",
+// "yes", "full" or "strict". See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#ProtectSystem=
+func PropProtectSystem(protect string) Property {
+	return Property{
+		Name:  "ProtectSystem",
+		Value: dbus.MakeVariant(protect),
+	}
+}
+
+// PropProtectHome sets the ProtectHome service property, one of "no", "yes",
+// "read-only" or "tmpfs". See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#ProtectHome=
+func PropProtectHome(protect string) Property {
+	return Property{
+		Name:  "ProtectHome",
+		Value: dbus.MakeVariant(protect),
+	}
+}
+
+// PropPrivateTmp sets the PrivateTmp service property. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#PrivateTmp=
+func PropPrivateTmp(b bool) Property {
+	return Property{
+		Name:  "PrivateTmp",
+		Value: dbus.MakeVariant(b),
+	}
+}
+
+// PropReadWritePaths sets the ReadWritePaths service property. Requires
+// systemd 231 or newer. See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#ReadWritePaths=
+func PropReadWritePaths(paths ...string) Property {
+	return Property{
+		Name:  "ReadWritePaths",
+		Value: dbus.MakeVariant(paths),
+	}
+}
+
+// PropCapabilityBoundingSet sets the CapabilityBoundingSet service property
+// to the capabilities in mask, where bit n stands for capability number n
+// (e.g. 1<<12 for CAP_NET_ADMIN). See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#CapabilityBoundingSet=
+func PropCapabilityBoundingSet(mask uint64) Property {
+	return Property{
+		Name:  "CapabilityBoundingSet",
+		Value: dbus.MakeVariant(mask),
+	}
+}
+
+// PropOnCalendar adds a calendar event specification to the OnCalendar timer
+// property, e.g. "daily" or "Mon *-*-* 03:00:00". See
+// http://www.freedesktop.org/software/systemd/man/systemd.timer.html#OnCalendar=
+func PropOnCalendar(spec string) Property {
+	return Property{
+		Name:  "OnCalendar",
+		Value: dbus.MakeVariant(spec),
+	}
+}
+
+// PropOnActiveSec adds the OnActiveSec timer property, relative to when the
+// timer was started. See
+// http://www.freedesktop.org/software/systemd/man/systemd.timer.html#OnActiveSec=
+func PropOnActiveSec(d time.Duration) Property {
+	return Property{
+		Name:  "OnActiveSec",
+		Value: dbus.MakeVariant(usec(d)),
+	}
+}
+
+// PropOnBootSec adds the OnBootSec timer property, relative to when the
+// machine was booted. See
+// http://www.freedesktop.org/software/systemd/man/systemd.timer.html#OnBootSec=
+func PropOnBootSec(d time.Duration) Property {
+	return Property{
+		Name:  "OnBootSec",
+		Value: dbus.MakeVariant(usec(d)),
+	}
+}
+
+// PropOnUnitActiveSec adds the OnUnitActiveSec timer property, relative to
+// when the activated unit was last activated. See
+// http://www.freedesktop.org/software/systemd/man/systemd.timer.html#OnUnitActiveSec=
+func PropOnUnitActiveSec(d time.Duration) Property {
+	return Property{
+		Name:  "OnUnitActiveSec",
+		Value: dbus.MakeVariant(usec(d)),
+	}
+}
+
+// PropAccuracySec sets the AccuracySec timer property. See
+// http://www.freedesktop.org/software/systemd/man/systemd.timer.html#AccuracySec=
+func PropAccuracySec(d time.Duration) Property {
+	return Property{
+		Name:  "AccuracyUSec",
+		Value: dbus.MakeVariant(usec(d)),
+	}
+}
+
+// PropRandomizedDelaySec sets the RandomizedDelaySec timer property. Requires
+// systemd 229 or newer. See
+// http://www.freedesktop.org/software/systemd/man/systemd.timer.html#RandomizedDelaySec=
+func PropRandomizedDelaySec(d time.Duration) Property {
+	return Property{
+		Name:  "RandomizedDelayUSec",
+		Value: dbus.MakeVariant(usec(d)),
+	}
+}
+
+// PropPersistent sets the Persistent timer property. See
+// http://www.freedesktop.org/software/systemd/man/systemd.timer.html#Persistent=
+func PropPersistent(b bool) Property {
+	return Property{
+		Name:  "Persistent",
+		Value: dbus.MakeVariant(b),
+	}
+}
+
+// PropStandardInputFileDescriptor connects the standard input of a service
+// to the given file descriptor, which is passed to systemd. Only the
+// connections of New, NewUserConnection, NewSystemdConnection and
+// MachineDialer can pass file descriptors. Requires systemd 236 or newer.
+func PropStandardInputFileDescriptor(fd int) Property {
+	return Property{
+		Name:  "StandardInputFileDescriptor",
+		Value: dbus.MakeVariant(dbus.UnixFD(fd)),
+	}
+}
+
+// PropStandardOutputFileDescriptor connects the standard output of a service
+// to the given file descriptor, which is passed to systemd like with
+// PropStandardInputFileDescriptor. Requires systemd 236 or newer.
+func PropStandardOutputFileDescriptor(fd int) Property {
+	return Property{
+		Name:  "StandardOutputFileDescriptor",
+		Value: dbus.MakeVariant(dbus.UnixFD(fd)),
+	}
+}
+
+// PropStandardErrorFileDescriptor connects the standard error of a service
+// to the given file descriptor, which is passed to systemd like with
+// PropStandardInputFileDescriptor. Requires systemd 236 or newer.
+func PropStandardErrorFileDescriptor(fd int) Property {
+	return Property{
+		Name:  "StandardErrorFileDescriptor",
+		Value: dbus.MakeVariant(dbus.UnixFD(fd)),
+	}
+}
+
+// PropCollectMode sets the CollectMode unit property, either "inactive" or
+// "inactive-or-failed". Requires systemd 236 or newer. See
+// http://www.freedesktop.org/software/systemd/man/systemd.unit.html#CollectMode=
+func PropCollectMode(mode string) Property {
+	return Property{
+		Name:  "CollectMode",
+		Value: dbus.MakeVariant(mode),
+	}
+}
+
+// PropAddRef makes the unit reference the client creating it, so that it is
+// not garbage collected before the client released it with Unref or
+// disconnected. Requires systemd 236 or newer.
+func PropAddRef(b bool) Property {
+	return Property{
+		Name:  "AddRef",
+		Value: dbus.MakeVariant(b),
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// TestPropertySignatures checks the properties against the D-Bus signatures
+// systemd expects for them.
+func TestPropertySignatures(t *testing.T) {
+	for _, tt := range []struct {
+		prop  Property
+		name  string
+		sig   string
+		value interface{}
+	}{
+		{PropEnvironment("A=1", "B=2"), "Environment", "as", []string{"A=1", "B=2"}},
+		{PropUser("nobody"), "User", "s", "nobody"},
+		{PropGroup("nogroup"), "Group", "s", "nogroup"},
+		{PropDynamicUser(true), "DynamicUser", "b", true},
+		{PropWorkingDirectory("/tmp"), "WorkingDirectory", "s", "/tmp"},
+		{PropStandardOutput("journal"), "StandardOutput", "s", "journal"},
+		{PropStandardError("null"), "StandardError", "s", "null"},
+		{PropCPUQuota(150), "CPUQuotaPerSecUSec", "t", uint64(1500000)},
+		{PropMemoryMax(1 << 30), "MemoryMax", "t", uint64(1 << 30)},
+		{PropMemoryHigh(math.MaxUint64), "MemoryHigh", "t", uint64(math.MaxUint64)},
+		{PropTasksMax(64), "TasksMax", "t", uint64(64)},
+		{PropIOWeight(500), "IOWeight", "t", uint64(500)},
+		{PropKillMode("mixed"), "KillMode", "s", "mixed"},
+		{PropTimeoutStopSec(90 * time.Second), "TimeoutStopUSec", "t", uint64(90000000)},
+		{PropRuntimeMaxSec(DurationInfinity), "RuntimeMaxUSec", "t", uint64(math.MaxUint64)},
+		{PropRestart("on-failure"), "Restart", "s", "on-failure"},
+		{PropProtectSystem("strict"), "ProtectSystem", "s", "strict"},
+		{PropProtectHome("read-only"), "ProtectHome", "s", "read-only"},
+		{PropPrivateTmp(true), "PrivateTmp", "b", true},
+		{PropReadWritePaths("/var/lib/foo"), "ReadWritePaths", "as", []string{"/var/lib/foo"}},
+		{PropCapabilityBoundingSet(1<<10 | 1<<12), "CapabilityBoundingSet", "t", uint64(1<<10 | 1<<12)},
+		{PropCapabilityBoundingSet(1 << 63), "CapabilityBoundingSet", "t", uint64(1 << 63)},
+		{PropOnCalendar("daily"), "OnCalendar", "s", "daily"},
+		{PropOnActiveSec(time.Minute), "OnActiveSec", "t", uint64(60000000)},
+		{PropOnBootSec(time.Second), "OnBootSec", "t", uint64(1000000)},
+		{PropOnUnitActiveSec(time.Hour), "OnUnitActiveSec", "t", uint64(3600000000)},
+		{PropAccuracySec(time.Millisecond), "AccuracyUSec", "t", uint64(1000)},
+		{PropRandomizedDelaySec(time.Minute), "RandomizedDelayUSec", "t", uint64(60000000)},
+		{PropPersistent(true), "Persistent", "b", true},
+		{PropStandardInputFileDescriptor(0), "StandardInputFileDescriptor", "h", dbus.UnixFD(0)},
+		{PropStandardOutputFileDescriptor(1), "StandardOutputFileDescriptor", "h", dbus.UnixFD(1)},
+		{PropStandardErrorFileDescriptor(2), "StandardErrorFileDescriptor", "h", dbus.UnixFD(2)},
+		{PropCollectMode("inactive-or-failed"), "CollectMode", "s", "inactive-or-failed"},
+		{PropAddRef(true), "AddRef", "b", true},
+	} {
+		if tt.prop.Name != tt.name {
+			t.Errorf("got name %q, want %q", tt.prop.Name, tt.name)
+		}
+		if sig := tt.prop.Value.Signature().String(); sig != tt.sig {
+			t.Errorf("%s: got signature %q, want %q", tt.name, sig, tt.sig)
+		}
+		if !reflect.DeepEqual(tt.prop.Value.Value(), tt.value) {
+			t.Errorf("%s: got value %v, want %v", tt.name, tt.prop.Value.Value(), tt.value)
+		}
+	}
+}
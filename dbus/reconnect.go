@@ -0,0 +1,449 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/internal/dbusutil"
+	"github.com/godbus/dbus"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+	connStateBuffer       = 16
+)
+
+var (
+	errConnClosed = errors.New("connection closed")
+	errConnLost   = errors.New("connection lost")
+)
+
+// ConnStateChange is a change of the state of a Conn's connection to the bus,
+// as sent to the channel returned by EnableReconnect.
+type ConnStateChange struct {
+	Connected bool  // Whether the connection is established
+	Err       error // Why the last attempt to reconnect failed, if it did
+}
+
+// ReconnectOptions configures how a Conn reconnects, see EnableReconnect.
+type ReconnectOptions struct {
+	// InitialBackoff is the delay before the first attempt to reconnect.
+	// It is doubled after each failed attempt. Defaults to 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff is the longest delay between two attempts. Defaults to
+	// 30s.
+	MaxBackoff time.Duration
+}
+
+// connState is the state of the connection to the bus, guarded by the Conn's
+// connMu.
+type connState struct {
+	closed     bool
+	done       chan struct{}
+	subscribed bool
+	// matches are the match rules added by addMatch.
+	matches map[string]struct{}
+	// generation is incremented each time sysconn and sigconn are
+	// replaced, so that the loss of connections which have already been
+	// replaced is ignored.
+	generation uint64
+
+	reconnect bool
+	opts      ReconnectOptions
+	lost      chan uint64
+	changes   chan ConnStateChange
+}
+
+// EnableReconnect makes the connection reconnect automatically when it is
+// lost, e.g. because systemd re-executed or the bus daemon restarted.
+// Reconnecting redials with the function passed to NewConnection, backing off
+// exponentially between failed attempts, and restores the connection's
+// state: match rules are added again, Subscribe is called again if it was
+// active, and the unit subscriptions are sent the differences between their
+// units' last state and a fresh listing of all units. The SubStateUpdate
+// subscriber, which does not know the units' previous states, is sent the
+// SubState of all units.
+//
+// The returned channel receives the connection's state changes: a
+// disconnected state when the connection is lost and after each failed
+// attempt, and a connected state once it is restored. If the receiver does
+// not keep up, the oldest changes are dropped, so the last change received is
+// always the current state. The channel is closed by Close. Calling
+// EnableReconnect again returns the same channel and ignores opts.
+//
+// Method calls made while disconnected fail. Jobs waited for whose completion
+// was missed meanwhile are reported with an empty result, which Job.Wait
+// returns as ErrJobGone.
+func (c *Conn) EnableReconnect(opts ReconnectOptions) <-chan ConnStateChange {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaultInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.state.reconnect {
+		return c.state.changes
+	}
+	c.state.reconnect = true
+	c.state.opts = opts
+	c.state.lost = make(chan uint64, 1)
+	c.state.changes = make(chan ConnStateChange, connStateBuffer)
+	if c.state.closed {
+		close(c.state.changes)
+	} else {
+		go c.reconnectLoop(c.state.lost, c.state.done)
+	}
+	return c.state.changes
+}
+
+// connLost is called when the connections of generation gen have been lost.
+func (c *Conn) connLost(gen uint64) {
+	c.connMu.RLock()
+	if c.state.closed || gen != c.state.generation {
+		c.connMu.RUnlock()
+		return
+	}
+	if c.state.reconnect {
+		select {
+		case c.state.lost <- gen:
+		default:
+		}
+		c.connMu.RUnlock()
+		return
+	}
+	c.connMu.RUnlock()
+
+	// The connection won't come back, end the subscriptions.
+	c.units.stop(errConnLost)
+	c.managerSignals.stop(errConnLost)
+}
+
+// sendConnState sends a state change, dropping the oldest one if the
+// channel is full. It must be called with connMu locked.
+func (c *Conn) sendConnState(change ConnStateChange) {
+	if c.state.closed {
+		return
+	}
+	for {
+		select {
+		case c.state.changes <- change:
+			return
+		default:
+		}
+		select {
+		case <-c.state.changes:
+		default:
+		}
+	}
+}
+
+func (c *Conn) reconnectLoop(lost <-chan uint64, done <-chan struct{}) {
+	for {
+		var gen uint64
+		select {
+		case gen = <-lost:
+		case <-done:
+			return
+		}
+
+		c.connMu.Lock()
+		if gen != c.state.generation || c.state.closed {
+			c.connMu.Unlock()
+			continue
+		}
+		// Make sure both connections are gone, as systemd drops its
+		// state about them.
+		c.sysconn.Close()
+		c.sigconn.Close()
+		c.sendConnState(ConnStateChange{Connected: false})
+		opts := c.state.opts
+		c.connMu.Unlock()
+
+		for backoff := opts.InitialBackoff; ; {
+			select {
+			case <-time.After(backoff):
+			case <-done:
+				return
+			}
+
+			err := c.redial()
+			if err == errConnClosed {
+				return
+			}
+			c.connMu.Lock()
+			c.sendConnState(ConnStateChange{Connected: err == nil, Err: err})
+			c.connMu.Unlock()
+			if err == nil {
+				break
+			}
+
+			if backoff *= 2; backoff > opts.MaxBackoff {
+				backoff = opts.MaxBackoff
+			}
+		}
+	}
+}
+
+// redial replaces the connections with new ones and restores their state.
+func (c *Conn) redial() error {
+	sysconn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	sigconn, err := c.dial()
+	if err != nil {
+		sysconn.Close()
+		return err
+	}
+
+	c.connMu.Lock()
+	if c.state.closed {
+		c.connMu.Unlock()
+		sysconn.Close()
+		sigconn.Close()
+		return errConnClosed
+	}
+	c.sysconn, c.sigconn = sysconn, sigconn
+	c.state.generation++
+	subscribed := c.state.subscribed
+	matches := make([]string, 0, len(c.state.matches))
+	for rule := range c.state.matches {
+		matches = append(matches, rule)
+	}
+	c.connMu.Unlock()
+
+	// From here on, the loss of the new connections is noticed by
+	// dispatch. Errors still fail this attempt, so that the connections'
+	// state is restored once they are replaced again.
+	fail := func(err error) error {
+		sysconn.Close()
+		sigconn.Close()
+		return err
+	}
+
+	c.dispatch()
+	for _, rule := range matches {
+		err := sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err
+		if err == dbus.ErrClosed {
+			return fail(err)
+		}
+	}
+	if _, err := c.GetManagerProperty("Version"); err != nil {
+		return fail(err)
+	}
+	if subscribed {
+		if err := c.sigobj.Call("org.freedesktop.systemd1.Manager.Subscribe", 0).Store(); err != nil {
+			return fail(err)
+		}
+	}
+	if err := c.resyncJobs(); err != nil {
+		return fail(err)
+	}
+	if err := c.resyncUnits(); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// resyncJobs completes the jobs waited for which no longer exist, as their
+// JobRemoved signal has been missed.
+func (c *Conn) resyncJobs() error {
+	c.jobListener.Lock()
+	paths := make([]dbus.ObjectPath, 0, len(c.jobListener.jobs))
+	for p := range c.jobListener.jobs {
+		paths = append(paths, p)
+	}
+	c.jobListener.Unlock()
+
+	for _, p := range paths {
+		id, err := JobIDFromPath(p)
+		if err != nil {
+			continue
+		}
+		var job dbus.ObjectPath
+		err = c.sysobj.Call("org.freedesktop.systemd1.Manager.GetJob", 0, id).Store(&job)
+		if errors.Is(err, ErrNoSuchJob) {
+			c.jobListener.Lock()
+			if out, ok := c.jobListener.jobs[p]; ok {
+				out <- ""
+				delete(c.jobListener.jobs, p)
+			}
+			c.jobListener.Unlock()
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resyncUnits sends the units' current states to the subscriptions whose
+// signals may have been missed.
+func (c *Conn) resyncUnits() error {
+	uc := &c.units
+	uc.load.Lock()
+	defer uc.load.Unlock()
+
+	c.subscriber.Lock()
+	subscriber := c.subscriber.updateCh != nil
+	c.subscriber.Unlock()
+
+	uc.Lock()
+	cached := uc.units != nil
+	uc.loading = cached
+	uc.Unlock()
+
+	if !cached && !subscriber {
+		return nil
+	}
+
+	units, err := c.ListUnits()
+
+	if cached {
+		uc.Lock()
+		if err != nil {
+			uc.loading = false
+			uc.pending = nil
+		} else {
+			uc.resync(units)
+		}
+		uc.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+
+	if subscriber {
+		for _, u := range units {
+			if u.Path == UnitPath(u.Name) {
+				c.sendSubState(&SubStateUpdate{u.Name, u.SubState})
+			}
+		}
+	}
+	return nil
+}
+
+// resync updates the cache's content with units, listed after signals may
+// have been missed, notifies the subscriptions of the differences and applies
+// the signals received meanwhile. It must be called with uc locked.
+func (uc *unitCache) resync(units []UnitStatus) {
+	listed := make(map[dbus.ObjectPath]bool)
+	for _, s := range units {
+		if s.Path != UnitPath(s.Name) {
+			continue
+		}
+		listed[s.Path] = true
+
+		u, ok := uc.units[s.Path]
+		if !ok {
+			u = &cachedUnit{status: UnitStatus{Name: s.Name, Path: s.Path, JobPath: "/"}}
+			uc.units[s.Path] = u
+		}
+		old := u.status
+		status := s
+		uc.update(s.Path, func(s *UnitStatus) {
+			*s = status
+		})
+		uc.transition(u, &old, nil)
+	}
+
+	for p, u := range uc.units {
+		if !listed[p] {
+			delete(uc.units, p)
+			if u.announced {
+				uc.notify(&u.status, nil)
+			}
+		}
+	}
+
+	for _, signal := range uc.pending {
+		uc.apply(signal)
+	}
+	uc.pending = nil
+	uc.loading = false
+}
+
+// connObject is a dbus.BusObject calling methods on the connection's current
+// sysconn or sigconn, so that it remains valid when they are replaced.
+type connObject struct {
+	conn *Conn
+	sig  bool
+	path dbus.ObjectPath
+}
+
+// bus returns the current connection, and flags with the ones set by
+// SetInteractiveAuthorization added.
+func (o *connObject) bus(flags dbus.Flags) (*dbus.Conn, dbus.Flags) {
+	o.conn.connMu.RLock()
+	defer o.conn.connMu.RUnlock()
+	if o.conn.interactive {
+		flags |= dbus.FlagAllowInteractiveAuthorization
+	}
+	if o.sig {
+		return o.conn.sigconn, flags
+	}
+	return o.conn.sysconn, flags
+}
+
+func (o *connObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	bus, flags := o.bus(flags)
+	var call *dbus.Call
+	if fdArgs, fds := extractUnixFDs(args); len(fds) != 0 {
+		msg := dbusutil.NewMethodCall("org.freedesktop.systemd1", o.path, method, flags, fdArgs...)
+		call = sendUnixFDs(bus, msg, fds, make(chan *dbus.Call, 1))
+		if call.Done != nil {
+			call = <-call.Done
+		}
+	} else {
+		call = dbusutil.Call(bus, "org.freedesktop.systemd1", o.path, method, flags, args...)
+	}
+	call.Err = wrapError(call.Err)
+	return call
+}
+
+func (o *connObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	bus, flags := o.bus(flags)
+	if fdArgs, fds := extractUnixFDs(args); len(fds) != 0 {
+		msg := dbusutil.NewMethodCall("org.freedesktop.systemd1", o.path, method, flags, fdArgs...)
+		return sendUnixFDs(bus, msg, fds, ch)
+	}
+	return dbusutil.Go(bus, "org.freedesktop.systemd1", o.path, method, flags, ch, args...)
+}
+
+func (o *connObject) GetProperty(p string) (dbus.Variant, error) {
+	idx := strings.LastIndex(p, ".")
+	if idx == -1 || idx+1 == len(p) {
+		return dbus.Variant{}, errors.New("invalid property name: " + p)
+	}
+
+	var result dbus.Variant
+	err := o.Call("org.freedesktop.DBus.Properties.Get", 0, p[:idx], p[idx+1:]).Store(&result)
+	return result, err
+}
+
+func (o *connObject) Destination() string {
+	return "org.freedesktop.systemd1"
+}
+
+func (o *connObject) Path() dbus.ObjectPath {
+	return o.path
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	target := "start-stop.service"
+	f := newFakeSystemd()
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	if _, err := conn.LinkUnitFiles([]string{findFixture(target, t)}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	states := conn.EnableReconnect(ReconnectOptions{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	if again := conn.EnableReconnect(ReconnectOptions{}); again != states {
+		t.Fatal("EnableReconnect returned another channel")
+	}
+
+	sub, err := conn.SubscribeUnitChanges(func(unit string) bool { return unit != target })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	// A job whose completion is missed while disconnected.
+	lost := make(chan string, 1)
+	conn.jobListener.Lock()
+	conn.jobListener.jobs[jobPath(1000)] = lost
+	conn.jobListener.Unlock()
+
+	timeout := time.After(5 * time.Second)
+	waitState := func(connected bool) ConnStateChange {
+		for {
+			select {
+			case s := <-states:
+				if s.Connected == connected {
+					return s
+				}
+			case <-timeout:
+				t.Fatalf("Reached timeout waiting for connected=%v", connected)
+			}
+		}
+	}
+
+	f.stop()
+	if s := waitState(false); s.Err != nil {
+		t.Fatalf("Unexpected error on disconnect: %v", s.Err)
+	}
+	if s := waitState(false); s.Err != errFakeDown {
+		t.Fatalf("Expected the reconnection to fail, got %v", s.Err)
+	}
+	f.runUnitJob(target, "start")
+	f.start()
+	waitState(true)
+
+	select {
+	case result := <-lost:
+		if result != "" {
+			t.Fatalf("Unexpected result %q for a lost job", result)
+		}
+	case <-timeout:
+		t.Fatal("Lost job not completed")
+	}
+
+	// The start of the unit has been missed, and is reported once the
+	// units are listed again.
+	for active := false; !active; {
+		select {
+		case changes := <-sub.Changes():
+			if c, ok := changes[target]; ok && c.New != nil && c.New.ActiveState == "active" {
+				active = true
+			}
+		case <-timeout:
+			t.Fatal("Missed unit change not reported")
+		}
+	}
+
+	reschan := make(chan string)
+	if _, err := conn.StopUnit(target, "replace", reschan); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case job := <-reschan:
+		if job != "done" {
+			t.Fatal("Job is not done:", job)
+		}
+	case <-timeout:
+		t.Fatal("Job completion not received after reconnecting")
+	}
+
+	conn.Close()
+	for range states {
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// NewMachineConnection establishes a connection to the system bus of a local
+// container, like systemctl -M. See MachineDialer.
+// Callers should call Close() when done with the connection.
+func NewMachineConnection(machine string) (*Conn, error) {
+	return NewConnection(MachineDialer(machine))
+}
+
+// MachineDialer returns a function for NewConnection which connects to the
+// system bus of the local container machine, as registered with
+// systemd-machined. The bus socket is reached through the root directory of
+// the container's leader process, so no namespace has to be entered; the
+// leader is looked up on each call, so that reconnecting follows a restarted
+// container. The machine ".host" is the local host.
+//
+// The container must run a D-Bus daemon, and must not use private user
+// namespacing, as the bus authenticates the caller by its uid.
+func MachineDialer(machine string) func() (*dbus.Conn, error) {
+	return func() (*dbus.Conn, error) {
+		if machine == ".host" {
+			return dbusAuthHelloConnection(systemBusPrivate)
+		}
+
+		leader, err := machineLeader(machine)
+		if err != nil {
+			return nil, err
+		}
+		return dbusAuthHelloConnection(func() (*dbus.Conn, error) {
+			return dialUnixFD(fmt.Sprintf("unix:path=/proc/%d/root/run/dbus/system_bus_socket", leader))
+		})
+	}
+}
+
+// machineLeader returns the PID of the leader process of a machine registered
+// with systemd-machined.
+func machineLeader(machine string) (uint32, error) {
+	conn, err := dbusAuthHelloConnection(dbus.SystemBusPrivate)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var p dbus.ObjectPath
+	err = conn.Object("org.freedesktop.machine1", "/org/freedesktop/machine1").Call("org.freedesktop.machine1.Manager.GetMachine", 0, machine).Store(&p)
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	v, err := conn.Object("org.freedesktop.machine1", p).GetProperty("org.freedesktop.machine1.Machine.Leader")
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	leader, ok := v.Value().(uint32)
+	if !ok || leader == 0 {
+		return 0, fmt.Errorf("machine %s has no leader process", machine)
+	}
+	return leader, nil
+}
+
+// NewRemoteConnection establishes a connection to the system bus of a remote
+// host over SSH, like systemctl -H. host is passed to ssh, e.g. "user@host",
+// which must be able to log in without prompting, and the remote host must
+// provide systemd-stdio-bridge.
+// Callers should call Close() when done with the connection.
+func NewRemoteConnection(host string) (*Conn, error) {
+	return NewConnection(CommandDialer("ssh", "-xT", host, "--", "systemd-stdio-bridge"))
+}
+
+// CommandDialer returns a function for NewConnection which runs a command and
+// talks to the bus through its standard input and output, e.g. ssh running
+// systemd-stdio-bridge on a remote host. A new command is run for each
+// connection. What the command writes to its standard error is included in
+// the error returned if the connection could not be established, and
+// discarded otherwise. See StdioBridgeDialer.
+func CommandDialer(name string, arg ...string) func() (*dbus.Conn, error) {
+	return func() (*dbus.Conn, error) {
+		var c *commandConn
+		conn, err := StdioBridgeDialer(func() (io.ReadWriteCloser, error) {
+			var err error
+			c, err = startCommand(name, arg...)
+			return c, err
+		})()
+		// The command has been stopped if the connection failed, so
+		// all its output has been read.
+		if err != nil && c != nil {
+			if stderr := strings.TrimSpace(c.stderr.String()); stderr != "" {
+				return nil, fmt.Errorf("%w: %s", err, stderr)
+			}
+		}
+		return conn, err
+	}
+}
+
+// startCommand runs the command name, with its standard input and output
+// connected to the returned commandConn.
+func startCommand(name string, arg ...string) (*commandConn, error) {
+	c := &commandConn{cmd: exec.Command(name, arg...)}
+	c.cmd.Stderr = &c.stderr
+
+	var err error
+	c.stdin, err = c.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	c.Reader, err = c.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// StdioBridgeDialer returns a function for NewConnection which talks to the
+// bus through the streams returned by open, which must be attached to a
+// running systemd-stdio-bridge, e.g. over an SSH session. open is called for
+// each connection.
+//
+// systemd-stdio-bridge cannot check the credentials of its peer, so the
+// connection authenticates anonymously; what it is allowed to do is decided by
+// the user the bridge runs as.
+func StdioBridgeDialer(open func() (io.ReadWriteCloser, error)) func() (*dbus.Conn, error) {
+	return func() (*dbus.Conn, error) {
+		rwc, err := open()
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := dbus.NewConn(rwc)
+		if err != nil {
+			rwc.Close()
+			return nil, err
+		}
+
+		methods := []dbus.Auth{authAnonymous{}, dbus.AuthExternal(strconv.Itoa(os.Getuid()))}
+		if err = conn.Auth(methods); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if err = conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// authAnonymous implements the ANONYMOUS authentication mechanism.
+type authAnonymous struct{}
+
+func (authAnonymous) FirstData() ([]byte, []byte, dbus.AuthStatus) {
+	return []byte("ANONYMOUS"), nil, dbus.AuthOk
+}
+
+func (authAnonymous) HandleData([]byte) ([]byte, dbus.AuthStatus) {
+	return nil, dbus.AuthError
+}
+
+// commandConn is the standard output and input of a running command.
+type commandConn struct {
+	io.Reader
+	stdin  io.WriteCloser
+	stderr stderrBuffer
+	cmd    *exec.Cmd
+
+	// godbus closes the connection again once reading fails.
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// Close closes the command's standard input and stops it.
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return c.closeErr
+}
+
+// stderrBufferSize is how much of a command's standard error is kept.
+const stderrBufferSize = 4096
+
+// stderrBuffer keeps the beginning of what a command writes to its standard
+// error, which is where the reason of a failure is usually written.
+type stderrBuffer struct {
+	mu sync.Mutex
+	b  []byte
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := stderrBufferSize - len(b.b); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		b.b = append(b.b, p[:n]...)
+	}
+	return len(p), nil
+}
+
+func (b *stderrBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.b)
+}
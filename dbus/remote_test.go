@@ -0,0 +1,76 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStdioBridgeDialer(t *testing.T) {
+	conn, err := NewConnection(StdioBridgeDialer(newFakeSystemd().openBridge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	checkFakeUnits(t, conn)
+}
+
+func TestCommandDialer(t *testing.T) {
+	conn, err := NewConnection(CommandDialer(os.Args[0], "-test.run=TestHelperStdioBridge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	checkFakeUnits(t, conn)
+}
+
+// TestCommandDialerError ensures that the standard error of a command failing
+// to connect is reported.
+func TestCommandDialerError(t *testing.T) {
+	_, err := NewConnection(CommandDialer("/bin/sh", "-c", "echo 'Permission denied (publickey).' >&2; exit 255"))
+	if err == nil || !strings.Contains(err.Error(), "Permission denied (publickey).") {
+		t.Fatalf("Expected the standard error of the command, got %v", err)
+	}
+}
+
+// TestHelperStdioBridge is not a real test: it is run by TestCommandDialer
+// to serve fakeSystemd like systemd-stdio-bridge.
+func TestHelperStdioBridge(t *testing.T) {
+	if len(os.Args) < 2 || os.Args[len(os.Args)-1] != "-test.run=TestHelperStdioBridge" {
+		return
+	}
+	newFakeSystemd().serve(&fakeSystemdConn{rw: stdio{os.Stdin, os.Stdout}, bridge: true})
+	os.Exit(0)
+}
+
+type stdio struct {
+	io.ReadCloser
+	io.Writer
+}
+
+func checkFakeUnits(t *testing.T, conn *Conn) {
+	units, err := conn.ListUnits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unit := getUnitStatus(units, "basic.target"); unit == nil || unit.ActiveState != "active" {
+		t.Fatalf("Unexpected units %+v", units)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// RunResult is the result of a command run by RunTransientService.
+type RunResult struct {
+	Unit         string        // The name of the transient service
+	InvocationID []byte        // The 128-bit invocation ID of the service run
+	Result       string        // The service result, e.g. success or exit-code
+	ExitCode     int32         // How the main process exited, one of CLD_EXITED, CLD_KILLED or CLD_DUMPED
+	ExitStatus   int32         // The exit status or, if killed, the signal number of the main process
+	CPUUsage     time.Duration // The CPU time consumed, 0 if CPU accounting is not available
+	MemoryPeak   uint64        // The peak memory usage in bytes, 0 if not available (systemd 255 or newer)
+}
+
+// RunTransientService runs a command in a transient service and waits for it
+// to finish, like 'systemd-run --wait --pipe --collect'. The service's standard
+// input, output and error are the ones of the calling process, and CPU and
+// memory accounting are enabled. properties are applied after these, so they
+// may override them.
+//
+// If name is empty, a unique name of the form run-r<random>.service is chosen.
+// An error is returned if the service was not run, e.g. because a dependency
+// failed, while a command that failed is reported in the RunResult. Requires
+// systemd 236 or newer.
+func (c *Conn) RunTransientService(name string, command []string, properties ...Property) (*RunResult, error) {
+	return c.RunTransientServiceContext(context.Background(), name, command, properties...)
+}
+
+// RunTransientServiceContext is the same as RunTransientService with a
+// context. If ctx is done before the command finished, the service is stopped
+// and ctx.Err() is returned.
+func (c *Conn) RunTransientServiceContext(ctx context.Context, name string, command []string, properties ...Property) (*RunResult, error) {
+	if name == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		name = "run-r" + hex.EncodeToString(b) + ".service"
+	}
+
+	props := []Property{
+		PropDescription(strings.Join(command, " ")),
+		PropExecStart(command, true),
+		PropStandardInputFileDescriptor(int(os.Stdin.Fd())),
+		PropStandardOutputFileDescriptor(int(os.Stdout.Fd())),
+		PropStandardErrorFileDescriptor(int(os.Stderr.Fd())),
+		{Name: "CPUAccounting", Value: dbus.MakeVariant(true)},
+		{Name: "MemoryAccounting", Value: dbus.MakeVariant(true)},
+		// Keep the unit around until its results have been read.
+		PropAddRef(true),
+		PropCollectMode("inactive-or-failed"),
+	}
+	props = append(props, properties...)
+
+	// Subscribe before starting the service, so that its transitions
+	// can't be missed.
+	sub, err := c.SubscribeUnitTransitionsContext(ctx, 16, TransitionCoalesce, func(unit string) bool { return unit != name })
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+
+	ch := make(chan string, 1)
+	id, err := c.StartTransientUnitContext(ctx, name, "fail", props, ch)
+	if err != nil {
+		return nil, err
+	}
+	defer callContext(context.Background(), c.object(UnitPath(name)), "org.freedesktop.systemd1.Unit.Unref")
+
+	if err := c.waitRunFinished(ctx, name, id, ch, sub); err != nil {
+		if err == ctx.Err() {
+			c.StopUnit(name, "replace", nil)
+		}
+		return nil, err
+	}
+
+	unit, err := c.GetTypedUnitPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	service, err := c.GetServicePropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RunResult{
+		Unit:         name,
+		InvocationID: unit.InvocationID,
+		Result:       service.Result,
+		ExitCode:     service.ExecMainCode,
+		ExitStatus:   service.ExecMainStatus,
+		CPUUsage:     time.Duration(accounted(service.CPUUsageNSec)),
+		MemoryPeak:   accounted(service.MemoryPeak),
+	}, nil
+}
+
+// accounted returns the value of a resource accounting property, or 0 if
+// systemd reports it as unavailable (UINT64_MAX).
+func accounted(v uint64) uint64 {
+	if v == math.MaxUint64 {
+		return 0
+	}
+	return v
+}
+
+// waitRunFinished waits for the start job of the service name and then for
+// the service to become inactive or failed.
+func (c *Conn) waitRunFinished(ctx context.Context, name string, id int, ch <-chan string, sub *TransitionSubscription) error {
+	result, err := c.WaitJobContext(ctx, id, ch)
+	if err != nil {
+		return err
+	}
+	// A failed start job leaves the service failed with its result, any
+	// other result but done means it did not run.
+	if job, err := jobResult(result); err != nil {
+		return err
+	} else if job != JobDone && job != JobFailed {
+		return fmt.Errorf("starting %s: job %s", name, job)
+	}
+
+	finished := func(state string) bool {
+		return state == "inactive" || state == "failed"
+	}
+
+	// The start job has completed, so the service either is still
+	// running or has finished already.
+	resync := true
+	for {
+		if resync {
+			prop, err := c.getProperty(ctx, name, "org.freedesktop.systemd1.Unit", "ActiveState")
+			if err != nil {
+				return err
+			}
+			if state, _ := prop.Value.Value().(string); finished(state) {
+				return nil
+			}
+			resync = false
+		}
+
+		select {
+		case t := <-sub.Transitions():
+			if t.Overflow {
+				resync = true
+				continue
+			}
+			// Ignore the transitions queued before the service
+			// was started.
+			if finished(t.To.ActiveState) && t.From.ActiveState != "" && !finished(t.From.ActiveState) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
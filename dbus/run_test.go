@@ -0,0 +1,211 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// TestFakeRunTransientService runs a service whose command fails and checks
+// its result.
+func TestFakeRunTransientService(t *testing.T) {
+	target := "run-fake.service"
+	f := newFakeSystemd()
+	f.sockets = true
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	type run struct {
+		res *RunResult
+		err error
+	}
+	done := make(chan run, 1)
+	go func() {
+		res, err := conn.RunTransientServiceContext(ctx, target, []string{"/bin/sh", "-c", "exit 3"})
+		done <- run{res, err}
+	}()
+
+	for {
+		prop, err := conn.GetUnitProperty(target, "ActiveState")
+		if err == nil && prop.Value.Value() == "active" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.exitService(target, 3)
+
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.res.Unit != target || r.res.Result != "exit-code" {
+		t.Errorf("Unexpected result %+v", r.res)
+	}
+	// CLD_EXITED
+	if r.res.ExitCode != 1 || r.res.ExitStatus != 3 {
+		t.Errorf("Unexpected exit code/status %d/%d", r.res.ExitCode, r.res.ExitStatus)
+	}
+	if len(r.res.InvocationID) != 16 {
+		t.Errorf("Unexpected invocation ID %x", r.res.InvocationID)
+	}
+	if r.res.CPUUsage != 0 || r.res.MemoryPeak != 0 {
+		t.Errorf("Unexpected resource usage %v/%d without accounting", r.res.CPUUsage, r.res.MemoryPeak)
+	}
+
+	// The service is released once its result has been read.
+	units, err := conn.ListUnitsByNames([]string{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) == 1 && units[0].LoadState == "loaded" && units[0].ActiveState != "failed" {
+		t.Fatalf("Unexpected unit %+v", units[0])
+	}
+}
+
+// TestFakeRunTransientServiceCanceled ensures that the service is stopped
+// when the context is canceled.
+func TestFakeRunTransientServiceCanceled(t *testing.T) {
+	target := "run-canceled.service"
+	f := newFakeSystemd()
+	f.sockets = true
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := conn.RunTransientServiceContext(ctx, target, []string{"/bin/sleep", "400"})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	units, err := conn.ListUnitsByNames([]string{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) == 1 && units[0].ActiveState == "active" && units[0].JobId == 0 {
+		t.Fatal("Service is still running")
+	}
+}
+
+// TestFakeRunTransientServiceDependency ensures that an error is returned
+// when the service is not started because a dependency failed.
+func TestFakeRunTransientServiceDependency(t *testing.T) {
+	f := newFakeSystemd()
+	f.sockets = true
+	f.failUnit("fake-dependency.service", "exit-code")
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	res, err := conn.RunTransientService("run-dependency.service", []string{"/bin/true"}, PropRequires("fake-dependency.service"))
+	if err == nil || !strings.Contains(err.Error(), string(JobDependency)) {
+		t.Fatalf("Expected a dependency error, got %+v, %v", res, err)
+	}
+}
+
+// TestFakeRunTransientServiceFileDescriptors ensures that the standard
+// streams of the service are passed to systemd as file descriptors.
+func TestFakeRunTransientServiceFileDescriptors(t *testing.T) {
+	target := "run-fds.service"
+	f := newFakeSystemd()
+	f.sockets = true
+	conn := f.newConn(t)
+	defer conn.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.RunTransientService(target, []string{"/bin/true"}, PropStandardOutputFileDescriptor(int(w.Fd())))
+		done <- err
+	}()
+
+	props := make(map[string]dbus.Variant)
+	for len(props) == 0 {
+		f.mu.Lock()
+		if u := f.units[target]; u != nil && u.props["ActiveState"].Value() == "active" {
+			for k, v := range u.props {
+				props[k] = v
+			}
+		}
+		f.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stdin, ok := props["StandardInputFileDescriptor"].Value().(dbus.UnixFD)
+	if !ok || !sameFile(t, int(stdin), int(os.Stdin.Fd())) {
+		t.Errorf("Unexpected standard input %v", props["StandardInputFileDescriptor"])
+	}
+	stderr, ok := props["StandardErrorFileDescriptor"].Value().(dbus.UnixFD)
+	if !ok || !sameFile(t, int(stderr), int(os.Stderr.Fd())) {
+		t.Errorf("Unexpected standard error %v", props["StandardErrorFileDescriptor"])
+	}
+	// The service writes to the pipe through the descriptor received.
+	stdout, ok := props["StandardOutputFileDescriptor"].Value().(dbus.UnixFD)
+	if !ok || int(stdout) == int(w.Fd()) {
+		t.Fatalf("Unexpected standard output %v", props["StandardOutputFileDescriptor"])
+	}
+	if _, err := syscall.Write(int(stdout), []byte("fake")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b); err != nil || string(b) != "fake" {
+		t.Errorf("Unexpected output %q, %v", b, err)
+	}
+
+	f.exitService(target, 0)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Connections which can't pass file descriptors fail instead of
+	// sending their numbers.
+	f.sockets = false
+	pipe := f.newConn(t)
+	defer pipe.Close()
+	_, err = pipe.RunTransientService(target, []string{"/bin/true"})
+	if err != errUnixFDsNotSupported {
+		t.Fatalf("Expected errUnixFDsNotSupported, got %v", err)
+	}
+}
+
+// sameFile returns whether the file descriptors a and b refer to the same
+// file.
+func sameFile(t *testing.T, a, b int) bool {
+	var sa, sb syscall.Stat_t
+	if err := syscall.Fstat(a, &sa); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Fstat(b, &sb); err != nil {
+		t.Fatal(err)
+	}
+	return sa.Dev == sb.Dev && sa.Ino == sb.Ino
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Scope is a transient scope unit grouping processes which have not been
+// started by systemd.
+type Scope struct {
+	Name string // The name of the scope unit
+
+	conn *Conn
+}
+
+// StartScope creates the transient scope unit name (".scope" is appended if
+// missing) in slice, or the default slice if empty, moves the processes pids
+// into it and waits for its start job to complete. properties are set on the
+// scope as well, e.g. PropMemoryMax or PropTasksMax to limit its resources.
+//
+// Only the given processes are moved, their children forked later on follow
+// them. To move a process together with its existing descendants, pass the
+// PIDs returned by ProcessTree.
+func (c *Conn) StartScope(name string, slice string, pids []uint32, properties ...Property) (*Scope, error) {
+	return c.StartScopeContext(context.Background(), name, slice, pids, properties...)
+}
+
+// StartScopeContext is the same as StartScope with a context.
+func (c *Conn) StartScopeContext(ctx context.Context, name string, slice string, pids []uint32, properties ...Property) (*Scope, error) {
+	if !strings.HasSuffix(name, ".scope") {
+		name += ".scope"
+	}
+
+	props := []Property{PropPids(pids...)}
+	if slice != "" {
+		props = append(props, PropSlice(slice))
+	}
+	props = append(props, properties...)
+
+	ch := make(chan string, 1)
+	id, err := c.StartTransientUnitContext(ctx, name, "fail", props, ch)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.WaitJobContext(ctx, id, ch)
+	if err != nil {
+		return nil, err
+	}
+	if JobResult(result) != JobDone {
+		return nil, fmt.Errorf("starting %s: job %s", name, result)
+	}
+
+	return &Scope{Name: name, conn: c}, nil
+}
+
+// Attach moves more processes into the scope. Requires systemd 238 or newer.
+func (s *Scope) Attach(pids ...uint32) error {
+	return s.AttachContext(context.Background(), pids...)
+}
+
+// AttachContext is the same as Attach with a context.
+func (s *Scope) AttachContext(ctx context.Context, pids ...uint32) error {
+	return s.conn.AttachProcessesToUnitContext(ctx, s.Name, "", pids)
+}
+
+// Stop stops the scope, killing its processes, and waits for the stop job to
+// complete.
+func (s *Scope) Stop() error {
+	return s.StopContext(context.Background())
+}
+
+// StopContext is the same as Stop with a context.
+func (s *Scope) StopContext(ctx context.Context) error {
+	ch := make(chan string, 1)
+	id, err := s.conn.StopUnitContext(ctx, s.Name, "replace", ch)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.conn.WaitJobContext(ctx, id, ch)
+	if err != nil {
+		return err
+	}
+	if JobResult(result) != JobDone {
+		return fmt.Errorf("stopping %s: job %s", s.Name, result)
+	}
+	return nil
+}
+
+// ProcessTree returns pid and the PIDs of all its descendants, as listed in
+// /proc/<pid>/task/<tid>/children. It requires a kernel built with
+// CONFIG_PROC_CHILDREN.
+func ProcessTree(pid uint32) ([]uint32, error) {
+	pids := []uint32{pid}
+	for i := 0; i < len(pids); i++ {
+		children, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/children", pids[i]))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range children {
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				// the task or process exited meanwhile
+				continue
+			}
+			for _, field := range strings.Fields(string(b)) {
+				child, err := strconv.ParseUint(field, 10, 32)
+				if err != nil {
+					return nil, err
+				}
+				pids = append(pids, uint32(child))
+			}
+		}
+	}
+	return pids, nil
+}
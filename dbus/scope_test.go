@@ -0,0 +1,93 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestProcessTree(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "/bin/sleep 400 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d/task/%d/children", cmd.Process.Pid, cmd.Process.Pid)); err != nil {
+		t.Skip("/proc/<pid>/task/<tid>/children is not available")
+	}
+
+	var pids []uint32
+	for i := 0; i < 50; i++ {
+		var err error
+		pids, err = ProcessTree(uint32(cmd.Process.Pid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pids) > 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(pids) != 2 || pids[0] != uint32(cmd.Process.Pid) {
+		t.Fatalf("Unexpected process tree %v", pids)
+	}
+	if p, err := os.FindProcess(int(pids[1])); err == nil {
+		p.Kill()
+	}
+}
+
+// TestFakeStartScope moves a process into a new scope, and another one into
+// the existing scope.
+func TestFakeStartScope(t *testing.T) {
+	conn := newFakeSystemd().newConn(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pids := []uint32{1001, 1002}
+	scope, err := conn.StartScopeContext(ctx, "fake-scope", "system.slice", pids[:1], PropTasksMax(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scope.Name != "fake-scope.scope" {
+		t.Fatalf("Unexpected scope name %q", scope.Name)
+	}
+	if p, err := conn.GetUnitByPID(pids[0]); err != nil || p != UnitPath(scope.Name) {
+		t.Fatalf("Process is in unit %s: %v", p, err)
+	}
+
+	if err := scope.Attach(pids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := conn.GetUnitByPID(pids[1]); err != nil || p != UnitPath(scope.Name) {
+		t.Fatalf("Attached process is in unit %s: %v", p, err)
+	}
+
+	if err := scope.StopContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := conn.GetUnitByPID(pids[0]); err == nil {
+		t.Fatalf("Process is still in unit %s", p)
+	}
+}
@@ -15,54 +15,97 @@
 package dbus
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/godbus/dbus"
 )
 
-const (
-	cleanIgnoreInterval = int64(10 * time.Second)
-	ignoreInterval      = int64(30 * time.Millisecond)
-)
-
 // Subscribe sets up this connection to subscribe to all systemd dbus events.
 // This is required before calling SubscribeUnits. When the connection closes
 // systemd will automatically stop sending signals so there is no need to
 // explicitly call Unsubscribe().
 func (c *Conn) Subscribe() error {
-	c.sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
-		"type='signal',interface='org.freedesktop.systemd1.Manager',member='UnitNew'")
-	c.sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
-		"type='signal',interface='org.freedesktop.DBus.Properties',member='PropertiesChanged'")
+	return c.SubscribeContext(context.Background())
+}
 
-	err := c.sigobj.Call("org.freedesktop.systemd1.Manager.Subscribe", 0).Store()
+// SubscribeContext is the same as Subscribe with a context.
+func (c *Conn) SubscribeContext(ctx context.Context) error {
+	for _, member := range []string{"UnitNew", "UnitRemoved", "JobNew"} {
+		c.addMatch("type='signal',interface='org.freedesktop.systemd1.Manager',member='" + member + "'")
+	}
+	c.addMatch("type='signal',interface='org.freedesktop.DBus.Properties',member='PropertiesChanged'")
+
+	err := callContext(ctx, c.sigobj, "org.freedesktop.systemd1.Manager.Subscribe").Store()
 	if err != nil {
 		return err
 	}
 
+	c.connMu.Lock()
+	c.state.subscribed = true
+	c.connMu.Unlock()
 	return nil
 }
 
+// subscribeIfNeeded calls Subscribe unless it is already active.
+func (c *Conn) subscribeIfNeeded(ctx context.Context) error {
+	c.connMu.RLock()
+	subscribed := c.state.subscribed
+	c.connMu.RUnlock()
+	if subscribed {
+		return nil
+	}
+
+	err := c.SubscribeContext(ctx)
+	if errors.Is(err, ErrAlreadySubscribed) {
+		err = nil
+	}
+	return err
+}
+
 // Unsubscribe this connection from systemd dbus events.
 func (c *Conn) Unsubscribe() error {
-	err := c.sigobj.Call("org.freedesktop.systemd1.Manager.Unsubscribe", 0).Store()
+	return c.UnsubscribeContext(context.Background())
+}
+
+// UnsubscribeContext is the same as Unsubscribe with a context.
+func (c *Conn) UnsubscribeContext(ctx context.Context) error {
+	err := callContext(ctx, c.sigobj, "org.freedesktop.systemd1.Manager.Unsubscribe").Store()
 	if err != nil {
 		return err
 	}
 
+	c.connMu.Lock()
+	c.state.subscribed = false
+	c.connMu.Unlock()
 	return nil
 }
 
 func (c *Conn) dispatch() {
+	c.connMu.RLock()
+	sysconn, sigconn, gen := c.sysconn, c.sigconn, c.state.generation
+	c.connMu.RUnlock()
+
 	ch := make(chan *dbus.Signal, signalBuffer)
 
-	c.sigconn.Signal(ch)
+	sigconn.Signal(ch)
+
+	// Signals received on sysconn are ignored, the channel only tells
+	// when the connection is lost.
+	sysch := make(chan *dbus.Signal, signalBuffer)
+	sysconn.Signal(sysch)
+	go func() {
+		for range sysch {
+		}
+		c.connLost(gen)
+	}()
 
 	go func() {
 		for {
 			signal, ok := <-ch
 			if !ok {
+				c.connLost(gen)
 				return
 			}
 
@@ -70,28 +113,12 @@ func (c *Conn) dispatch() {
 				c.jobComplete(signal)
 			}
 
-			if c.subscriber.updateCh == nil {
-				continue
-			}
+			c.units.handleSignal(signal)
+			c.managerSignals.handleSignal(signal)
 
-			var unitPath dbus.ObjectPath
-			switch signal.Name {
-			case "org.freedesktop.systemd1.Manager.JobRemoved":
-				unitName := signal.Body[2].(string)
-				c.sysobj.Call("org.freedesktop.systemd1.Manager.GetUnit", 0, unitName).Store(&unitPath)
-			case "org.freedesktop.systemd1.Manager.UnitNew":
-				unitPath = signal.Body[1].(dbus.ObjectPath)
-			case "org.freedesktop.DBus.Properties.PropertiesChanged":
-				if signal.Body[0].(string) == "org.freedesktop.systemd1.Unit" {
-					unitPath = signal.Path
-				}
+			if signal.Name == "org.freedesktop.DBus.Properties.PropertiesChanged" {
+				c.sendSubStateUpdate(signal)
 			}
-
-			if unitPath == dbus.ObjectPath("") {
-				continue
-			}
-
-			c.sendSubStateUpdate(unitPath)
 		}
 	}()
 }
@@ -160,14 +187,13 @@ type SubStateUpdate struct {
 }
 
 // SetSubStateSubscriber writes to updateCh when any unit's substate changes.
-// Although this writes to updateCh on every state change, the reported state
-// may be more recent than the change that generated it (due to an unavoidable
-// race in the systemd dbus interface).  That is, this method provides a good
-// way to keep a current view of all units' states, but is not guaranteed to
-// show every state transition they go through.  Furthermore, state changes
-// will only be written to the channel with non-blocking writes.  If updateCh
-// is full, it attempts to write an error to errCh; if errCh is full, the error
-// passes silently.
+// The reported state is the one carried by the PropertiesChanged signal that
+// generated the update, so every state transition systemd signals is seen
+// without fetching the unit's properties.  Subscribe must have been called for
+// the signals to be delivered.  State changes will only be written to the
+// channel with non-blocking writes.  If updateCh is full, it attempts to write
+// an error to errCh; if errCh is full, the error passes silently.  See
+// SubscribeUnitTransitions for a subscription which does not lose updates.
 func (c *Conn) SetSubStateSubscriber(updateCh chan<- *SubStateUpdate, errCh chan<- error) {
 	c.subscriber.Lock()
 	defer c.subscriber.Unlock()
@@ -175,26 +201,38 @@ func (c *Conn) SetSubStateSubscriber(updateCh chan<- *SubStateUpdate, errCh chan
 	c.subscriber.errCh = errCh
 }
 
-func (c *Conn) sendSubStateUpdate(path dbus.ObjectPath) {
-	c.subscriber.Lock()
-	defer c.subscriber.Unlock()
-
-	if c.shouldIgnore(path) {
+// sendSubStateUpdate sends the SubState carried by a unit's PropertiesChanged
+// signal to the SubStateUpdate subscriber.
+func (c *Conn) sendSubStateUpdate(signal *dbus.Signal) {
+	if len(signal.Body) < 2 {
+		return
+	}
+	iface, _ := signal.Body[0].(string)
+	changed, _ := signal.Body[1].(map[string]dbus.Variant)
+	if iface != "org.freedesktop.systemd1.Unit" {
+		return
+	}
+	substate, ok := changed["SubState"].Value().(string)
+	if !ok {
 		return
 	}
 
-	info, err := c.GetUnitProperties(string(path))
+	name, err := UnitNameFromPath(signal.Path)
 	if err != nil {
-		select {
-		case c.subscriber.errCh <- err:
-		default:
-		}
+		return
 	}
+	c.sendSubState(&SubStateUpdate{name, substate})
+}
+
+// sendSubState sends an update to the SubStateUpdate subscriber, if any.
+func (c *Conn) sendSubState(update *SubStateUpdate) {
+	c.subscriber.Lock()
+	defer c.subscriber.Unlock()
 
-	name := info["Id"].(string)
-	substate := info["SubState"].(string)
+	if c.subscriber.updateCh == nil {
+		return
+	}
 
-	update := &SubStateUpdate{name, substate}
 	select {
 	case c.subscriber.updateCh <- update:
 	default:
@@ -203,48 +241,4 @@ func (c *Conn) sendSubStateUpdate(path dbus.ObjectPath) {
 		default:
 		}
 	}
-
-	c.updateIgnore(path, info)
-}
-
-// The ignore functions work around a wart in the systemd dbus interface.
-// Requesting the properties of an unloaded unit will cause systemd to send a
-// pair of UnitNew/UnitRemoved signals.  Because we need to get a unit's
-// properties on UnitNew (as that's the only indication of a new unit coming up
-// for the first time), we would enter an infinite loop if we did not attempt
-// to detect and ignore these spurious signals.  The signal themselves are
-// indistinguishable from relevant ones, so we (somewhat hackishly) ignore an
-// unloaded unit's signals for a short time after requesting its properties.
-// This means that we will miss e.g. a transient unit being restarted
-// *immediately* upon failure and also a transient unit being started
-// immediately after requesting its status (with systemctl status, for example,
-// because this causes a UnitNew signal to be sent which then causes us to fetch
-// the properties).
-
-func (c *Conn) shouldIgnore(path dbus.ObjectPath) bool {
-	t, ok := c.subscriber.ignore[path]
-	return ok && t >= time.Now().UnixNano()
-}
-
-func (c *Conn) updateIgnore(path dbus.ObjectPath, info map[string]interface{}) {
-	c.cleanIgnore()
-
-	// unit is unloaded - it will trigger bad systemd dbus behavior
-	if info["LoadState"].(string) == "not-found" {
-		c.subscriber.ignore[path] = time.Now().UnixNano() + ignoreInterval
-	}
-}
-
-// without this, ignore would grow unboundedly over time
-func (c *Conn) cleanIgnore() {
-	now := time.Now().UnixNano()
-	if c.subscriber.cleanIgnore < now {
-		c.subscriber.cleanIgnore = now + cleanIgnoreInterval
-
-		for p, t := range c.subscriber.ignore {
-			if t < now {
-				delete(c.subscriber.ignore, p)
-			}
-		}
-	}
 }
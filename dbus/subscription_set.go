@@ -14,10 +14,6 @@
 
 package dbus
 
-import (
-	"time"
-)
-
 // SubscriptionSet returns a subscription set which is like conn.Subscribe but
 // can filter to only return events for a set of units.
 type SubscriptionSet struct {
@@ -30,13 +26,45 @@ func (s *SubscriptionSet) filter(unit string) bool {
 }
 
 // Subscribe starts listening for dbus events for all of the units in the set.
-// Returns channels identical to conn.SubscribeUnits.
+// Returns channels like conn.SubscribeUnits. The changes are taken from the
+// connection's unit cache (see conn.SubscribeUnitChanges), so units are not
+// polled, and errors only end the subscription: if the units can't be listed,
+// or once the connection is closed, or lost while reconnecting is not
+// enabled, the error is sent on the error channel and the status channel is
+// closed. The error channel is buffered, so the error need not be received.
 func (s *SubscriptionSet) Subscribe() (<-chan map[string]*UnitStatus, <-chan error) {
-	// TODO: Make fully evented by using systemd 209 with properties changed values
-	return s.conn.SubscribeUnitsCustom(time.Second, 0,
-		mismatchUnitStatus,
-		func(unit string) bool { return s.filter(unit) },
-	)
+	statusChan := make(chan map[string]*UnitStatus)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(statusChan)
+
+		sub, err := s.conn.SubscribeUnitChanges(func(unit string) bool { return s.filter(unit) })
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer sub.Close()
+
+		for changes := range sub.Changes() {
+			changed := make(map[string]*UnitStatus)
+			for name, c := range changes {
+				if c.Old != nil && c.New != nil && !mismatchUnitStatus(c.Old, c.New) {
+					continue
+				}
+				changed[name] = c.New
+			}
+
+			if len(changed) != 0 {
+				statusChan <- changed
+			}
+		}
+		if err := sub.Err(); err != nil {
+			errChan <- err
+		}
+	}()
+
+	return statusChan, errChan
 }
 
 // NewSubscriptionSet returns a new subscription set.
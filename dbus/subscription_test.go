@@ -21,13 +21,9 @@ import (
 
 // TestSubscribe exercises the basics of subscription
 func TestSubscribe(t *testing.T) {
-	conn, err := New()
+	conn := setupConn(t)
 
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	err = conn.Subscribe()
+	err := conn.Subscribe()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -42,13 +38,9 @@ func TestSubscribe(t *testing.T) {
 func TestSubscribeUnit(t *testing.T) {
 	target := "subscribe-events.service"
 
-	conn, err := New()
-
-	if err != nil {
-		t.Fatal(err)
-	}
+	conn := setupConn(t)
 
-	err = conn.Subscribe()
+	err := conn.Subscribe()
 	if err != nil {
 		t.Fatal(err)
 	}
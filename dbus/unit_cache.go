@@ -0,0 +1,495 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// UnitChange is a change of a unit's state, as sent by a UnitSubscription.
+type UnitChange struct {
+	Old *UnitStatus // The state before the change, nil if the unit is new
+	New *UnitStatus // The state after the change, nil if the unit has been removed
+}
+
+// unitCache is a local copy of the state of all units, kept up to date with
+// the values carried by systemd's signals.
+type unitCache struct {
+	sync.Mutex
+	// units is nil until the cache has been populated.
+	units map[dbus.ObjectPath]*cachedUnit
+	// pending holds the signals received while the cache is being
+	// populated, they are applied once ListUnits returned.
+	pending []*dbus.Signal
+	loading bool
+	subs    map[*UnitSubscription]struct{}
+	// stopped is why the subscriptions were ended, once the connection
+	// is gone for good.
+	stopped error
+	// transitionSubs are the subscriptions to the units' transitions.
+	transitionSubs map[*TransitionSubscription]struct{}
+	// halt is closed by stop before it locks the cache, to release the
+	// pushes blocked by a TransitionBlock subscription, see halted.
+	halt     chan struct{}
+	haltInit sync.Once
+	haltOnce sync.Once
+
+	// load serializes populating the cache.
+	load sync.Mutex
+}
+
+type cachedUnit struct {
+	status UnitStatus
+	// announced is false for units which have been sent a UnitNew but no
+	// state yet. Such units are not reported, which hides the UnitNew and
+	// UnitRemoved pairs systemd sends when a client merely looks up a unit
+	// that is not loaded.
+	announced bool
+
+	// result is the latest Result of the unit, reportedResult the one of
+	// its last reported transition.
+	result         string
+	reportedResult string
+}
+
+// UnitSubscription delivers the changes of the units' states, as maintained by
+// the connection's unit cache.
+type UnitSubscription struct {
+	cache      *unitCache
+	filterUnit func(string) bool
+
+	mu      sync.Mutex
+	pending map[string]*UnitChange
+	err     error
+
+	notify  chan struct{}
+	changes chan map[string]*UnitChange
+	done    chan struct{}
+	once    sync.Once
+}
+
+// SubscribeUnitChanges returns a subscription to the state changes of all
+// units. Unlike SubscribeUnits it does not poll: the state of all units is
+// listed once, after which a local copy is kept up to date with the values
+// carried by the UnitNew, UnitRemoved, JobNew, JobRemoved and
+// PropertiesChanged signals (the latter requires systemd 209 or newer). The
+// first batch of changes holds the state of all units as new units.
+//
+// filterUnit, if not nil, returns true for the names of units which should not
+// be reported. It is called with the connection's unit cache locked and must
+// not block.
+//
+// JobType is not carried by the signals, so it is only set for jobs which were
+// already queued when the units were listed.
+func (c *Conn) SubscribeUnitChanges(filterUnit func(string) bool) (*UnitSubscription, error) {
+	return c.SubscribeUnitChangesContext(context.Background(), filterUnit)
+}
+
+// SubscribeUnitChangesContext is the same as SubscribeUnitChanges with a
+// context.
+func (c *Conn) SubscribeUnitChangesContext(ctx context.Context, filterUnit func(string) bool) (*UnitSubscription, error) {
+	if err := c.loadUnitCache(ctx); err != nil {
+		return nil, err
+	}
+	return c.units.subscribe(filterUnit), nil
+}
+
+// loadUnitCache populates the connection's unit cache, unless this has been
+// done already.
+func (c *Conn) loadUnitCache(ctx context.Context) error {
+	uc := &c.units
+	uc.load.Lock()
+	defer uc.load.Unlock()
+
+	uc.Lock()
+	if uc.units != nil {
+		uc.Unlock()
+		return nil
+	}
+	uc.loading = true
+	uc.Unlock()
+
+	units, err := c.listUnitsForCache(ctx)
+
+	uc.Lock()
+	defer uc.Unlock()
+	if err != nil {
+		uc.loading = false
+		uc.pending = nil
+		return err
+	}
+	uc.populate(units)
+	return nil
+}
+
+// listUnitsForCache subscribes to systemd's signals and lists all units.
+func (c *Conn) listUnitsForCache(ctx context.Context) ([]UnitStatus, error) {
+	if err := c.subscribeIfNeeded(ctx); err != nil {
+		return nil, err
+	}
+	return c.ListUnitsContext(ctx)
+}
+
+// Changes returns the channel the subscription's changes are sent to, keyed
+// by unit name. Changes the receiver did not keep up with are merged, so a
+// batch holds the state of each changed unit before the previous batch and the
+// current state. The channel is closed by Close, or once the connection is
+// closed or lost, see Err.
+func (s *UnitSubscription) Changes() <-chan map[string]*UnitChange {
+	return s.changes
+}
+
+// Close stops the subscription.
+func (s *UnitSubscription) Close() {
+	s.once.Do(func() {
+		s.cache.Lock()
+		delete(s.cache.subs, s)
+		s.cache.Unlock()
+		close(s.done)
+	})
+}
+
+// Err returns why the channel returned by Changes was closed: nil if it was
+// closed by Close, or an error if the connection was closed, or lost while
+// reconnecting is not enabled.
+func (s *UnitSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// stop ends the subscription with err.
+func (s *UnitSubscription) stop(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// stop ends all subscriptions, and the ones made later, with err.
+func (uc *unitCache) stop(err error) {
+	uc.haltOnce.Do(func() { close(uc.halted()) })
+
+	uc.Lock()
+	subs, transitionSubs := uc.subs, uc.transitionSubs
+	uc.subs, uc.transitionSubs = nil, nil
+	if uc.stopped == nil {
+		uc.stopped = err
+	}
+	uc.Unlock()
+
+	for s := range subs {
+		s.stop(err)
+	}
+	for s := range transitionSubs {
+		s.stop(err)
+	}
+}
+
+// halted returns the channel closed once the cache is stopped.
+func (uc *unitCache) halted() chan struct{} {
+	uc.haltInit.Do(func() { uc.halt = make(chan struct{}) })
+	return uc.halt
+}
+
+// populate replaces the cache's content with units and applies the signals
+// received meanwhile. It must be called with uc locked.
+func (uc *unitCache) populate(units []UnitStatus) {
+	uc.units = make(map[dbus.ObjectPath]*cachedUnit)
+	for _, u := range units {
+		// ListUnits lists aliases as well, but signals are only sent
+		// for the object path of the unit's primary name.
+		if u.Path != UnitPath(u.Name) {
+			continue
+		}
+		uc.units[u.Path] = &cachedUnit{status: u, announced: true}
+	}
+
+	for _, signal := range uc.pending {
+		uc.apply(signal)
+	}
+	uc.pending = nil
+	uc.loading = false
+}
+
+// subscribe registers a new subscription, whose first batch holds the state
+// of all announced units.
+func (uc *unitCache) subscribe(filterUnit func(string) bool) *UnitSubscription {
+	s := &UnitSubscription{
+		cache:      uc,
+		filterUnit: filterUnit,
+		pending:    make(map[string]*UnitChange),
+		notify:     make(chan struct{}, 1),
+		changes:    make(chan map[string]*UnitChange),
+		done:       make(chan struct{}),
+	}
+
+	uc.Lock()
+	for _, u := range uc.units {
+		if u.announced {
+			status := u.status
+			s.push(status.Name, nil, &status)
+		}
+	}
+	stopped := uc.stopped
+	if stopped == nil {
+		if uc.subs == nil {
+			uc.subs = make(map[*UnitSubscription]struct{})
+		}
+		uc.subs[s] = struct{}{}
+	}
+	uc.Unlock()
+
+	go s.run()
+	if stopped != nil {
+		s.stop(stopped)
+	}
+	return s
+}
+
+// handleSignal updates the cache with a signal received from systemd.
+func (uc *unitCache) handleSignal(signal *dbus.Signal) {
+	uc.Lock()
+	defer uc.Unlock()
+
+	switch {
+	case uc.loading:
+		uc.pending = append(uc.pending, signal)
+	case uc.units != nil:
+		uc.apply(signal)
+	}
+}
+
+// apply updates the cache with a signal and notifies the subscriptions of the
+// resulting change. It must be called with uc locked.
+func (uc *unitCache) apply(signal *dbus.Signal) {
+	switch signal.Name {
+	case "org.freedesktop.systemd1.Manager.UnitNew":
+		var name string
+		var path dbus.ObjectPath
+		if dbus.Store(signal.Body, &name, &path) != nil {
+			return
+		}
+		if _, ok := uc.units[path]; !ok {
+			uc.units[path] = &cachedUnit{status: UnitStatus{Name: name, Path: path, JobPath: "/"}}
+		}
+
+	case "org.freedesktop.systemd1.Manager.UnitRemoved":
+		var name string
+		var path dbus.ObjectPath
+		if dbus.Store(signal.Body, &name, &path) != nil {
+			return
+		}
+		if u, ok := uc.units[path]; ok {
+			delete(uc.units, path)
+			if u.announced {
+				uc.notify(&u.status, nil)
+			}
+		}
+
+	case "org.freedesktop.systemd1.Manager.JobNew":
+		var id uint32
+		var job dbus.ObjectPath
+		var unit string
+		if dbus.Store(signal.Body, &id, &job, &unit) != nil {
+			return
+		}
+		uc.update(UnitPath(unit), func(s *UnitStatus) {
+			if s.JobId != id {
+				s.JobId, s.JobType, s.JobPath = id, "", job
+			}
+		})
+
+	case "org.freedesktop.systemd1.Manager.JobRemoved":
+		var id uint32
+		var job dbus.ObjectPath
+		var unit, result string
+		if dbus.Store(signal.Body, &id, &job, &unit, &result) != nil {
+			return
+		}
+		uc.update(UnitPath(unit), func(s *UnitStatus) {
+			if s.JobId == id {
+				s.JobId, s.JobType, s.JobPath = 0, "", "/"
+			}
+		})
+
+	case "org.freedesktop.DBus.Properties.PropertiesChanged":
+		var iface string
+		var changed map[string]dbus.Variant
+		if len(signal.Body) < 2 || dbus.Store(signal.Body[:2], &iface, &changed) != nil {
+			return
+		}
+		if !strings.HasPrefix(iface, "org.freedesktop.systemd1.") {
+			return
+		}
+		name, err := UnitNameFromPath(signal.Path)
+		if err != nil {
+			return
+		}
+		u, ok := uc.units[signal.Path]
+		if !ok {
+			u = &cachedUnit{status: UnitStatus{
+				Name:    name,
+				Path:    signal.Path,
+				JobPath: "/",
+			}}
+			uc.units[signal.Path] = u
+		}
+
+		if iface != "org.freedesktop.systemd1.Unit" {
+			// systemd sends the changes of the unit type specific
+			// interface before the ones of the generic interface,
+			// so the result is known when the state changes.
+			if result, ok := changed["Result"].Value().(string); ok {
+				u.result = result
+			}
+			return
+		}
+
+		// Invalidated properties are not fetched: none of the
+		// properties UnitStatus is made of is sent as invalidated.
+		old := u.status
+		uc.update(signal.Path, func(s *UnitStatus) {
+			storeUnitStatusProperties(s, changed)
+		})
+		uc.transition(u, &old, changed)
+	}
+}
+
+// update applies f to the state of the unit at path and notifies the
+// subscriptions if it changed. Units are announced once their load state is
+// known. It must be called with uc locked.
+func (uc *unitCache) update(path dbus.ObjectPath, f func(*UnitStatus)) {
+	u, ok := uc.units[path]
+	if !ok {
+		return
+	}
+
+	old := u.status
+	f(&u.status)
+
+	switch {
+	case !u.announced && u.status.LoadState != "":
+		u.announced = true
+		uc.notify(nil, &u.status)
+	case u.announced && old != u.status:
+		uc.notify(&old, &u.status)
+	}
+}
+
+// notify sends a change to all subscriptions. It must be called with uc
+// locked.
+func (uc *unitCache) notify(old, cur *UnitStatus) {
+	name := cur
+	if name == nil {
+		name = old
+	}
+	for s := range uc.subs {
+		var o, n *UnitStatus
+		if old != nil {
+			c := *old
+			o = &c
+		}
+		if cur != nil {
+			c := *cur
+			n = &c
+		}
+		s.push(name.Name, o, n)
+	}
+}
+
+// storeUnitStatusProperties sets the fields of s from the properties of the
+// org.freedesktop.systemd1.Unit interface.
+func storeUnitStatusProperties(s *UnitStatus, props map[string]dbus.Variant) {
+	for name, v := range props {
+		switch name {
+		case "Description":
+			s.Description, _ = v.Value().(string)
+		case "LoadState":
+			s.LoadState, _ = v.Value().(string)
+		case "ActiveState":
+			s.ActiveState, _ = v.Value().(string)
+		case "SubState":
+			s.SubState, _ = v.Value().(string)
+		case "Following":
+			s.Followed, _ = v.Value().(string)
+		case "Job":
+			var job UnitJob
+			if dbus.Store([]interface{}{v.Value()}, &job) != nil {
+				continue
+			}
+			if job.ID != s.JobId {
+				s.JobId, s.JobType, s.JobPath = job.ID, "", job.Path
+			}
+		}
+	}
+}
+
+// push merges a change into the changes waiting to be sent.
+func (s *UnitSubscription) push(name string, old, cur *UnitStatus) {
+	if s.filterUnit != nil && s.filterUnit(name) {
+		return
+	}
+
+	s.mu.Lock()
+	if c, ok := s.pending[name]; ok {
+		c.New = cur
+		if (c.Old == nil && c.New == nil) ||
+			(c.Old != nil && c.New != nil && *c.Old == *c.New) {
+			delete(s.pending, name)
+		}
+	} else {
+		s.pending[name] = &UnitChange{Old: old, New: cur}
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *UnitSubscription) run() {
+	defer close(s.changes)
+
+	for {
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+
+		s.mu.Lock()
+		changes := s.pending
+		s.pending = make(map[string]*UnitChange)
+		s.mu.Unlock()
+
+		if len(changes) == 0 {
+			continue
+		}
+
+		select {
+		case s.changes <- changes:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func unitNewSignal(name string) *dbus.Signal {
+	return &dbus.Signal{
+		Name: "org.freedesktop.systemd1.Manager.UnitNew",
+		Body: []interface{}{name, UnitPath(name)},
+	}
+}
+
+func unitRemovedSignal(name string) *dbus.Signal {
+	return &dbus.Signal{
+		Name: "org.freedesktop.systemd1.Manager.UnitRemoved",
+		Body: []interface{}{name, UnitPath(name)},
+	}
+}
+
+func unitChangedSignal(name string, props map[string]interface{}) *dbus.Signal {
+	changed := make(map[string]dbus.Variant)
+	for k, v := range props {
+		changed[k] = dbus.MakeVariant(v)
+	}
+	return &dbus.Signal{
+		Path: UnitPath(name),
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{"org.freedesktop.systemd1.Unit", changed, []string{}},
+	}
+}
+
+// receiveChanges merges the batches of changes received by sub until done
+// returns true for them.
+func receiveChanges(t *testing.T, sub *UnitSubscription, done func(map[string]*UnitChange) bool) map[string]*UnitChange {
+	merged := make(map[string]*UnitChange)
+	timeout := time.After(5 * time.Second)
+	for !done(merged) {
+		select {
+		case changes := <-sub.Changes():
+			for name, c := range changes {
+				if m, ok := merged[name]; ok {
+					m.New = c.New
+				} else {
+					merged[name] = c
+				}
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for changes, got %v", merged)
+		}
+	}
+	return merged
+}
+
+func TestUnitCache(t *testing.T) {
+	uc := &unitCache{loading: true}
+
+	// received while ListUnits is in flight
+	uc.handleSignal(unitChangedSignal("foo.service", map[string]interface{}{"ActiveState": "activating", "SubState": "start"}))
+
+	uc.Lock()
+	uc.populate([]UnitStatus{
+		{Name: "foo.service", Description: "foo", LoadState: "loaded", ActiveState: "inactive", SubState: "dead", Path: UnitPath("foo.service"), JobPath: "/"},
+		{Name: "alias.service", LoadState: "loaded", ActiveState: "inactive", SubState: "dead", Path: UnitPath("foo.service"), JobPath: "/"},
+	})
+	uc.Unlock()
+
+	sub := uc.subscribe(func(name string) bool { return name == "filtered.service" })
+	defer sub.Close()
+
+	changes := receiveChanges(t, sub, func(c map[string]*UnitChange) bool { return len(c) > 0 })
+	if len(changes) != 1 || changes["foo.service"] == nil {
+		t.Fatalf("Unexpected initial changes %v", changes)
+	}
+	if c := changes["foo.service"]; c.Old != nil || c.New.ActiveState != "activating" || c.New.Description != "foo" {
+		t.Fatalf("Unexpected initial state %+v", c.New)
+	}
+
+	// a lookup of a unit that is not loaded must go unnoticed
+	uc.handleSignal(unitNewSignal("missing.service"))
+	uc.handleSignal(unitRemovedSignal("missing.service"))
+
+	uc.handleSignal(unitNewSignal("filtered.service"))
+	uc.handleSignal(unitChangedSignal("filtered.service", map[string]interface{}{"LoadState": "loaded"}))
+
+	uc.handleSignal(unitNewSignal("bar@1.service"))
+	uc.handleSignal(unitChangedSignal("bar@1.service", map[string]interface{}{
+		"LoadState": "loaded", "ActiveState": "inactive", "SubState": "dead",
+	}))
+	uc.handleSignal(&dbus.Signal{
+		Name: "org.freedesktop.systemd1.Manager.JobNew",
+		Body: []interface{}{uint32(12), jobPath(12), "foo.service"},
+	})
+	uc.handleSignal(unitChangedSignal("foo.service", map[string]interface{}{"ActiveState": "active", "SubState": "running"}))
+
+	changes = receiveChanges(t, sub, func(c map[string]*UnitChange) bool {
+		return c["foo.service"] != nil && c["foo.service"].New.ActiveState == "active" && c["bar@1.service"] != nil
+	})
+	if len(changes) != 2 {
+		t.Fatalf("Expected changes of foo.service and bar@1.service, got %v", changes)
+	}
+	if c := changes["bar@1.service"]; c == nil || c.Old != nil || c.New.SubState != "dead" || c.New.Name != "bar@1.service" {
+		t.Fatalf("Unexpected change %+v", c)
+	}
+	c := changes["foo.service"]
+	if c == nil || c.Old.ActiveState != "activating" || c.New.ActiveState != "active" || c.New.JobId != 12 || c.New.JobPath != jobPath(12) {
+		t.Fatalf("Unexpected change of foo.service %+v %+v", c.Old, c.New)
+	}
+
+	uc.handleSignal(&dbus.Signal{
+		Name: "org.freedesktop.systemd1.Manager.JobRemoved",
+		Body: []interface{}{uint32(12), jobPath(12), "foo.service", "done"},
+	})
+	uc.handleSignal(unitRemovedSignal("bar@1.service"))
+
+	changes = receiveChanges(t, sub, func(c map[string]*UnitChange) bool {
+		return c["foo.service"] != nil && c["bar@1.service"] != nil
+	})
+	if c := changes["foo.service"]; c == nil || c.New.JobId != 0 || c.New.JobPath != "/" {
+		t.Fatalf("Unexpected change of foo.service %+v", c)
+	}
+	if c, ok := changes["bar@1.service"]; !ok || c.New != nil || c.Old.Name != "bar@1.service" {
+		t.Fatalf("Expected removal of bar@1.service, got %+v", c)
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Changes(); ok {
+		t.Fatal("Changes not closed")
+	}
+}
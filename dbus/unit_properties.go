@@ -0,0 +1,659 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// The structs below mirror the D-Bus interfaces of systemd units as
+// documented at https://www.freedesktop.org/wiki/Software/systemd/dbus/.
+// Field names match the D-Bus property names exactly; properties which a
+// given systemd version does not expose are left at their zero value.
+//
+// Values are converted according to the Go type of the field:
+//   - time.Duration fields hold spans given in microseconds by systemd
+//     (e.g. TimeoutStartUSec, or the *Monotonic timestamps, which are
+//     relative to boot). USEC_INFINITY is mapped to DurationInfinity.
+//   - time.Time fields hold CLOCK_REALTIME timestamps given in microseconds
+//     by systemd. A timestamp of 0, meaning "never", is the zero time.Time.
+
+// DurationInfinity is the time.Duration used for durations which systemd
+// reports as infinite (USEC_INFINITY).
+const DurationInfinity time.Duration = math.MaxInt64
+
+// UnitJob identifies the job queued for a unit, if any.
+type UnitJob struct {
+	ID   uint32          // The numeric job id, 0 if no job is queued
+	Path dbus.ObjectPath // The job object path
+}
+
+// UnitLoadError is the error encountered while loading a unit, if any.
+type UnitLoadError struct {
+	Name    string // The D-Bus error name
+	Message string // The human readable error message
+}
+
+// ExecStatus describes a command line of a unit, and its most recent
+// execution, as found in properties like ExecStart.
+type ExecStatus struct {
+	Path                    string        // The binary path to execute
+	Args                    []string      // The arguments, starting with argument 0
+	IgnoreErrors            bool          // Whether failure of the command is ignored
+	StartTimestamp          time.Time     // When the command was last started
+	StartTimestampMonotonic time.Duration // When the command was last started, relative to boot
+	ExitTimestamp           time.Time     // When the command last exited
+	ExitTimestampMonotonic  time.Duration // When the command last exited, relative to boot
+	PID                     uint32        // The PID of the last execution
+	Code                    int32         // The SIGCHLD code (CLD_EXITED, CLD_KILLED, ...) of the last execution
+	Status                  int32         // The exit status or signal of the last execution
+}
+
+// UnitProperties holds the properties of the org.freedesktop.systemd1.Unit
+// interface, which every unit implements.
+type UnitProperties struct {
+	Id                              string
+	Names                           []string
+	Following                       string
+	Requires                        []string
+	Requisite                       []string
+	Wants                           []string
+	BindsTo                         []string
+	PartOf                          []string
+	RequiredBy                      []string
+	RequisiteOf                     []string
+	WantedBy                        []string
+	BoundBy                         []string
+	ConsistsOf                      []string
+	Conflicts                       []string
+	ConflictedBy                    []string
+	Before                          []string
+	After                           []string
+	OnFailure                       []string
+	Triggers                        []string
+	TriggeredBy                     []string
+	PropagatesReloadTo              []string
+	ReloadPropagatedFrom            []string
+	JoinsNamespaceOf                []string
+	RequiresMountsFor               []string
+	Documentation                   []string
+	Description                     string
+	LoadState                       string
+	ActiveState                     string
+	SubState                        string
+	FragmentPath                    string
+	SourcePath                      string
+	DropInPaths                     []string
+	UnitFileState                   string
+	UnitFilePreset                  string
+	StateChangeTimestamp            time.Time
+	StateChangeTimestampMonotonic   time.Duration
+	InactiveExitTimestamp           time.Time
+	InactiveExitTimestampMonotonic  time.Duration
+	ActiveEnterTimestamp            time.Time
+	ActiveEnterTimestampMonotonic   time.Duration
+	ActiveExitTimestamp             time.Time
+	ActiveExitTimestampMonotonic    time.Duration
+	InactiveEnterTimestamp          time.Time
+	InactiveEnterTimestampMonotonic time.Duration
+	CanStart                        bool
+	CanStop                         bool
+	CanReload                       bool
+	CanIsolate                      bool
+	Job                             UnitJob
+	StopWhenUnneeded                bool
+	RefuseManualStart               bool
+	RefuseManualStop                bool
+	AllowIsolate                    bool
+	DefaultDependencies             bool
+	OnFailureJobMode                string
+	IgnoreOnIsolate                 bool
+	NeedDaemonReload                bool
+	JobTimeoutUSec                  time.Duration
+	JobRunningTimeoutUSec           time.Duration
+	JobTimeoutAction                string
+	ConditionResult                 bool
+	AssertResult                    bool
+	ConditionTimestamp              time.Time
+	ConditionTimestampMonotonic     time.Duration
+	AssertTimestamp                 time.Time
+	AssertTimestampMonotonic        time.Duration
+	LoadError                       UnitLoadError
+	Transient                       bool
+	Perpetual                       bool
+	StartLimitIntervalUSec          time.Duration
+	StartLimitBurst                 uint32
+	StartLimitAction                string
+	InvocationID                    []byte
+	CollectMode                     string
+}
+
+// ResourceControlProperties holds the resource control properties shared by
+// the Service, Socket, Mount, Swap, Slice and Scope interfaces. See
+// https://www.freedesktop.org/software/systemd/man/systemd.resource-control.html
+type ResourceControlProperties struct {
+	Slice              string
+	ControlGroup       string
+	Delegate           bool
+	CPUAccounting      bool
+	CPUUsageNSec       uint64 // in nanoseconds
+	CPUWeight          uint64
+	CPUShares          uint64
+	CPUQuotaPerSecUSec time.Duration
+	IOAccounting       bool
+	IOWeight           uint64
+	BlockIOAccounting  bool
+	BlockIOWeight      uint64
+	MemoryAccounting   bool
+	MemoryCurrent      uint64
+	MemoryPeak         uint64
+	MemoryLow          uint64
+	MemoryHigh         uint64
+	MemoryMax          uint64
+	MemorySwapMax      uint64
+	MemoryLimit        uint64
+	DevicePolicy       string
+	TasksAccounting    bool
+	TasksCurrent       uint64
+	TasksMax           uint64
+}
+
+// EnvironmentFile is an EnvironmentFile= setting of a unit.
+type EnvironmentFile struct {
+	Path          string // The path of the file
+	IgnoreMissing bool   // Whether a missing file is ignored
+}
+
+// ExecContextProperties holds the execution environment properties shared
+// by the Service, Socket, Mount and Swap interfaces. See
+// https://www.freedesktop.org/software/systemd/man/systemd.exec.html
+type ExecContextProperties struct {
+	Environment              []string
+	EnvironmentFiles         []EnvironmentFile
+	UMask                    uint32
+	WorkingDirectory         string
+	RootDirectory            string
+	User                     string
+	Group                    string
+	DynamicUser              bool
+	SupplementaryGroups      []string
+	StandardInput            string
+	StandardOutput           string
+	StandardError            string
+	SyslogIdentifier         string
+	Nice                     int32
+	PrivateTmp               bool
+	PrivateDevices           bool
+	PrivateNetwork           bool
+	ProtectSystem            string
+	ProtectHome              string
+	ReadWritePaths           []string
+	ReadOnlyPaths            []string
+	InaccessiblePaths        []string
+	NoNewPrivileges          bool
+	CapabilityBoundingSet    uint64
+	AmbientCapabilities      uint64
+	RuntimeDirectory         []string
+	RuntimeDirectoryMode     uint32
+	RuntimeDirectoryPreserve string
+}
+
+// KillProperties holds the process killing properties shared by the
+// Service, Socket, Mount, Swap and Scope interfaces. See
+// https://www.freedesktop.org/software/systemd/man/systemd.kill.html
+type KillProperties struct {
+	KillMode    string
+	KillSignal  int32
+	SendSIGKILL bool
+	SendSIGHUP  bool
+}
+
+// ServiceProperties holds the properties of the
+// org.freedesktop.systemd1.Service interface.
+type ServiceProperties struct {
+	Type                            string
+	Restart                         string
+	PIDFile                         string
+	NotifyAccess                    string
+	RestartUSec                     time.Duration
+	TimeoutStartUSec                time.Duration
+	TimeoutStopUSec                 time.Duration
+	RuntimeMaxUSec                  time.Duration
+	WatchdogUSec                    time.Duration
+	WatchdogTimestamp               time.Time
+	WatchdogTimestampMonotonic      time.Duration
+	PermissionsStartOnly            bool
+	RootDirectoryStartOnly          bool
+	RemainAfterExit                 bool
+	GuessMainPID                    bool
+	MainPID                         uint32
+	ControlPID                      uint32
+	BusName                         string
+	FileDescriptorStoreMax          uint32
+	NFileDescriptorStore            uint32
+	StatusText                      string
+	StatusErrno                     int32
+	Result                          string
+	UID                             uint32
+	GID                             uint32
+	NRestarts                       uint32
+	ExecMainStartTimestamp          time.Time
+	ExecMainStartTimestampMonotonic time.Duration
+	ExecMainExitTimestamp           time.Time
+	ExecMainExitTimestampMonotonic  time.Duration
+	ExecMainPID                     uint32
+	ExecMainCode                    int32
+	ExecMainStatus                  int32
+	ExecStartPre                    []ExecStatus
+	ExecStart                       []ExecStatus
+	ExecStartPost                   []ExecStatus
+	ExecReload                      []ExecStatus
+	ExecStop                        []ExecStatus
+	ExecStopPost                    []ExecStatus
+
+	ExecContextProperties
+	KillProperties
+	ResourceControlProperties
+}
+
+// SocketListen is a listening address of a socket unit.
+type SocketListen struct {
+	Type    string // The type of socket, e.g. Stream, Datagram or FIFO
+	Address string // The address, path or name listened on
+}
+
+// SocketProperties holds the properties of the
+// org.freedesktop.systemd1.Socket interface.
+type SocketProperties struct {
+	BindIPv6Only       string
+	Backlog            uint32
+	TimeoutUSec        time.Duration
+	BindToDevice       string
+	SocketUser         string
+	SocketGroup        string
+	SocketMode         uint32
+	DirectoryMode      uint32
+	Accept             bool
+	Writable           bool
+	KeepAlive          bool
+	FreeBind           bool
+	Transparent        bool
+	Broadcast          bool
+	PassCredentials    bool
+	PassSecurity       bool
+	RemoveOnStop       bool
+	Listen             []SocketListen
+	Symlinks           []string
+	FileDescriptorName string
+	MaxConnections     uint32
+	NConnections       uint32
+	NAccepted          uint32
+	ControlPID         uint32
+	Result             string
+	UID                uint32
+	GID                uint32
+	ExecStartPre       []ExecStatus
+	ExecStartPost      []ExecStatus
+	ExecStopPre        []ExecStatus
+	ExecStopPost       []ExecStatus
+
+	ExecContextProperties
+	KillProperties
+	ResourceControlProperties
+}
+
+// TimerMonotonic is a monotonic trigger of a timer unit, such as
+// OnBootSec= or OnUnitActiveSec=.
+type TimerMonotonic struct {
+	Base       string        // The setting, e.g. OnBootUSec
+	Offset     time.Duration // The configured offset
+	NextElapse time.Duration // When the trigger elapses next, relative to boot
+}
+
+// TimerCalendar is a calendar trigger of a timer unit (OnCalendar=).
+type TimerCalendar struct {
+	Base       string    // The setting, always OnCalendar
+	Expression string    // The calendar expression
+	NextElapse time.Time // When the trigger elapses next
+}
+
+// TimerProperties holds the properties of the
+// org.freedesktop.systemd1.Timer interface.
+type TimerProperties struct {
+	Unit                     string
+	TimersMonotonic          []TimerMonotonic
+	TimersCalendar           []TimerCalendar
+	NextElapseUSecRealtime   time.Time
+	NextElapseUSecMonotonic  time.Duration
+	LastTriggerUSec          time.Time
+	LastTriggerUSecMonotonic time.Duration
+	Result                   string
+	AccuracyUSec             time.Duration
+	RandomizedDelayUSec      time.Duration
+	Persistent               bool
+	WakeSystem               bool
+	RemainAfterElapse        bool
+}
+
+// MountProperties holds the properties of the
+// org.freedesktop.systemd1.Mount interface.
+type MountProperties struct {
+	Where         string
+	What          string
+	Options       string
+	Type          string
+	TimeoutUSec   time.Duration
+	ControlPID    uint32
+	DirectoryMode uint32
+	SloppyOptions bool
+	LazyUnmount   bool
+	ForceUnmount  bool
+	Result        string
+	UID           uint32
+	GID           uint32
+	ExecMount     []ExecStatus
+	ExecUnmount   []ExecStatus
+	ExecRemount   []ExecStatus
+
+	ExecContextProperties
+	KillProperties
+	ResourceControlProperties
+}
+
+// PathSpec is a path watched by a path unit.
+type PathSpec struct {
+	Type string // The setting, e.g. PathExists or PathChanged
+	Path string // The watched path
+}
+
+// PathProperties holds the properties of the
+// org.freedesktop.systemd1.Path interface.
+type PathProperties struct {
+	Unit          string
+	Paths         []PathSpec
+	MakeDirectory bool
+	DirectoryMode uint32
+	Result        string
+}
+
+// SliceProperties holds the properties of the
+// org.freedesktop.systemd1.Slice interface.
+type SliceProperties struct {
+	ResourceControlProperties
+}
+
+// ScopeProperties holds the properties of the
+// org.freedesktop.systemd1.Scope interface.
+type ScopeProperties struct {
+	Controller      string
+	TimeoutStopUSec time.Duration
+	Result          string
+
+	KillProperties
+	ResourceControlProperties
+}
+
+func (c *Conn) getTypedProperties(ctx context.Context, unit string, unitType string, dest interface{}) error {
+	props, err := c.getProperties(ctx, unit, "org.freedesktop.systemd1."+unitType)
+	if err != nil {
+		return err
+	}
+
+	return storeProperties(props, dest)
+}
+
+// GetTypedUnitProperties is like GetUnitProperties but returns the
+// properties as a UnitProperties struct.
+func (c *Conn) GetTypedUnitProperties(unit string) (*UnitProperties, error) {
+	return c.GetTypedUnitPropertiesContext(context.Background(), unit)
+}
+
+// GetTypedUnitPropertiesContext is the same as GetTypedUnitProperties with a
+// context.
+func (c *Conn) GetTypedUnitPropertiesContext(ctx context.Context, unit string) (*UnitProperties, error) {
+	p := &UnitProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Unit", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetServiceProperties returns the properties of a service unit specific
+// to the Service interface.
+func (c *Conn) GetServiceProperties(unit string) (*ServiceProperties, error) {
+	return c.GetServicePropertiesContext(context.Background(), unit)
+}
+
+// GetServicePropertiesContext is the same as GetServiceProperties with a
+// context.
+func (c *Conn) GetServicePropertiesContext(ctx context.Context, unit string) (*ServiceProperties, error) {
+	p := &ServiceProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Service", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetSocketProperties returns the properties of a socket unit specific to
+// the Socket interface.
+func (c *Conn) GetSocketProperties(unit string) (*SocketProperties, error) {
+	return c.GetSocketPropertiesContext(context.Background(), unit)
+}
+
+// GetSocketPropertiesContext is the same as GetSocketProperties with a context.
+func (c *Conn) GetSocketPropertiesContext(ctx context.Context, unit string) (*SocketProperties, error) {
+	p := &SocketProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Socket", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetTimerProperties returns the properties of a timer unit specific to the
+// Timer interface.
+func (c *Conn) GetTimerProperties(unit string) (*TimerProperties, error) {
+	return c.GetTimerPropertiesContext(context.Background(), unit)
+}
+
+// GetTimerPropertiesContext is the same as GetTimerProperties with a context.
+func (c *Conn) GetTimerPropertiesContext(ctx context.Context, unit string) (*TimerProperties, error) {
+	p := &TimerProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Timer", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetMountProperties returns the properties of a mount unit specific to the
+// Mount interface.
+func (c *Conn) GetMountProperties(unit string) (*MountProperties, error) {
+	return c.GetMountPropertiesContext(context.Background(), unit)
+}
+
+// GetMountPropertiesContext is the same as GetMountProperties with a context.
+func (c *Conn) GetMountPropertiesContext(ctx context.Context, unit string) (*MountProperties, error) {
+	p := &MountProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Mount", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetPathProperties returns the properties of a path unit specific to the
+// Path interface.
+func (c *Conn) GetPathProperties(unit string) (*PathProperties, error) {
+	return c.GetPathPropertiesContext(context.Background(), unit)
+}
+
+// GetPathPropertiesContext is the same as GetPathProperties with a context.
+func (c *Conn) GetPathPropertiesContext(ctx context.Context, unit string) (*PathProperties, error) {
+	p := &PathProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Path", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetSliceProperties returns the properties of a slice unit specific to the
+// Slice interface.
+func (c *Conn) GetSliceProperties(unit string) (*SliceProperties, error) {
+	return c.GetSlicePropertiesContext(context.Background(), unit)
+}
+
+// GetSlicePropertiesContext is the same as GetSliceProperties with a context.
+func (c *Conn) GetSlicePropertiesContext(ctx context.Context, unit string) (*SliceProperties, error) {
+	p := &SliceProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Slice", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetScopeProperties returns the properties of a scope unit specific to the
+// Scope interface.
+func (c *Conn) GetScopeProperties(unit string) (*ScopeProperties, error) {
+	return c.GetScopePropertiesContext(context.Background(), unit)
+}
+
+// GetScopePropertiesContext is the same as GetScopeProperties with a context.
+func (c *Conn) GetScopePropertiesContext(ctx context.Context, unit string) (*ScopeProperties, error) {
+	p := &ScopeProperties{}
+	if err := c.getTypedProperties(ctx, unit, "Scope", p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// storeProperties copies the values of props, as returned by getProperties,
+// into the fields of the struct pointed to by dest with the same name.
+// Embedded structs are filled from the same set of properties.
+func storeProperties(props map[string]interface{}, dest interface{}) error {
+	return storePropertyStruct(props, reflect.ValueOf(dest).Elem())
+}
+
+func storePropertyStruct(props map[string]interface{}, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			if err := storePropertyStruct(props, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, ok := props[f.Name]
+		if !ok {
+			continue
+		}
+
+		if err := storePropertyValue(v.Field(i), val); err != nil {
+			return fmt.Errorf("property %s: %v", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func storePropertyValue(dest reflect.Value, src interface{}) error {
+	if v, ok := src.(dbus.Variant); ok {
+		src = v.Value()
+	}
+
+	mismatch := fmt.Errorf("cannot store %T in %s", src, dest.Type())
+
+	switch dest.Type() {
+	case durationType:
+		usec, ok := src.(uint64)
+		if !ok {
+			return mismatch
+		}
+		dest.SetInt(int64(usecToDuration(usec)))
+		return nil
+	case timeType:
+		usec, ok := src.(uint64)
+		if !ok {
+			return mismatch
+		}
+		dest.Set(reflect.ValueOf(usecToTime(usec)))
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	switch dest.Kind() {
+	case reflect.Struct:
+		// structs are decoded as slices of interface{}
+		fields, ok := src.([]interface{})
+		if !ok || len(fields) != dest.NumField() {
+			return mismatch
+		}
+		for i := range fields {
+			if err := storePropertyValue(dest.Field(i), fields[i]); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if sv.Kind() != reflect.Slice {
+			return mismatch
+		}
+		if sv.Type().AssignableTo(dest.Type()) {
+			dest.Set(sv)
+			return nil
+		}
+		s := reflect.MakeSlice(dest.Type(), sv.Len(), sv.Len())
+		for i := 0; i < sv.Len(); i++ {
+			if err := storePropertyValue(s.Index(i), sv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		dest.Set(s)
+	default:
+		if sv.Kind() != dest.Kind() {
+			return mismatch
+		}
+		dest.Set(sv.Convert(dest.Type()))
+	}
+
+	return nil
+}
+
+// usecToDuration converts a span in microseconds, as used by systemd, to a
+// time.Duration.
+func usecToDuration(usec uint64) time.Duration {
+	if usec > uint64(DurationInfinity/time.Microsecond) {
+		return DurationInfinity
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// usecToTime converts a CLOCK_REALTIME timestamp in microseconds, as used by
+// systemd, to a time.Time. 0 is converted to the zero time.Time.
+func usecToTime(usec uint64) time.Time {
+	if usec == 0 || usec > math.MaxInt64/1000 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(usec)*int64(time.Microsecond))
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func TestStoreProperties(t *testing.T) {
+	props := map[string]interface{}{
+		"Type":                   "simple",
+		"TimeoutStartUSec":       uint64(90000000),
+		"RuntimeMaxUSec":         uint64(math.MaxUint64),
+		"ExecMainStartTimestamp": uint64(1500000000000000),
+		"ExecMainExitTimestamp":  uint64(0),
+		"MainPID":                uint32(42),
+		"ExecMainStatus":         int32(3),
+		"ExecStart": [][]interface{}{
+			{"/bin/sleep", []string{"/bin/sleep", "400"}, false, uint64(1500000000000000), uint64(1000000), uint64(0), uint64(0), uint32(42), int32(0), int32(0)},
+		},
+		"Environment":        []string{"FOO=bar"},
+		"EnvironmentFiles":   [][]interface{}{{"/etc/default/foo", true}},
+		"KillMode":           "control-group",
+		"MemoryCurrent":      uint64(4096),
+		"UnknownProperty":    "ignored",
+		"CPUQuotaPerSecUSec": dbus.MakeVariant(uint64(500000)),
+	}
+
+	var p ServiceProperties
+	if err := storeProperties(props, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Type != "simple" {
+		t.Errorf("Type: got %q", p.Type)
+	}
+	if p.TimeoutStartUSec != 90*time.Second {
+		t.Errorf("TimeoutStartUSec: got %v", p.TimeoutStartUSec)
+	}
+	if p.RuntimeMaxUSec != DurationInfinity {
+		t.Errorf("RuntimeMaxUSec: got %v, want DurationInfinity", p.RuntimeMaxUSec)
+	}
+	if !p.ExecMainStartTimestamp.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("ExecMainStartTimestamp: got %v", p.ExecMainStartTimestamp)
+	}
+	if !p.ExecMainExitTimestamp.IsZero() {
+		t.Errorf("ExecMainExitTimestamp: got %v, want zero time", p.ExecMainExitTimestamp)
+	}
+	if p.MainPID != 42 || p.ExecMainStatus != 3 {
+		t.Errorf("MainPID/ExecMainStatus: got %d/%d", p.MainPID, p.ExecMainStatus)
+	}
+
+	if len(p.ExecStart) != 1 {
+		t.Fatalf("ExecStart: got %d entries, want 1", len(p.ExecStart))
+	}
+	exec := p.ExecStart[0]
+	if exec.Path != "/bin/sleep" || !reflect.DeepEqual(exec.Args, []string{"/bin/sleep", "400"}) {
+		t.Errorf("ExecStart: got %+v", exec)
+	}
+	if exec.StartTimestampMonotonic != time.Second || exec.PID != 42 {
+		t.Errorf("ExecStart: got %+v", exec)
+	}
+
+	if !reflect.DeepEqual(p.Environment, []string{"FOO=bar"}) {
+		t.Errorf("Environment: got %v", p.Environment)
+	}
+	if len(p.EnvironmentFiles) != 1 || p.EnvironmentFiles[0] != (EnvironmentFile{"/etc/default/foo", true}) {
+		t.Errorf("EnvironmentFiles: got %v", p.EnvironmentFiles)
+	}
+	if p.KillMode != "control-group" {
+		t.Errorf("KillMode: got %q", p.KillMode)
+	}
+	if p.MemoryCurrent != 4096 || p.CPUQuotaPerSecUSec != 500*time.Millisecond {
+		t.Errorf("resource control: got %d/%v", p.MemoryCurrent, p.CPUQuotaPerSecUSec)
+	}
+}
+
+func TestStorePropertiesTypeMismatch(t *testing.T) {
+	for _, props := range []map[string]interface{}{
+		{"Id": uint32(1)},
+		{"Names": "foo.service"},
+		{"ActiveEnterTimestamp": "yesterday"},
+		{"Job": []interface{}{uint32(1)}},
+	} {
+		var p UnitProperties
+		if err := storeProperties(props, &p); err == nil {
+			t.Errorf("storeProperties(%v) succeeded, expected an error", props)
+		}
+	}
+}
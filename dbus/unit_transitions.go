@@ -0,0 +1,307 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// UnitState is the state of a unit, as reported in a UnitTransition.
+type UnitState struct {
+	ActiveState string // The active state, e.g. active or failed
+	SubState    string // The unit type specific sub state, e.g. running or exited
+	Result      string // The result of the unit, e.g. success or exit-code; empty if unknown or if the unit type has no result
+}
+
+// UnitTransition is a change of a unit's state, as sent by a
+// TransitionSubscription.
+type UnitTransition struct {
+	Unit string    // The primary unit name
+	From UnitState // The state before the transition, empty if the unit was unknown
+	To   UnitState // The state after the transition
+
+	StateChangeTimestamp   time.Time // When the unit's state last changed
+	ActiveEnterTimestamp   time.Time // When the unit last entered the active state
+	ActiveExitTimestamp    time.Time // When the unit last left the active state
+	InactiveEnterTimestamp time.Time // When the unit last entered the inactive state
+	InactiveExitTimestamp  time.Time // When the unit last left the inactive state
+
+	// Overflow is set on the event sent in place of transitions which had
+	// to be dropped because the receiver did not keep up. All other fields
+	// are empty, and the receiver should resync its view of the units'
+	// states, e.g. with ListUnits.
+	Overflow bool
+}
+
+// TransitionBackpressure selects what a TransitionSubscription does when its
+// buffer is full.
+type TransitionBackpressure int
+
+const (
+	// TransitionBlock waits for the receiver to make room in the buffer.
+	// No transition is lost, but the connection's signal processing,
+	// including job completion, is stalled meanwhile.
+	TransitionBlock TransitionBackpressure = iota
+	// TransitionDropOldest drops the oldest buffered transition and sends
+	// an Overflow event before the remaining ones.
+	TransitionDropOldest
+	// TransitionCoalesce merges a transition into the last buffered
+	// transition of the same unit, losing the intermediate state. The
+	// transitions of each unit stay in order, but may be sent before
+	// transitions of other units which happened earlier. If the unit has
+	// no buffered transition, the oldest one is dropped as with
+	// TransitionDropOldest.
+	TransitionCoalesce
+)
+
+// TransitionSubscription delivers the ordered transitions of the units'
+// ActiveState, SubState and Result.
+type TransitionSubscription struct {
+	cache      *unitCache
+	filterUnit func(string) bool
+	buffer     int
+	mode       TransitionBackpressure
+
+	mu       sync.Mutex
+	queue    []*UnitTransition
+	overflow bool
+	err      error
+
+	notify      chan struct{}
+	space       chan struct{}
+	transitions chan *UnitTransition
+	done        chan struct{}
+	once        sync.Once
+}
+
+// SubscribeUnitTransitions returns a subscription to the transitions of all
+// units' ActiveState, SubState and Result, in the order they are signaled by
+// systemd. Like SubscribeUnitChanges, it is driven by the values carried by
+// systemd's signals and does not fetch the units' properties.
+//
+// Up to buffer transitions are buffered until they are received, mode selects
+// what happens once the buffer is full. filterUnit, if not nil, returns true
+// for the names of units which should not be reported. It must not block.
+func (c *Conn) SubscribeUnitTransitions(buffer int, mode TransitionBackpressure, filterUnit func(string) bool) (*TransitionSubscription, error) {
+	return c.SubscribeUnitTransitionsContext(context.Background(), buffer, mode, filterUnit)
+}
+
+// SubscribeUnitTransitionsContext is the same as SubscribeUnitTransitions
+// with a context.
+func (c *Conn) SubscribeUnitTransitionsContext(ctx context.Context, buffer int, mode TransitionBackpressure, filterUnit func(string) bool) (*TransitionSubscription, error) {
+	if err := c.loadUnitCache(ctx); err != nil {
+		return nil, err
+	}
+	return c.units.subscribeTransitions(buffer, mode, filterUnit), nil
+}
+
+// Transitions returns the channel the subscription's transitions are sent to.
+// The channel is closed by Close, or once the connection is closed or lost,
+// see Err.
+func (s *TransitionSubscription) Transitions() <-chan *UnitTransition {
+	return s.transitions
+}
+
+// Err returns why the channel returned by Transitions was closed: nil if it
+// was closed by Close, or an error if the connection was closed, or lost while
+// reconnecting is not enabled.
+func (s *TransitionSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the subscription.
+func (s *TransitionSubscription) Close() {
+	s.once.Do(func() {
+		// done is closed first, as a blocked push holds the cache's
+		// lock.
+		close(s.done)
+		s.cache.Lock()
+		delete(s.cache.transitionSubs, s)
+		s.cache.Unlock()
+	})
+}
+
+// stop ends the subscription with err.
+func (s *TransitionSubscription) stop(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+func (uc *unitCache) subscribeTransitions(buffer int, mode TransitionBackpressure, filterUnit func(string) bool) *TransitionSubscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &TransitionSubscription{
+		cache:       uc,
+		filterUnit:  filterUnit,
+		buffer:      buffer,
+		mode:        mode,
+		notify:      make(chan struct{}, 1),
+		space:       make(chan struct{}, 1),
+		transitions: make(chan *UnitTransition),
+		done:        make(chan struct{}),
+	}
+
+	uc.Lock()
+	stopped := uc.stopped
+	if stopped == nil {
+		if uc.transitionSubs == nil {
+			uc.transitionSubs = make(map[*TransitionSubscription]struct{})
+		}
+		uc.transitionSubs[s] = struct{}{}
+	}
+	uc.Unlock()
+
+	go s.run()
+	if stopped != nil {
+		s.stop(stopped)
+	}
+	return s
+}
+
+// transition sends the transition of u from old, if any, to the
+// subscriptions. changed are the properties of the signal which caused it. It
+// must be called with uc locked.
+func (uc *unitCache) transition(u *cachedUnit, old *UnitStatus, changed map[string]dbus.Variant) {
+	if old.ActiveState == u.status.ActiveState &&
+		old.SubState == u.status.SubState &&
+		u.reportedResult == u.result {
+		return
+	}
+
+	t := &UnitTransition{
+		Unit: u.status.Name,
+		From: UnitState{old.ActiveState, old.SubState, u.reportedResult},
+		To:   UnitState{u.status.ActiveState, u.status.SubState, u.result},
+	}
+	u.reportedResult = u.result
+
+	for name, ts := range map[string]*time.Time{
+		"StateChangeTimestamp":   &t.StateChangeTimestamp,
+		"ActiveEnterTimestamp":   &t.ActiveEnterTimestamp,
+		"ActiveExitTimestamp":    &t.ActiveExitTimestamp,
+		"InactiveEnterTimestamp": &t.InactiveEnterTimestamp,
+		"InactiveExitTimestamp":  &t.InactiveExitTimestamp,
+	} {
+		if usec, ok := changed[name].Value().(uint64); ok {
+			*ts = usecToTime(usec)
+		}
+	}
+
+	for s := range uc.transitionSubs {
+		c := *t
+		s.push(&c)
+	}
+}
+
+// push buffers a transition according to the subscription's backpressure
+// mode.
+func (s *TransitionSubscription) push(t *UnitTransition) {
+	if s.filterUnit != nil && s.filterUnit(t.Unit) {
+		return
+	}
+
+	s.mu.Lock()
+	for len(s.queue) >= s.buffer && s.mode == TransitionBlock {
+		s.mu.Unlock()
+		select {
+		case <-s.space:
+		case <-s.done:
+			return
+		case <-s.cache.halted():
+			return
+		}
+		s.mu.Lock()
+	}
+
+	switch {
+	case len(s.queue) < s.buffer:
+		s.queue = append(s.queue, t)
+	case s.mode == TransitionCoalesce && s.coalesce(t):
+	default:
+		s.queue = append(s.queue[1:], t)
+		s.overflow = true
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// coalesce merges t into the last buffered transition of the same unit, and
+// returns false if there is none. It must be called with s.mu locked.
+func (s *TransitionSubscription) coalesce(t *UnitTransition) bool {
+	for i := len(s.queue) - 1; i >= 0; i-- {
+		if q := s.queue[i]; q.Unit == t.Unit {
+			t.From = q.From
+			s.queue[i] = t
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TransitionSubscription) run() {
+	defer close(s.transitions)
+
+	for {
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+
+		for {
+			s.mu.Lock()
+			var t *UnitTransition
+			switch {
+			case s.overflow:
+				t = &UnitTransition{Overflow: true}
+				s.overflow = false
+			case len(s.queue) > 0:
+				t = s.queue[0]
+				s.queue = s.queue[1:]
+			}
+			s.mu.Unlock()
+
+			if t == nil {
+				break
+			}
+
+			select {
+			case s.space <- struct{}{}:
+			default:
+			}
+
+			select {
+			case s.transitions <- t:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
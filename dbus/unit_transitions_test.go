@@ -0,0 +1,173 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func serviceChangedSignal(name, result string) *dbus.Signal {
+	return &dbus.Signal{
+		Path: UnitPath(name),
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{
+			"org.freedesktop.systemd1.Service",
+			map[string]dbus.Variant{"Result": dbus.MakeVariant(result)},
+			[]string{},
+		},
+	}
+}
+
+func newTransitionTestCache() *unitCache {
+	uc := &unitCache{}
+	uc.Lock()
+	uc.populate([]UnitStatus{
+		{Name: "foo.service", LoadState: "loaded", ActiveState: "inactive", SubState: "dead", Path: UnitPath("foo.service"), JobPath: "/"},
+		{Name: "bar.service", LoadState: "loaded", ActiveState: "inactive", SubState: "dead", Path: UnitPath("bar.service"), JobPath: "/"},
+	})
+	uc.Unlock()
+	return uc
+}
+
+// flapUnit sends the signals of a unit which starts and fails right away.
+func flapUnit(uc *unitCache, name string) {
+	uc.handleSignal(unitChangedSignal(name, map[string]interface{}{
+		"ActiveState": "active", "SubState": "running", "StateChangeTimestamp": uint64(1500000000000000),
+	}))
+	uc.handleSignal(serviceChangedSignal(name, "exit-code"))
+	uc.handleSignal(unitChangedSignal(name, map[string]interface{}{
+		"ActiveState": "failed", "SubState": "failed", "StateChangeTimestamp": uint64(1500000001000000),
+	}))
+}
+
+func receiveTransition(t *testing.T, sub *TransitionSubscription) *UnitTransition {
+	select {
+	case tr := <-sub.Transitions():
+		return tr
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a transition")
+	}
+	return nil
+}
+
+func TestUnitTransitionsBlock(t *testing.T) {
+	uc := newTransitionTestCache()
+	sub := uc.subscribeTransitions(1, TransitionBlock, nil)
+	defer sub.Close()
+
+	go flapUnit(uc, "foo.service")
+
+	tr := receiveTransition(t, sub)
+	if tr.Unit != "foo.service" || tr.From != (UnitState{"inactive", "dead", ""}) || tr.To != (UnitState{"active", "running", ""}) {
+		t.Fatalf("Unexpected transition %+v", tr)
+	}
+	if !tr.StateChangeTimestamp.Equal(time.Unix(1500000000, 0)) {
+		t.Fatalf("Unexpected timestamp %v", tr.StateChangeTimestamp)
+	}
+
+	tr = receiveTransition(t, sub)
+	if tr.From != (UnitState{"active", "running", ""}) || tr.To != (UnitState{"failed", "failed", "exit-code"}) {
+		t.Fatalf("Unexpected transition %+v", tr)
+	}
+}
+
+// TestUnitTransitionsStop ensures that stopping the cache ends the
+// subscriptions, even while a push is blocked, as well as the ones made later.
+func TestUnitTransitionsStop(t *testing.T) {
+	uc := newTransitionTestCache()
+	sub := uc.subscribeTransitions(1, TransitionBlock, nil)
+	defer sub.Close()
+
+	// Nothing is received, so the last transitions block.
+	flapped := make(chan struct{})
+	go func() {
+		flapUnit(uc, "foo.service")
+		flapUnit(uc, "bar.service")
+		close(flapped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	uc.stop(errConnClosed)
+	<-flapped
+
+	later := uc.subscribeTransitions(1, TransitionBlock, nil)
+	for _, s := range []*TransitionSubscription{sub, later} {
+		timeout := time.After(5 * time.Second)
+	drain:
+		for {
+			select {
+			case _, ok := <-s.Transitions():
+				if !ok {
+					break drain
+				}
+			case <-timeout:
+				t.Fatal("Timed out waiting for the channel to be closed")
+			}
+		}
+		if err := s.Err(); err != errConnClosed {
+			t.Fatalf("Expected errConnClosed, got %v", err)
+		}
+	}
+}
+
+func TestUnitTransitionsDropOldest(t *testing.T) {
+	uc := newTransitionTestCache()
+	sub := uc.subscribeTransitions(1, TransitionDropOldest, nil)
+	defer sub.Close()
+
+	// Nothing is received meanwhile, so at most one transition is in
+	// flight and one is buffered.
+	flapUnit(uc, "foo.service")
+	flapUnit(uc, "bar.service")
+
+	var overflow bool
+	for {
+		tr := receiveTransition(t, sub)
+		if tr.Overflow {
+			overflow = true
+			continue
+		}
+		if tr.Unit == "bar.service" && tr.To.ActiveState == "failed" {
+			break
+		}
+	}
+	if !overflow {
+		t.Fatal("No overflow event was sent")
+	}
+}
+
+func TestUnitTransitionsCoalesce(t *testing.T) {
+	// Not started, so that nothing is taken from the queue.
+	sub := &TransitionSubscription{buffer: 2, mode: TransitionCoalesce, notify: make(chan struct{}, 1)}
+
+	sub.push(&UnitTransition{Unit: "foo.service", From: UnitState{"inactive", "dead", ""}, To: UnitState{"active", "running", ""}})
+	sub.push(&UnitTransition{Unit: "bar.service", From: UnitState{"inactive", "dead", ""}, To: UnitState{"active", "running", ""}})
+	sub.push(&UnitTransition{Unit: "foo.service", From: UnitState{"active", "running", ""}, To: UnitState{"failed", "failed", "exit-code"}})
+
+	if sub.overflow || len(sub.queue) != 2 {
+		t.Fatalf("Unexpected queue %v, overflow %v", sub.queue, sub.overflow)
+	}
+	if tr := sub.queue[0]; tr.Unit != "foo.service" || tr.From != (UnitState{"inactive", "dead", ""}) || tr.To != (UnitState{"failed", "failed", "exit-code"}) {
+		t.Fatalf("Unexpected transition %+v", tr)
+	}
+
+	sub.push(&UnitTransition{Unit: "baz.service"})
+	if !sub.overflow || len(sub.queue) != 2 || sub.queue[0].Unit != "bar.service" || sub.queue[1].Unit != "baz.service" {
+		t.Fatalf("Unexpected queue %v, overflow %v", sub.queue, sub.overflow)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/godbus/dbus"
+)
+
+// errUnixFDsNotSupported is returned when passing file descriptors, e.g. with
+// PropStandardInputFileDescriptor, on a connection which can't.
+var errUnixFDsNotSupported = errors.New("dbus: unix fd passing not supported by the connection")
+
+// unixFDConns maps the connections created by newUnixFDConn to their
+// *unixFDConn.
+var unixFDConns sync.Map
+
+// unixFDConn is the socket of a connection able to send the file descriptors
+// nested in method arguments, such as the ones of the StandardInput, Output
+// and ErrorFileDescriptor properties. godbus only passes the descriptors
+// which are arguments themselves, so the connection uses a generic godbus
+// transport on top of unixFDConn: it negotiates file descriptor passing when
+// godbus ends the authentication, and send attaches the descriptors to the
+// message written.
+type unixFDConn struct {
+	*net.UnixConn
+	bus *dbus.Conn
+
+	// begun is set once the authentication ended, and agreed if the peer
+	// accepted file descriptors then. Neither changes once godbus sends
+	// messages.
+	begun, agreed bool
+
+	// sendMu serializes send, mu guards fds, the descriptors to attach to
+	// the next message declaring some.
+	sendMu sync.Mutex
+	mu     sync.Mutex
+	fds    []int
+}
+
+// newUnixFDConn returns an unauthenticated connection on the socket uc.
+func newUnixFDConn(uc *net.UnixConn) (*dbus.Conn, error) {
+	u := &unixFDConn{UnixConn: uc}
+	bus, err := dbus.NewConn(u)
+	if err != nil {
+		uc.Close()
+		return nil, err
+	}
+	u.bus = bus
+	unixFDConns.Store(bus, u)
+	return bus, nil
+}
+
+// dialUnixFD connects to a D-Bus address like dbus.Dial. Only the addresses
+// of a single unix socket get a connection able to pass file descriptors.
+func dialUnixFD(address string) (*dbus.Conn, error) {
+	name, ok := unixSocketName(address)
+	if !ok {
+		return dbus.Dial(address)
+	}
+	uc, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: name, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	return newUnixFDConn(uc)
+}
+
+// unixSocketName returns the socket name of a unix:path= or unix:abstract=
+// address.
+func unixSocketName(address string) (string, bool) {
+	if !strings.HasPrefix(address, "unix:") || strings.Contains(address, ";") {
+		return "", false
+	}
+	var name string
+	for _, kv := range strings.Split(strings.TrimPrefix(address, "unix:"), ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return "", false
+		}
+		value, err := url.PathUnescape(parts[1])
+		if err != nil {
+			return "", false
+		}
+		switch parts[0] {
+		case "path":
+			name = value
+		case "abstract":
+			name = "@" + value
+		case "guid":
+		default:
+			return "", false
+		}
+	}
+	return name, name != ""
+}
+
+// systemBusPrivate is the same as dbus.SystemBusPrivate, with a connection
+// able to pass file descriptors.
+func systemBusPrivate() (*dbus.Conn, error) {
+	address := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	if address == "" {
+		address = "unix:path=/var/run/dbus/system_bus_socket"
+	}
+	return dialUnixFD(address)
+}
+
+// sessionBusPrivate is the same as dbus.SessionBusPrivate, with a connection
+// able to pass file descriptors if DBUS_SESSION_BUS_ADDRESS is a unix socket.
+func sessionBusPrivate() (*dbus.Conn, error) {
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if address == "" || address == "autolaunch:" {
+		return dbus.SessionBusPrivate()
+	}
+	return dialUnixFD(address)
+}
+
+func (u *unixFDConn) Write(b []byte) (int, error) {
+	if !u.begun {
+		if string(b) == "BEGIN\r\n" {
+			u.begun = true
+			if err := u.negotiate(); err != nil {
+				return 0, err
+			}
+		}
+		return u.UnixConn.Write(b)
+	}
+
+	u.mu.Lock()
+	fds := u.fds
+	if fds != nil && declaresUnixFDs(b) {
+		u.fds = nil
+	} else {
+		fds = nil
+	}
+	u.mu.Unlock()
+	if fds == nil {
+		return u.UnixConn.Write(b)
+	}
+
+	oob := syscall.UnixRights(fds...)
+	n, oobn, err := u.WriteMsgUnix(b, oob, nil)
+	if err == nil && (n != len(b) || oobn != len(oob)) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+// negotiate asks the peer to accept file descriptors, before godbus ends the
+// authentication.
+func (u *unixFDConn) negotiate() error {
+	if _, err := io.WriteString(u.UnixConn, "NEGOTIATE_UNIX_FD\r\n"); err != nil {
+		return err
+	}
+	// Read byte by byte, as the messages following the reply are
+	// godbus's to read.
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) == 0 || line[len(line)-1] != '\n' {
+		if _, err := u.UnixConn.Read(b); err != nil {
+			return err
+		}
+		line = append(line, b[0])
+	}
+	u.agreed = bytes.HasPrefix(line, []byte("AGREE_UNIX_FD"))
+	return nil
+}
+
+// declaresUnixFDs returns whether the encoded message b has a UNIX_FDS
+// header.
+func declaresUnixFDs(b []byte) bool {
+	msg, err := dbus.DecodeMessage(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+	_, ok := msg.Headers[dbus.FieldUnixFDs]
+	return ok
+}
+
+func (u *unixFDConn) Close() error {
+	unixFDConns.Delete(u.bus)
+	return u.UnixConn.Close()
+}
+
+// sendUnixFDs sends msg on bus like bus.Send, with fds, the file descriptors
+// its dbus.UnixFDIndex values refer to, attached. On error, the returned call
+// is sent to ch as well.
+func sendUnixFDs(bus *dbus.Conn, msg *dbus.Message, fds []int, ch chan *dbus.Call) *dbus.Call {
+	if ch == nil {
+		ch = make(chan *dbus.Call, 1)
+	}
+	v, ok := unixFDConns.Load(bus)
+	if !ok || !v.(*unixFDConn).agreed {
+		call := &dbus.Call{Err: errUnixFDsNotSupported, Done: ch}
+		ch <- call
+		return call
+	}
+	u := v.(*unixFDConn)
+
+	msg.Headers[dbus.FieldUnixFDs] = dbus.MakeVariant(uint32(len(fds)))
+	u.sendMu.Lock()
+	defer u.sendMu.Unlock()
+	u.mu.Lock()
+	u.fds = fds
+	u.mu.Unlock()
+	call := bus.Send(msg, ch)
+	// The message was not written if the connection is closed.
+	u.mu.Lock()
+	u.fds = nil
+	u.mu.Unlock()
+	return call
+}
+
+// extractUnixFDs returns args with the dbus.UnixFD values, including the ones
+// in properties, replaced by their dbus.UnixFDIndex, and the file descriptors
+// in index order. args is returned as is if it holds none.
+func extractUnixFDs(args []interface{}) ([]interface{}, []int) {
+	var fds []int
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		out[i] = replaceUnixFDs(arg, &fds)
+	}
+	if len(fds) == 0 {
+		return args, nil
+	}
+	return out, fds
+}
+
+func replaceUnixFDs(v interface{}, fds *[]int) interface{} {
+	switch v := v.(type) {
+	case dbus.UnixFD:
+		*fds = append(*fds, int(v))
+		return dbus.UnixFDIndex(len(*fds) - 1)
+	case dbus.Variant:
+		n := len(*fds)
+		value := replaceUnixFDs(v.Value(), fds)
+		if len(*fds) == n {
+			return v
+		}
+		return dbus.MakeVariant(value)
+	case Property:
+		return Property{Name: v.Name, Value: replaceUnixFDs(v.Value, fds).(dbus.Variant)}
+	case []Property:
+		props := make([]Property, len(v))
+		for i, p := range v {
+			props[i] = replaceUnixFDs(p, fds).(Property)
+		}
+		return props
+	case []PropertyCollection:
+		aux := make([]PropertyCollection, len(v))
+		for i, a := range v {
+			aux[i] = PropertyCollection{Name: a.Name, Properties: replaceUnixFDs(a.Properties, fds).([]Property)}
+		}
+		return aux
+	}
+	return v
+}
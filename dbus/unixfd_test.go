@@ -0,0 +1,42 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+)
+
+func TestUnixSocketName(t *testing.T) {
+	tests := []struct {
+		address string
+		name    string
+		ok      bool
+	}{
+		{"unix:path=/run/systemd/private", "/run/systemd/private", true},
+		{"unix:path=/run/user/1000/bus,guid=0123456789abcdef", "/run/user/1000/bus", true},
+		{"unix:abstract=/tmp/dbus-X", "@/tmp/dbus-X", true},
+		{"unix:path=/tmp/a%20b", "/tmp/a b", true},
+		{"unix:tmpdir=/tmp", "", false},
+		{"unix:path=/a;unix:path=/b", "", false},
+		{"tcp:host=localhost,port=1234", "", false},
+		{"unix:guid=0123456789abcdef", "", false},
+	}
+	for _, tt := range tests {
+		name, ok := unixSocketName(tt.address)
+		if name != tt.name || ok != tt.ok {
+			t.Errorf("unixSocketName(%q) = %q, %v, want %q, %v", tt.address, name, ok, tt.name, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diagnostics gathers what is needed to understand why a systemd unit
+// failed, like 'systemctl status' shows it: the unit's state and result from
+// the dbus package, and its journal from the sdjournal package. Like
+// sdjournal, it requires cgo and the journal headers to be available.
+package diagnostics
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// UnitDiagnostics is the state of a unit, as returned by Collect.
+type UnitDiagnostics struct {
+	Name           string                    // The unit name, as passed to Collect
+	LoadState      string                    // The load state, e.g. loaded or not-found
+	ActiveState    string                    // The active state, e.g. active or failed
+	SubState       string                    // The sub state, specific to the unit type
+	Result         string                    // The unit result, e.g. exit-code, empty if the unit type has none
+	ExecMainCode   int32                     // How the main process exited, one of CLD_EXITED, CLD_KILLED or CLD_DUMPED (services only)
+	ExecMainStatus int32                     // The exit status or, if killed, the signal number of the main process (services only)
+	NRestarts      uint32                    // How many times the service was restarted automatically (services only)
+	InvocationID   []byte                    // The 128-bit invocation ID of the unit's current or last run, empty if it never ran
+	FragmentPath   string                    // The path of the unit file, empty if there is none
+	DropInPaths    []string                  // The paths of the drop-in files applied to the unit file
+	Processes      []dbus.UnitProcess        // The processes in the unit's control group
+	Journal        []*sdjournal.JournalEntry // The last journal entries of the unit's current or last run, oldest first
+}
+
+// Collect returns the state of the unit name, including up to lines of the
+// last journal entries of its current or last run: the messages logged by its
+// processes, and by systemd about it. The journal is not read if lines is 0.
+// Requires systemd 238 or newer.
+func Collect(conn *dbus.Conn, name string, lines int) (*UnitDiagnostics, error) {
+	return CollectContext(context.Background(), conn, name, lines)
+}
+
+// CollectContext is the same as Collect with a context. The context does not
+// apply to reading the journal.
+func CollectContext(ctx context.Context, conn *dbus.Conn, name string, lines int) (*UnitDiagnostics, error) {
+	d, err := collectUnit(ctx, conn, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if lines > 0 && len(d.InvocationID) > 0 {
+		d.Journal, err = readJournal(d.InvocationID, lines)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// unitGetter is the part of dbus.Conn used by collectUnit.
+type unitGetter interface {
+	GetTypedUnitPropertiesContext(ctx context.Context, unit string) (*dbus.UnitProperties, error)
+	GetServicePropertiesContext(ctx context.Context, unit string) (*dbus.ServiceProperties, error)
+	GetUnitTypePropertyContext(ctx context.Context, unit string, unitType string, propertyName string) (*dbus.Property, error)
+	GetUnitProcessesContext(ctx context.Context, name string) ([]dbus.UnitProcess, error)
+}
+
+// collectUnit returns the state of the unit name, without its journal.
+func collectUnit(ctx context.Context, conn unitGetter, name string) (*UnitDiagnostics, error) {
+	unit, err := conn.GetTypedUnitPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &UnitDiagnostics{
+		Name:         name,
+		LoadState:    unit.LoadState,
+		ActiveState:  unit.ActiveState,
+		SubState:     unit.SubState,
+		InvocationID: unit.InvocationID,
+		FragmentPath: unit.FragmentPath,
+		DropInPaths:  unit.DropInPaths,
+	}
+
+	switch ext := path.Ext(name); ext {
+	case ".service":
+		service, err := conn.GetServicePropertiesContext(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		d.Result = service.Result
+		d.ExecMainCode = service.ExecMainCode
+		d.ExecMainStatus = service.ExecMainStatus
+		d.NRestarts = service.NRestarts
+	case ".socket", ".mount", ".swap", ".timer", ".path", ".automount", ".scope":
+		unitType := strings.Title(strings.TrimPrefix(ext, "."))
+		prop, err := conn.GetUnitTypePropertyContext(ctx, name, unitType, "Result")
+		if err != nil {
+			return nil, err
+		}
+		d.Result, _ = prop.Value.Value().(string)
+	}
+
+	// Units which are not loaded, e.g. failed ones which have been
+	// garbage collected meanwhile, have no processes.
+	d.Processes, err = conn.GetUnitProcessesContext(ctx, name)
+	if errors.Is(err, dbus.ErrNoSuchUnit) {
+		d.Processes, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// readJournal returns up to lines of the last journal entries of the unit run
+// with the given invocation ID, oldest first.
+func readJournal(invocationID []byte, lines int) ([]*sdjournal.JournalEntry, error) {
+	j, err := sdjournal.NewJournal()
+	if err != nil {
+		return nil, err
+	}
+	defer j.Close()
+
+	// The unit's processes log with _SYSTEMD_INVOCATION_ID, systemd's
+	// messages about the unit carry INVOCATION_ID.
+	id := hex.EncodeToString(invocationID)
+	if err := j.AddMatch("_SYSTEMD_INVOCATION_ID=" + id); err != nil {
+		return nil, err
+	}
+	if err := j.AddDisjunction(); err != nil {
+		return nil, err
+	}
+	if err := j.AddMatch("INVOCATION_ID=" + id); err != nil {
+		return nil, err
+	}
+
+	if err := j.SeekTail(); err != nil {
+		return nil, err
+	}
+	n, err := j.PreviousSkip(uint64(lines))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*sdjournal.JournalEntry, 0, n)
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			if c, err := j.Next(); err != nil {
+				return nil, err
+			} else if c == 0 {
+				break
+			}
+		}
+		entry, err := j.GetEntry()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
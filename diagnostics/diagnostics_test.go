@@ -0,0 +1,135 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-systemd/dbus"
+	godbus "github.com/godbus/dbus"
+)
+
+// fakeUnits serves the properties of a failed service and a failed socket,
+// and the processes of the units in processes.
+type fakeUnits struct {
+	processes map[string][]dbus.UnitProcess
+}
+
+func (f *fakeUnits) GetTypedUnitPropertiesContext(ctx context.Context, unit string) (*dbus.UnitProperties, error) {
+	return &dbus.UnitProperties{
+		Id:           unit,
+		LoadState:    "loaded",
+		ActiveState:  "failed",
+		SubState:     "failed",
+		InvocationID: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		FragmentPath: "/etc/systemd/system/" + unit,
+	}, nil
+}
+
+func (f *fakeUnits) GetServicePropertiesContext(ctx context.Context, unit string) (*dbus.ServiceProperties, error) {
+	return &dbus.ServiceProperties{Result: "exit-code", ExecMainCode: 1, ExecMainStatus: 3, NRestarts: 2}, nil
+}
+
+func (f *fakeUnits) GetUnitTypePropertyContext(ctx context.Context, unit string, unitType string, propertyName string) (*dbus.Property, error) {
+	if unitType != "Socket" || propertyName != "Result" {
+		return nil, dbus.ErrUnknownProperty
+	}
+	return &dbus.Property{Name: propertyName, Value: godbus.MakeVariant("resources")}, nil
+}
+
+func (f *fakeUnits) GetUnitProcessesContext(ctx context.Context, name string) ([]dbus.UnitProcess, error) {
+	processes, ok := f.processes[name]
+	if !ok {
+		return nil, &dbus.Error{Name: "org.freedesktop.systemd1.NoSuchUnit", Message: "Unit " + name + " not loaded."}
+	}
+	return processes, nil
+}
+
+func TestCollectUnit(t *testing.T) {
+	processes := []dbus.UnitProcess{{Path: "/system.slice/foo.service", PID: 42, Command: "/usr/bin/foo"}}
+	units := &fakeUnits{processes: map[string][]dbus.UnitProcess{"foo.service": processes}}
+
+	d, err := collectUnit(context.Background(), units, "foo.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "foo.service" || d.ActiveState != "failed" || d.Result != "exit-code" ||
+		d.ExecMainCode != 1 || d.ExecMainStatus != 3 || d.NRestarts != 2 || len(d.InvocationID) != 16 {
+		t.Fatalf("Unexpected unit state %+v", d)
+	}
+	if !reflect.DeepEqual(d.Processes, processes) {
+		t.Fatalf("Unexpected processes %+v", d.Processes)
+	}
+
+	// The socket is not loaded anymore.
+	d, err = collectUnit(context.Background(), units, "foo.socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Result != "resources" || d.Processes != nil {
+		t.Fatalf("Unexpected unit state %+v", d)
+	}
+}
+
+func TestCollectUnitError(t *testing.T) {
+	units := &errorUnits{err: dbus.ErrAccessDenied}
+	if _, err := collectUnit(context.Background(), units, "foo.service"); !errors.Is(err, dbus.ErrAccessDenied) {
+		t.Fatalf("Expected an access denied error, got %v", err)
+	}
+}
+
+// errorUnits fails to list the processes of units with err.
+type errorUnits struct {
+	fakeUnits
+	err error
+}
+
+func (e *errorUnits) GetUnitProcessesContext(ctx context.Context, name string) ([]dbus.UnitProcess, error) {
+	return nil, e.err
+}
+
+func TestCollect(t *testing.T) {
+	if _, err := os.Stat("/run/systemd/system"); err != nil || os.Geteuid() != 0 {
+		t.Skip("testing systemd requires root on a system booted with systemd")
+	}
+
+	conn, err := dbus.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	target := "systemd-journald.service"
+	d, err := Collect(conn, target, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != target || d.LoadState != "loaded" || d.ActiveState != "active" || d.Result != "success" {
+		t.Fatalf("Unexpected unit state %+v", d)
+	}
+	if d.FragmentPath == "" || len(d.InvocationID) != 16 {
+		t.Fatalf("Unexpected unit %+v", d)
+	}
+	if len(d.Processes) == 0 {
+		t.Fatal("No processes found for", target)
+	}
+	if len(d.Journal) > 10 {
+		t.Fatalf("Expected at most 10 journal entries, got %d", len(d.Journal))
+	}
+}
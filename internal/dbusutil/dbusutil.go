@@ -0,0 +1,113 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbusutil holds the D-Bus helpers shared by the dbus, login1 and
+// machine1 packages.
+package dbusutil
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// Object calls the methods of a D-Bus object, with the
+// ALLOW_INTERACTIVE_AUTHORIZATION flag set on all of them once
+// SetInteractiveAuthorization enabled it.
+type Object struct {
+	bus  *dbus.Conn
+	dest string
+	path dbus.ObjectPath
+
+	mu          sync.Mutex // guards interactive
+	interactive bool
+}
+
+// NewObject returns the object path of dest on bus.
+func NewObject(bus *dbus.Conn, dest string, path dbus.ObjectPath) *Object {
+	return &Object{bus: bus, dest: dest, path: path}
+}
+
+// SetInteractiveAuthorization sets whether the calls of o may prompt the user
+// to authorize them through polkit. Otherwise, calls not authorized
+// beforehand fail with ErrInteractiveAuthorizationRequired or
+// ErrAccessDenied.
+func (o *Object) SetInteractiveAuthorization(allow bool) {
+	o.mu.Lock()
+	o.interactive = allow
+	o.mu.Unlock()
+}
+
+// Call calls method like Call, adding the flags set by
+// SetInteractiveAuthorization. The error of the returned call is wrapped by
+// WrapError.
+func (o *Object) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	o.mu.Lock()
+	if o.interactive {
+		flags |= dbus.FlagAllowInteractiveAuthorization
+	}
+	o.mu.Unlock()
+
+	call := Call(o.bus, o.dest, o.path, method, flags, args...)
+	call.Err = WrapError(call.Err)
+	return call
+}
+
+// Call is the same as (*dbus.Object).Call on the object path of dest, except
+// that it keeps the ALLOW_INTERACTIVE_AUTHORIZATION flag, see Go.
+func Call(bus *dbus.Conn, dest string, path dbus.ObjectPath, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	if flags&dbus.FlagAllowInteractiveAuthorization == 0 {
+		return bus.Object(dest, path).Call(method, flags, args...)
+	}
+	call := Go(bus, dest, path, method, flags, make(chan *dbus.Call, 1), args...)
+	if call.Done != nil {
+		call = <-call.Done
+	}
+	return call
+}
+
+// Go is the same as (*dbus.Object).Go on the object path of dest, except that
+// it keeps the ALLOW_INTERACTIVE_AUTHORIZATION flag: godbus drops it from the
+// flags passed to Go, so the message is built here when it is set. If the
+// flags include FlagNoReplyExpected, the returned call has no Done channel.
+func Go(bus *dbus.Conn, dest string, path dbus.ObjectPath, method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	if flags&dbus.FlagAllowInteractiveAuthorization == 0 {
+		return bus.Object(dest, path).Go(method, flags, ch, args...)
+	}
+	return bus.Send(NewMethodCall(dest, path, method, flags, args...), ch)
+}
+
+// NewMethodCall returns the message calling method on the object path of
+// dest.
+func NewMethodCall(dest string, path dbus.ObjectPath, method string, flags dbus.Flags, args ...interface{}) *dbus.Message {
+	msg := &dbus.Message{
+		Type:  dbus.TypeMethodCall,
+		Flags: flags,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldPath:        dbus.MakeVariant(path),
+			dbus.FieldDestination: dbus.MakeVariant(dest),
+		},
+		Body: args,
+	}
+	if i := strings.LastIndex(method, "."); i != -1 {
+		msg.Headers[dbus.FieldInterface] = dbus.MakeVariant(method[:i])
+		method = method[i+1:]
+	}
+	msg.Headers[dbus.FieldMember] = dbus.MakeVariant(method)
+	if len(args) > 0 {
+		msg.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(args...))
+	}
+	return msg
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbusutil
+
+import (
+	"github.com/godbus/dbus"
+)
+
+// Error is an error reply to a method call, as returned by the dbus, login1
+// and machine1 packages, which export it as their Error type. It wraps the
+// original dbus.Error, and matches the sentinel errors with the same name
+// under errors.Is, whichever package they are exported by.
+type Error struct {
+	Name    string // The D-Bus error name, e.g. org.freedesktop.systemd1.NoSuchUnit
+	Message string // The error message, if any
+
+	err error // The original error, nil for sentinels
+}
+
+// The errors returned by the bus, see
+// https://dbus.freedesktop.org/doc/dbus-specification.html
+var (
+	ErrAccessDenied                     = &Error{Name: "org.freedesktop.DBus.Error.AccessDenied"}
+	ErrInteractiveAuthorizationRequired = &Error{Name: "org.freedesktop.DBus.Error.InteractiveAuthorizationRequired"}
+	ErrInvalidArgs                      = &Error{Name: "org.freedesktop.DBus.Error.InvalidArgs"}
+	ErrNoReply                          = &Error{Name: "org.freedesktop.DBus.Error.NoReply"}
+	ErrNotSupported                     = &Error{Name: "org.freedesktop.DBus.Error.NotSupported"}
+	ErrServiceUnknown                   = &Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"}
+	ErrUnknownMethod                    = &Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"}
+	ErrUnknownObject                    = &Error{Name: "org.freedesktop.DBus.Error.UnknownObject"}
+	ErrUnknownProperty                  = &Error{Name: "org.freedesktop.DBus.Error.UnknownProperty"}
+)
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return e.Name
+}
+
+// Is reports whether target is an *Error with the same name, such as one of
+// the sentinel errors.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Name == e.Name
+}
+
+// Unwrap returns the original dbus.Error.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// WrapError returns err as an *Error if it is an error reply.
+func WrapError(err error) error {
+	e, ok := err.(dbus.Error)
+	if !ok {
+		return err
+	}
+
+	var message string
+	if len(e.Body) > 0 {
+		message, _ = e.Body[0].(string)
+	}
+	return &Error{Name: e.Name, Message: message, err: e}
+}
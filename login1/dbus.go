@@ -20,6 +20,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/coreos/go-systemd/internal/dbusutil"
 	"github.com/godbus/dbus"
 )
 
@@ -31,7 +32,7 @@ const (
 // Conn is a connection to systemds dbus endpoint.
 type Conn struct {
 	conn   *dbus.Conn
-	object dbus.BusObject
+	object *dbusutil.Object
 }
 
 // New() establishes a connection to the system bus and authenticates.
@@ -69,14 +70,21 @@ func (c *Conn) initConnection() error {
 		return err
 	}
 
-	c.object = c.conn.Object("org.freedesktop.login1", dbus.ObjectPath(dbusPath))
+	c.object = dbusutil.NewObject(c.conn, "org.freedesktop.login1", dbus.ObjectPath(dbusPath))
 
 	return nil
 }
 
+// SetInteractiveAuthorization sets whether logind may prompt the user through
+// polkit to authorize the connection's method calls, e.g. Inhibit. PowerOff and
+// Reboot allow it anyway when asking for auth.
+func (c *Conn) SetInteractiveAuthorization(allow bool) {
+	c.object.SetInteractiveAuthorization(allow)
+}
+
 // Reboot asks logind for a reboot optionally asking for auth.
 func (c *Conn) Reboot(askForAuth bool) {
-	c.object.Call(dbusInterface+".Reboot", 0, askForAuth)
+	c.object.Call(dbusInterface+".Reboot", authFlags(askForAuth), askForAuth)
 }
 
 // Inhibit takes inhibition lock in logind.
@@ -104,5 +112,14 @@ func (c *Conn) Subscribe(members ...string) chan *dbus.Signal {
 
 // PowerOff asks logind for a power off optionally asking for auth.
 func (c *Conn) PowerOff(askForAuth bool) {
-	c.object.Call(dbusInterface+".PowerOff", 0, askForAuth)
+	c.object.Call(dbusInterface+".PowerOff", authFlags(askForAuth), askForAuth)
+}
+
+// authFlags returns the flags of a call which asks for auth if askForAuth is
+// true: logind only prompts the user if the call allows it.
+func authFlags(askForAuth bool) dbus.Flags {
+	if askForAuth {
+		return dbus.FlagAllowInteractiveAuthorization
+	}
+	return 0
 }
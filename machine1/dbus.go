@@ -21,6 +21,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/coreos/go-systemd/internal/dbusutil"
 	"github.com/godbus/dbus"
 )
 
@@ -32,7 +33,7 @@ const (
 // Conn is a connection to systemds dbus endpoint.
 type Conn struct {
 	conn   *dbus.Conn
-	object dbus.BusObject
+	object *dbusutil.Object
 }
 
 // New() establishes a connection to the system bus and authenticates.
@@ -70,11 +71,18 @@ func (c *Conn) initConnection() error {
 		return err
 	}
 
-	c.object = c.conn.Object("org.freedesktop.machine1", dbus.ObjectPath(dbusPath))
+	c.object = dbusutil.NewObject(c.conn, "org.freedesktop.machine1", dbus.ObjectPath(dbusPath))
 
 	return nil
 }
 
+// SetInteractiveAuthorization sets whether machined may prompt the user
+// through polkit to authorize the connection's method calls, such as
+// RegisterMachine.
+func (c *Conn) SetInteractiveAuthorization(allow bool) {
+	c.object.SetInteractiveAuthorization(allow)
+}
+
 // RegisterMachine registers the container with the systemd-machined
 func (c *Conn) RegisterMachine(name string, id []byte, service string, class string, pid int, root_directory string) error {
 	return c.object.Call(dbusInterface+".RegisterMachine", 0, name, id, service, class, uint32(pid), root_directory).Err
@@ -0,0 +1,48 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machine1
+
+import (
+	"github.com/coreos/go-systemd/internal/dbusutil"
+)
+
+// Error is an error reply of machined or the bus to a method call. The errors
+// returned by Conn's methods for such replies are of type *Error, and wrap
+// the original dbus.Error. They match the sentinel error with the same name
+// under errors.Is, including the bus sentinels of the go-systemd dbus
+// package, whose Error is the same type; use errors.As to get the name of
+// errors without one.
+type Error = dbusutil.Error
+
+// The errors returned by machined, see
+// https://github.com/systemd/systemd/blob/main/src/libsystemd/sd-bus/bus-common-errors.h
+var (
+	ErrNoSuchMachine       = &Error{Name: "org.freedesktop.machine1.NoSuchMachine"}
+	ErrNoSuchImage         = &Error{Name: "org.freedesktop.machine1.NoSuchImage"}
+	ErrNoMachineForPID     = &Error{Name: "org.freedesktop.machine1.NoMachineForPID"}
+	ErrMachineExists       = &Error{Name: "org.freedesktop.machine1.MachineExists"}
+	ErrNoPrivateNetworking = &Error{Name: "org.freedesktop.machine1.NoPrivateNetworking"}
+	ErrNoSuchUserMapping   = &Error{Name: "org.freedesktop.machine1.NoSuchUserMapping"}
+	ErrNoSuchGroupMapping  = &Error{Name: "org.freedesktop.machine1.NoSuchGroupMapping"}
+)
+
+// The errors returned by the bus, see
+// https://dbus.freedesktop.org/doc/dbus-specification.html
+var (
+	ErrAccessDenied                     = dbusutil.ErrAccessDenied
+	ErrInteractiveAuthorizationRequired = dbusutil.ErrInteractiveAuthorizationRequired
+	ErrInvalidArgs                      = dbusutil.ErrInvalidArgs
+	ErrNotSupported                     = dbusutil.ErrNotSupported
+)
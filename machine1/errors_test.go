@@ -0,0 +1,49 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machine1
+
+import (
+	"errors"
+	"testing"
+
+	sddbus "github.com/coreos/go-systemd/dbus"
+	"github.com/coreos/go-systemd/internal/dbusutil"
+	"github.com/godbus/dbus"
+)
+
+func TestWrapError(t *testing.T) {
+	err := dbusutil.WrapError(dbus.Error{Name: "org.freedesktop.machine1.MachineExists", Body: []interface{}{"Machine 'foo' already exists"}})
+	if !errors.Is(err, ErrMachineExists) || errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("Expected ErrMachineExists, got %v", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Name != "org.freedesktop.machine1.MachineExists" || err.Error() != "Machine 'foo' already exists" {
+		t.Fatalf("Unexpected error %#v", err)
+	}
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		t.Fatalf("Original error not wrapped: %#v", err)
+	}
+
+	// The bus errors match the sentinels of the dbus package too.
+	err = dbusutil.WrapError(dbus.Error{Name: "org.freedesktop.DBus.Error.AccessDenied"})
+	if !errors.Is(err, ErrAccessDenied) || !errors.Is(err, sddbus.ErrAccessDenied) || errors.Is(err, sddbus.ErrInvalidArgs) {
+		t.Fatalf("Expected ErrAccessDenied, got %v", err)
+	}
+
+	if err := dbusutil.WrapError(nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
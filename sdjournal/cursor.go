@@ -0,0 +1,143 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdjournal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrCursorIncomparable is returned when comparing two cursors which
+	// do not share the same sequence number ID, and therefore cannot be
+	// ordered relative to each other.
+	ErrCursorIncomparable = errors.New("cursors have different seqnum IDs")
+)
+
+// Cursor is the parsed form of the opaque cursor strings returned by
+// Journal.GetCursor, of the form
+//
+//	s=<seqnum id>;i=<seqnum>;b=<boot id>;m=<monotonic>;t=<realtime>;x=<xor hash>
+//
+// A Cursor can be inspected and compared without opening the journal.
+type Cursor struct {
+	SeqnumID  string // 128-bit ID of the sequence number space, as hex
+	Seqnum    uint64 // Sequence number of the entry within SeqnumID
+	BootID    string // 128-bit ID of the boot the entry was written in, as hex
+	Monotonic uint64 // CLOCK_MONOTONIC timestamp of the entry, in microseconds
+	Realtime  uint64 // CLOCK_REALTIME timestamp of the entry, in microseconds
+	XorHash   uint64 // XOR of the hashes of all data objects of the entry
+}
+
+// ParseCursor parses a cursor string as returned by Journal.GetCursor or
+// found in the __CURSOR field of a JournalEntry.
+func ParseCursor(cursor string) (*Cursor, error) {
+	c := &Cursor{}
+	var seen [6]bool
+
+	for _, item := range strings.Split(cursor, ";") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || len(kv[0]) != 1 {
+			return nil, fmt.Errorf("malformed cursor item %q", item)
+		}
+
+		var err error
+		switch kv[0] {
+		case "s":
+			c.SeqnumID, err = parseCursorID(kv[1])
+			seen[0] = true
+		case "i":
+			c.Seqnum, err = strconv.ParseUint(kv[1], 16, 64)
+			seen[1] = true
+		case "b":
+			c.BootID, err = parseCursorID(kv[1])
+			seen[2] = true
+		case "m":
+			c.Monotonic, err = strconv.ParseUint(kv[1], 16, 64)
+			seen[3] = true
+		case "t":
+			c.Realtime, err = strconv.ParseUint(kv[1], 16, 64)
+			seen[4] = true
+		case "x":
+			c.XorHash, err = strconv.ParseUint(kv[1], 16, 64)
+			seen[5] = true
+		default:
+			// Unknown keys are skipped, as sd_journal_seek_cursor does.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed cursor item %q: %v", item, err)
+		}
+	}
+
+	for i, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("cursor %q is missing field %q", cursor, "sibmtx"[i:i+1])
+		}
+	}
+
+	return c, nil
+}
+
+func parseCursorID(s string) (string, error) {
+	if len(s) != 32 {
+		return "", fmt.Errorf("expected 32 hex digits, got %d", len(s))
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("0123456789abcdef", s[i]) == -1 {
+			return "", fmt.Errorf("invalid hex digit %q", s[i])
+		}
+	}
+	return s, nil
+}
+
+// String returns the cursor in the format understood by Journal.SeekCursor
+// and Journal.TestCursor.
+func (c *Cursor) String() string {
+	return fmt.Sprintf("s=%s;i=%x;b=%s;m=%x;t=%x;x=%x",
+		c.SeqnumID, c.Seqnum, c.BootID, c.Monotonic, c.Realtime, c.XorHash)
+}
+
+// Compare orders c relative to other. It returns -1 if c points to an
+// earlier entry than other, 0 if both point to the same entry and +1 if c
+// points to a later entry. Only cursors sharing a SeqnumID are ordered;
+// otherwise ErrCursorIncomparable is returned.
+func (c *Cursor) Compare(other *Cursor) (int, error) {
+	if c.SeqnumID != other.SeqnumID {
+		return 0, ErrCursorIncomparable
+	}
+
+	switch {
+	case c.Seqnum < other.Seqnum:
+		return -1, nil
+	case c.Seqnum > other.Seqnum:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// RealtimeTime returns the wallclock time at which the entry was written.
+func (c *Cursor) RealtimeTime() time.Time {
+	return time.Unix(0, int64(c.Realtime)*int64(time.Microsecond))
+}
+
+// MonotonicDuration returns the time elapsed since boot BootID at which the
+// entry was written.
+func (c *Cursor) MonotonicDuration() time.Duration {
+	return time.Duration(c.Monotonic) * time.Microsecond
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdjournal
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	testCursor = "s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7;b=6c7c6013a8a34234936af7fb4e7f38bd;m=2b7a49f6;t=55f2a8d8c5fd0;x=bc9f9e79e5e0a1e0"
+	testSeqnum = "739ad463348b4ceca5a9e69c95a3c93f"
+	testBootID = "6c7c6013a8a34234936af7fb4e7f38bd"
+)
+
+func TestParseCursor(t *testing.T) {
+	c, err := ParseCursor(testCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Cursor{
+		SeqnumID:  testSeqnum,
+		Seqnum:    0x4ece7,
+		BootID:    testBootID,
+		Monotonic: 0x2b7a49f6,
+		Realtime:  0x55f2a8d8c5fd0,
+		XorHash:   0xbc9f9e79e5e0a1e0,
+	}
+	if *c != want {
+		t.Fatalf("got %+v, want %+v", *c, want)
+	}
+
+	if s := c.String(); s != testCursor {
+		t.Errorf("String() returned %q, want %q", s, testCursor)
+	}
+
+	if d := c.MonotonicDuration(); d != 0x2b7a49f6*time.Microsecond {
+		t.Errorf("MonotonicDuration() returned %v", d)
+	}
+
+	if ts := c.RealtimeTime(); ts.UnixNano() != 0x55f2a8d8c5fd0*1000 {
+		t.Errorf("RealtimeTime() returned %v", ts)
+	}
+}
+
+func TestParseCursorErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"garbage",
+		"s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7",
+		"s=739ad463;i=4ece7;b=6c7c6013a8a34234936af7fb4e7f38bd;m=2b7a49f6;t=55f2a8d8c5fd0;x=bc9f9e79e5e0a1e0",
+		"s=739ad463348b4ceca5a9e69c95a3c93f;i=zz;b=6c7c6013a8a34234936af7fb4e7f38bd;m=2b7a49f6;t=55f2a8d8c5fd0;x=bc9f9e79e5e0a1e0",
+		"s=739AD463348B4CECA5A9E69C95A3C93F;i=4ece7;b=6c7c6013a8a34234936af7fb4e7f38bd;m=2b7a49f6;t=55f2a8d8c5fd0;x=bc9f9e79e5e0a1e0",
+	} {
+		if _, err := ParseCursor(in); err == nil {
+			t.Errorf("ParseCursor(%q) succeeded, expected an error", in)
+		}
+	}
+}
+
+func TestCursorCompare(t *testing.T) {
+	a, err := ParseCursor(testCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := *a
+	b.Seqnum++
+
+	for _, tt := range []struct {
+		x, y *Cursor
+		want int
+	}{
+		{a, a, 0},
+		{a, &b, -1},
+		{&b, a, 1},
+	} {
+		got, err := tt.x.Compare(tt.y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Compare(%d, %d) returned %d, want %d", tt.x.Seqnum, tt.y.Seqnum, got, tt.want)
+		}
+	}
+
+	other := *a
+	other.SeqnumID = testBootID
+	if _, err := a.Compare(&other); err != ErrCursorIncomparable {
+		t.Errorf("expected ErrCursorIncomparable, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdjournal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultBatchSize = 100
+
+// CheckpointFollowerConfig represents options to drive the behavior of a
+// CheckpointFollower.
+type CheckpointFollowerConfig struct {
+	// Where to start reading and which entries to show when no checkpoint
+	// has been saved yet. Once a checkpoint exists the Cursor field is
+	// ignored and reading resumes after the checkpointed entry.
+	JournalReaderConfig
+
+	// Path of the file holding the cursor of the last acknowledged entry.
+	// It is replaced atomically every time a batch is acknowledged.
+	StateFile string
+
+	// Maximum number of entries handed to the handler at once. Defaults to
+	// 100 if zero.
+	BatchSize int
+}
+
+// CheckpointFollower follows the journal and delivers entries in batches to
+// a handler, persisting the cursor of the last entry of every batch the
+// handler accepted. This gives at-least-once delivery across restarts: an
+// entry is only checkpointed after the handler returned successfully, so a
+// crash between the two causes the batch to be delivered again. A
+// CheckpointFollower is not safe for concurrent use by multiple goroutines.
+type CheckpointFollower struct {
+	reader    *JournalReader
+	stateFile string
+	batchSize int
+
+	// cursor of the last acknowledged entry, if any
+	cursor string
+	// true if the journal is positioned on an entry not yet delivered
+	unread bool
+}
+
+// NewCheckpointFollower opens the journal according to config and, if
+// config.StateFile holds a checkpoint, positions it right after the
+// checkpointed entry.
+func NewCheckpointFollower(config CheckpointFollowerConfig) (*CheckpointFollower, error) {
+	if config.StateFile == "" {
+		return nil, errors.New("no state file given")
+	}
+
+	cursor, err := loadCheckpoint(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := config.JournalReaderConfig
+	if cursor != "" {
+		rc.Since = 0
+		rc.NumFromTail = 0
+		rc.Cursor = cursor
+	}
+
+	r, err := NewJournalReader(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &CheckpointFollower{
+		reader:    r,
+		stateFile: config.StateFile,
+		batchSize: config.BatchSize,
+		cursor:    cursor,
+	}
+	if f.batchSize <= 0 {
+		f.batchSize = defaultBatchSize
+	}
+
+	if cursor != "" {
+		if err := f.seek(cursor, true); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Cursor returns the cursor of the last acknowledged entry, or the empty
+// string if no entry has been acknowledged yet.
+func (f *CheckpointFollower) Cursor() string {
+	return f.cursor
+}
+
+// Close closes the CheckpointFollower's handle to the journal.
+func (f *CheckpointFollower) Close() error {
+	return f.reader.Close()
+}
+
+// Follow synchronously follows the journal, passing batches of entries to
+// handler and checkpointing the last entry of each batch once handler
+// returns nil. The follow will continue until a single time.Time is received
+// on the until channel, in which case ErrExpired is returned.
+//
+// If handler returns an error, Follow returns it without checkpointing the
+// batch, and a subsequent call to Follow delivers the same batch again.
+func (f *CheckpointFollower) Follow(until <-chan time.Time, handler func([]*JournalEntry) error) error {
+	j := f.reader.journal
+
+	for {
+		batch, err := f.readBatch()
+		if err != nil {
+			return err
+		}
+
+		if len(batch) > 0 {
+			if herr := handler(batch); herr != nil {
+				// Rewind so the failed batch is delivered again.
+				if err := f.seek(batch[0].Cursor, false); err != nil {
+					return err
+				}
+				return herr
+			}
+
+			last := batch[len(batch)-1].Cursor
+			if err := saveCheckpoint(f.stateFile, last); err != nil {
+				return err
+			}
+			f.cursor = last
+		}
+
+		select {
+		case <-until:
+			return ErrExpired
+		default:
+		}
+
+		if len(batch) < f.batchSize {
+			// We're at the tail, so wait for new entries.
+			j.Wait(time.Second)
+		}
+	}
+}
+
+// readBatch reads up to batchSize entries from the current position.
+func (f *CheckpointFollower) readBatch() ([]*JournalEntry, error) {
+	j := f.reader.journal
+
+	var batch []*JournalEntry
+	for len(batch) < f.batchSize {
+		if f.unread {
+			f.unread = false
+		} else {
+			n, err := j.Next()
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				break
+			}
+		}
+
+		entry, err := j.GetEntry()
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, entry)
+	}
+
+	return batch, nil
+}
+
+// seek positions the journal on the entry identified by cursor. If
+// delivered is true and the entry still exists, it is skipped; otherwise the
+// entry found at the position (the closest one, if the original was rotated
+// away) is the next one to be delivered.
+func (f *CheckpointFollower) seek(cursor string, delivered bool) error {
+	j := f.reader.journal
+
+	if err := j.SeekCursor(cursor); err != nil {
+		return err
+	}
+
+	n, err := j.Next()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		f.unread = false
+		return nil
+	}
+
+	err = j.TestCursor(cursor)
+	switch {
+	case err == ErrNoTestCursor:
+		f.unread = true
+	case err != nil:
+		return err
+	default:
+		f.unread = !delivered
+	}
+
+	return nil
+}
+
+// loadCheckpoint returns the cursor saved in path, or the empty string if
+// path does not exist.
+func loadCheckpoint(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	cursor := strings.TrimSpace(string(b))
+	if cursor == "" {
+		return "", nil
+	}
+	if _, err := ParseCursor(cursor); err != nil {
+		return "", err
+	}
+
+	return cursor, nil
+}
+
+// saveCheckpoint atomically replaces the contents of path with cursor.
+func saveCheckpoint(path string, cursor string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.WriteString(cursor + "\n")
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdjournal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+func TestCheckpointRoundtrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-systemd-test")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	state := filepath.Join(dir, "cursor")
+
+	cursor, err := loadCheckpoint(state)
+	if err != nil {
+		t.Fatalf("Error loading missing checkpoint: %s", err)
+	}
+	if cursor != "" {
+		t.Fatalf("Got unexpected cursor %q from missing checkpoint", cursor)
+	}
+
+	if err := saveCheckpoint(state, testCursor); err != nil {
+		t.Fatalf("Error saving checkpoint: %s", err)
+	}
+
+	cursor, err = loadCheckpoint(state)
+	if err != nil {
+		t.Fatalf("Error loading checkpoint: %s", err)
+	}
+	if cursor != testCursor {
+		t.Fatalf("Got cursor %q, want %q", cursor, testCursor)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected only the state file in %s, got %d files", dir, len(files))
+	}
+
+	if err := ioutil.WriteFile(state, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(state); err == nil {
+		t.Fatal("Expected an error loading a malformed checkpoint")
+	}
+}
+
+func TestCheckpointFollowerResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-systemd-test")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	matchField := "TESTCHECKPOINTFOLLOWER"
+	matchValue := fmt.Sprintf("%d", time.Now().UnixNano())
+	config := CheckpointFollowerConfig{
+		JournalReaderConfig: JournalReaderConfig{
+			Since:   time.Duration(-15) * time.Second,
+			Matches: []Match{{Field: matchField, Value: matchValue}},
+		},
+		StateFile: filepath.Join(dir, "cursor"),
+		BatchSize: 2,
+	}
+
+	for i := 0; i < 5; i++ {
+		err := journal.Send(fmt.Sprintf("checkpoint %d", i), journal.PriInfo, map[string]string{matchField: matchValue})
+		if err != nil {
+			t.Fatalf("Error writing to journal: %s", err)
+		}
+	}
+	time.Sleep(time.Second)
+
+	// Acknowledge the first batch, then fail the second one.
+	f, err := NewCheckpointFollower(config)
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	errFail := errors.New("fail")
+	batches := 0
+	err = f.Follow(nil, func(entries []*JournalEntry) error {
+		batches++
+		if batches == 2 {
+			return errFail
+		}
+		return nil
+	})
+	f.Close()
+	if err != errFail {
+		t.Fatalf("Expected handler error, got %v", err)
+	}
+
+	// A new follower must resume with the third entry.
+	f, err = NewCheckpointFollower(config)
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer f.Close()
+
+	var got []string
+	err = f.Follow(time.After(3*time.Second), func(entries []*JournalEntry) error {
+		for _, e := range entries {
+			got = append(got, e.Fields["MESSAGE"])
+		}
+		return nil
+	})
+	if err != ErrExpired {
+		t.Fatalf("Error during follow: %s", err)
+	}
+
+	want := []string{"checkpoint 2", "checkpoint 3", "checkpoint 4"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Got entries %v, want %v", got, want)
+	}
+}
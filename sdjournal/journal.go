@@ -258,6 +258,7 @@ package sdjournal
 import "C"
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -325,6 +326,12 @@ const (
 	IndefiniteWait time.Duration = 1<<63 - 1
 )
 
+var (
+	// ErrNoTestCursor is returned by TestCursor when the current position in
+	// the journal does not match the supplied cursor.
+	ErrNoTestCursor = errors.New("cursor parameter is not the same as current position")
+)
+
 // Journal is a Go wrapper of an sd_journal structure.
 type Journal struct {
 	cjournal *C.sd_journal
@@ -793,7 +800,7 @@ func (j *Journal) GetCursor() (string, error) {
 }
 
 // TestCursor checks whether the current position in the journal matches the
-// specified cursor
+// specified cursor. ErrNoTestCursor is returned if it does not.
 func (j *Journal) TestCursor(cursor string) error {
 	sd_journal_test_cursor, err := getFunction("sd_journal_test_cursor")
 	if err != nil {
@@ -809,6 +816,8 @@ func (j *Journal) TestCursor(cursor string) error {
 
 	if r < 0 {
 		return fmt.Errorf("failed to test to cursor %q: %d", cursor, syscall.Errno(-r))
+	} else if r == 0 {
+		return ErrNoTestCursor
 	}
 
 	return nil